@@ -1,13 +1,12 @@
 package arangit
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"time"
 
+	driver "github.com/arangodb/go-driver"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
 	git "github.com/go-git/go-git/v5"
@@ -17,36 +16,72 @@ import (
 	"github.com/mhelmich/arangit/arangodb"
 )
 
+var defaultIdentity = object.Signature{
+	Name:  "John Doe",
+	Email: "john@doe.org",
+}
+
 var (
 	// ErrTagDoesntExist -
 	ErrTagDoesntExist = errors.New("tag doesn't exist")
 	// ErrIteratorExhausted -
 	ErrIteratorExhausted = errors.New("iterator is exhausted")
+	// ErrIteratorClosed -
+	ErrIteratorClosed = errors.New("iterator is closed")
 	// ErrStop -
 	ErrStop = errors.New("stop")
 )
 
-// Repository -
+// Repository is safe for concurrent use. Reads at any revision run in
+// parallel, writes to the same branch are serialized.
 type Repository interface {
 	CommitFile(string, io.Reader) error
+	CommitFileWithOptions(path string, rdr io.Reader, opts *CommitOptions) error
+	DeleteFile(path string, opts *CommitOptions) error
+	MoveFile(from string, to string, opts *CommitOptions) error
 	TagHead(name string) error
+	TagHeadWithOptions(name string, opts *CommitOptions) error
 	CheckoutTag(name string) error
 	ReadFileFromHead(path string) ([]byte, error)
 	ReadFileFromTag(tagName string, path string) ([]byte, error)
+	ReadFile(rev string, path string) ([]byte, error)
 	PrintStatus() error
 	DeleteTag(name string) error
 	FileIterForTag(name string) (FileIterator, error)
 	FileIterForHead() (FileIterator, error)
+	FileIter(rev string) (FileIterator, error)
+	FileIterWithOptions(rev string, opts *FileIterOptions) (FileIterator, error)
+	CreateBranch(name string, rev string) error
+	DeleteBranch(name string) error
+	ListBranches() ([]string, error)
+	CheckoutBranch(name string) error
+	CommitFileToBranch(branch string, path string, rdr io.Reader, opts *CommitOptions) error
+	Merge(source string, target string, opts *MergeOptions) (*MergeResult, error)
+	CommitChangeset(branch string, cs *Changeset, opts *CommitOptions) (plumbing.Hash, error)
+	ApplyJSONPatch(branch string, path string, patch []byte, opts *PatchOptions) (plumbing.Hash, error)
+	ApplyMergePatch(branch string, path string, patch []byte, opts *PatchOptions) (plumbing.Hash, error)
+	Log(opts *LogOptions) (*LogPage, error)
+	FileHistory(ref string, path string, opts *FileHistoryOptions) ([]FileVersion, error)
+	Diff(from string, to string, opts *DiffOptions) (*DiffResult, error)
+	Search(ref string, query string, opts *SearchOptions) ([]SearchResult, error)
+	SearchHistory(ref string, query string, opts *SearchOptions) ([]HistorySearchResult, error)
+	QueryJSON(ref string, filter string, bindVars map[string]interface{}) ([]JSONResult, error)
+	SnapshotCollection(name string, opts *SnapshotOptions) (plumbing.Hash, error)
+	RestoreCollection(name string, rev string, opts *RestoreOptions) (*RestoreReport, error)
+	WatchCollection(name string, opts *WatchOptions) (*Watcher, error)
+	KV(opts *KVOptions) (*KV, error)
 }
 
-// FileIterator -
+// FileIterator iterates over the files of a tree. It isn't safe for
+// concurrent use and has to be closed unless ForEach was called.
 type FileIterator interface {
-	Next() (io.Reader, error)
+	Next() (*FileEntry, error)
 	ForEach(FileIteratorFunc) error
+	Close()
 }
 
 // FileIteratorFunc -
-type FileIteratorFunc func(io.Reader, os.FileInfo) error
+type FileIteratorFunc func(*FileEntry) error
 
 // OpenRepo -
 func OpenRepo(name string) (Repository, error) {
@@ -55,92 +90,151 @@ func OpenRepo(name string) (Repository, error) {
 		return nil, err
 	}
 
-	fs := memfs.New()
-	if created {
-		_, err = git.Init(arangoStorage, fs)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	repo, err := git.Open(arangoStorage, fs)
-	if err != nil {
-		return nil, err
-	}
-
-	return &repository{
-		fs:   fs,
-		repo: repo,
-	}, nil
+	return openRepo(arangoStorage, created, &RepoOptions{})
 }
 
-type repository struct {
-	fs   billy.Filesystem
-	repo *git.Repository
+// RepoOptions -
+type RepoOptions struct {
+	// ParseJSON stores a parsed copy of every committed JSON file so that
+	// it can be queried with QueryJSON
+	ParseJSON bool
+	// IndexContent stores the content of every committed text file as a
+	// string, so that it can be searched with SearchHistory
+	IndexContent bool
+	// Materialize maps branches and tags to collections that always
+	// contain one document per file of the branch or tag, see
+	// arangodb.MaterializedDocument. Keys are full reference names such as
+	// refs/heads/master or refs/tags/v1. The collections are emptied
+	// before they're filled the first time, so opening the repository
+	// fails with arangodb.ErrCollectionNotMaterialized if one already
+	// holds other documents. A commit doesn't fail if its collection
+	// can't be updated, it catches up with the next commit.
+	Materialize map[string]string
+	// Identity is the default author and committer of commits and tagger
+	// of tags. Its When is ignored.
+	Identity *object.Signature
+	// Clock returns the time of commits and tags, it defaults to time.Now
+	Clock func() time.Time
+	// MergeDrivers merge files that were changed on both sides of a merge,
+	// the driver of the first rule whose pattern matches the path is used
+	MergeDrivers []MergeDriverRule
+	// StructuralDiffers adds to and overrides the differs of
+	// DiffOptions.Structural by extension such as ".json", a nil differ
+	// disables the extension. JSON and YAML files are compared by default.
+	StructuralDiffers map[string]StructuralDiffer
 }
 
-func (r *repository) PrintStatus() error {
-	wt, err := r.repo.Worktree()
-	if err != nil {
-		return err
-	}
+// OpenRepoFromDatabase opens the repository stored in db and initializes it
+// if db doesn't contain a repository yet.
+func OpenRepoFromDatabase(db driver.Database) (Repository, error) {
+	return OpenRepoFromDatabaseWithOptions(db, nil)
+}
 
-	st, err := wt.Status()
-	if err != nil {
-		return err
+// OpenRepoFromDatabaseWithOptions is like OpenRepoFromDatabase but allows
+// configuring the repository.
+func OpenRepoFromDatabaseWithOptions(db driver.Database, opts *RepoOptions) (Repository, error) {
+	if opts == nil {
+		opts = &RepoOptions{}
 	}
 
-	fmt.Printf("Status:\n%s\n", st.String())
-	return nil
-}
-
-func (r *repository) ReadFileFromTag(tagName string, path string) ([]byte, error) {
-	err := r.CheckoutTag(tagName)
+	arangoStorage, err := arangodb.NewStoreFromDatabaseWithOptions(db, arangodb.Options{
+		ParseJSON:    opts.ParseJSON,
+		IndexContent: opts.IndexContent,
+		Materialize:  opts.Materialize,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := r.fs.Open(path)
-	if err != nil {
+	_, err = arangoStorage.Reference(plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		return openRepo(arangoStorage, true, opts)
+	} else if err != nil {
 		return nil, err
 	}
 
-	buf := &bytes.Buffer{}
-	_, err = io.Copy(buf, f)
-	return buf.Bytes(), err
+	return openRepo(arangoStorage, false, opts)
 }
 
-func (r *repository) ReadFileFromHead(path string) ([]byte, error) {
-	ref, err := r.repo.Head()
+func openRepo(arangoStorage arangodb.ArangoStore, created bool, opts *RepoOptions) (Repository, error) {
+	drivers, err := compileMergeDrivers(opts.MergeDrivers)
 	if err != nil {
 		return nil, err
 	}
 
-	w, err := r.repo.Worktree()
+	fs := memfs.New()
+	if created {
+		_, err := git.Init(arangoStorage, fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	repo, err := git.Open(arangoStorage, fs)
 	if err != nil {
 		return nil, err
 	}
 
-	// r.PrintStatus()
-	err = w.Checkout(&git.CheckoutOptions{
-		Hash: ref.Hash(),
-	})
+	r := &repository{
+		fs:           fs,
+		repo:         repo,
+		store:        arangoStorage,
+		identity:     defaultIdentity,
+		clock:        time.Now,
+		mergeDrivers: drivers,
+		differs:      map[string]StructuralDiffer{},
+	}
+	if opts.Identity != nil {
+		r.identity = object.Signature{Name: opts.Identity.Name, Email: opts.Identity.Email}
+	}
+	if opts.Clock != nil {
+		r.clock = opts.Clock
+	}
+	for _, differs := range []map[string]StructuralDiffer{defaultStructuralDiffers, opts.StructuralDiffers} {
+		for ext, differ := range differs {
+			r.differs[ext] = differ
+		}
+	}
+	return r, nil
+}
+
+type repository struct {
+	fs    billy.Filesystem
+	repo  *git.Repository
+	store arangodb.ArangoStore
+	locks locks
+	// commits caches the commit graph for Log
+	commits commitGraph
+	// identity is the default author, committer and tagger
+	identity     object.Signature
+	clock        func() time.Time
+	mergeDrivers []mergeDriver
+	// differs are the structural differs by extension
+	differs map[string]StructuralDiffer
+}
+
+func (r *repository) PrintStatus() error {
+	r.locks.worktree.Lock()
+	defer r.locks.worktree.Unlock()
+
+	wt, err := r.repo.Worktree()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// r.PrintStatus()
-	f, err := r.fs.Open(path)
+	st, err := wt.Status()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	buf := &bytes.Buffer{}
-	_, err = io.Copy(buf, f)
-	return buf.Bytes(), err
+	fmt.Printf("Status:\n%s\n", st.String())
+	return nil
 }
 
 func (r *repository) CheckoutTag(name string) error {
+	r.locks.worktree.Lock()
+	defer r.locks.worktree.Unlock()
+
 	tags, err := r.repo.Tags()
 	if err != nil {
 		return err
@@ -196,10 +290,17 @@ func (r *repository) CheckoutTag(name string) error {
 }
 
 func (r *repository) DeleteTag(name string) error {
+	defer r.lockRef(plumbing.NewTagReferenceName(name))()
 	return r.repo.DeleteTag(name)
 }
 
 func (r *repository) TagHead(name string) error {
+	return r.TagHeadWithOptions(name, nil)
+}
+
+// TagHeadWithOptions is like TagHead but allows setting the tagger, the
+// message and the time of the tag. The tagger is the committer of opts.
+func (r *repository) TagHeadWithOptions(name string, opts *CommitOptions) error {
 	// exists, err := r.tagExists(name)
 	// if err != nil {
 	// 	return err
@@ -213,13 +314,15 @@ func (r *repository) TagHead(name string) error {
 	}
 
 	fmt.Printf("HEAD: %s\n", h.Hash().String())
-	tag, err := r.repo.CreateTag(name, h.Hash(), &git.CreateTagOptions{
-		Message: "creating tag " + name,
-		Tagger: &object.Signature{
-			Name:  "John Doe",
-			Email: "john@doe.org",
-			When:  time.Now(),
-		},
+	return r.createTag(name, h.Hash(), opts)
+}
+
+func (r *repository) createTag(name string, h plumbing.Hash, opts *CommitOptions) error {
+	defer r.lockRef(plumbing.NewTagReferenceName(name))()
+	info := r.commitInfo(opts, "creating tag "+name)
+	tag, err := r.repo.CreateTag(name, h, &git.CreateTagOptions{
+		Message: info.message,
+		Tagger:  &info.committer,
 	})
 
 	if err == nil {
@@ -229,7 +332,20 @@ func (r *repository) TagHead(name string) error {
 }
 
 func (r *repository) CommitFile(path string, rdr io.Reader) error {
-	err := r.writeFile(path, rdr)
+	return r.CommitFileWithOptions(path, rdr, nil)
+}
+
+// CommitFileWithOptions is like CommitFile but allows setting the author,
+// committer, message and time of the commit. The message defaults to
+// "Update <path>".
+func (r *repository) CommitFileWithOptions(path string, rdr io.Reader, opts *CommitOptions) error {
+	unlock, err := r.lockWorktree()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = r.writeFile(path, rdr)
 	if err != nil {
 		return err
 	}
@@ -248,12 +364,10 @@ func (r *repository) CommitFile(path string, rdr io.Reader) error {
 	// r.PrintStatus()
 	fmt.Printf("HASH: %s\n", h.String())
 
-	commit, err := wt.Commit("testing_test.txt commit", &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "John Doe",
-			Email: "john@doe.org",
-			When:  time.Now(),
-		},
+	info := r.commitInfo(opts, "Update "+path)
+	commit, err := wt.Commit(info.message, &git.CommitOptions{
+		Author:    &info.author,
+		Committer: &info.committer,
 	})
 	if err != nil {
 		return err
@@ -261,7 +375,7 @@ func (r *repository) CommitFile(path string, rdr io.Reader) error {
 
 	fmt.Printf("COMMIT: %s\n", commit.String())
 	// r.PrintStatus()
-	return err
+	return r.updateSearchIndexes()
 }
 
 func (r *repository) writeFile(path string, rdr io.Reader) error {
@@ -277,67 +391,3 @@ func (r *repository) writeFile(path string, rdr io.Reader) error {
 	_, err = io.Copy(f, rdr)
 	return err
 }
-
-func (r *repository) FileIterForHead() (FileIterator, error) {
-	infos, err := r.fs.ReadDir(r.fs.Root())
-	if err != nil {
-		return nil, err
-	}
-	return &fileIter{
-		infos: infos,
-		fs:    r.fs,
-	}, nil
-}
-
-func (r *repository) FileIterForTag(name string) (FileIterator, error) {
-	err := r.CheckoutTag(name)
-	if err != nil {
-		return nil, err
-	}
-
-	infos, err := r.fs.ReadDir(r.fs.Root())
-	if err != nil {
-		return nil, err
-	}
-
-	return &fileIter{
-		infos: infos,
-		fs:    r.fs,
-	}, nil
-}
-
-type fileIter struct {
-	infos []os.FileInfo
-	fs    billy.Filesystem
-	idx   int
-}
-
-// TODO: fix this signature ... can't return reader without closing it
-func (i *fileIter) Next() (io.Reader, error) {
-	if i.idx >= len(i.infos) {
-		return nil, ErrIteratorExhausted
-	}
-
-	file, err := i.fs.Open(i.infos[i.idx].Name())
-	i.idx++
-	return file, err
-}
-
-func (i *fileIter) ForEach(f FileIteratorFunc) error {
-	for _, info := range i.infos {
-		file, err := i.fs.Open(info.Name())
-		if err != nil {
-			return err
-		}
-
-		defer func() { _ = file.Close() }()
-		err = f(file, info)
-		if err != nil {
-			if err == ErrStop {
-				return nil
-			}
-			return err
-		}
-	}
-	return nil
-}
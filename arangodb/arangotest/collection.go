@@ -0,0 +1,211 @@
+package arangotest
+
+import (
+	"context"
+	"strings"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// Collection is an in-memory implementation of driver.Collection. Only the
+// methods needed by this module are implemented, calling any other method
+// panics.
+type Collection struct {
+	driver.Collection
+
+	db   *Database
+	name string
+}
+
+// Name returns the name of the collection.
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// Database returns the database containing the collection.
+func (c *Collection) Database() driver.Database {
+	return c.db
+}
+
+// data returns the backing data of the collection. The caller has to hold
+// the database lock.
+func (c *Collection) data() (*collectionData, error) {
+	coll, ok := c.db.collections[c.name]
+	if !ok {
+		return nil, newNotFoundError(errDataSourceNotFound, "collection or view not found: "+c.name)
+	}
+	return coll, nil
+}
+
+// Count returns the number of documents in the collection.
+func (c *Collection) Count(ctx context.Context) (int64, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(coll.keys)), nil
+}
+
+// Remove removes the entire collection.
+func (c *Collection) Remove(ctx context.Context) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if _, err := c.data(); err != nil {
+		return err
+	}
+	delete(c.db.collections, c.name)
+	return nil
+}
+
+// Truncate removes all documents from the collection.
+func (c *Collection) Truncate(ctx context.Context) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil {
+		return err
+	}
+	coll.keys = nil
+	coll.docs = map[string]map[string]interface{}{}
+	return nil
+}
+
+// DocumentExists checks if a document with given key exists in the collection.
+func (c *Collection) DocumentExists(ctx context.Context, key string) (bool, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil {
+		return false, err
+	}
+	_, ok := coll.docs[key]
+	return ok, nil
+}
+
+// ReadDocument reads a single document with given key from the collection.
+func (c *Collection) ReadDocument(ctx context.Context, key string, result interface{}) (driver.DocumentMeta, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+
+	doc, ok := coll.docs[key]
+	if !ok {
+		return driver.DocumentMeta{}, newNotFoundError(errDocumentNotFound, "document not found")
+	}
+	return c.db.meta(coll, doc), fromValue(doc, result)
+}
+
+// CreateDocument creates a single document in the collection.
+func (c *Collection) CreateDocument(ctx context.Context, document interface{}) (driver.DocumentMeta, error) {
+	doc, err := toDocument(document)
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+
+	created, err := c.db.insert(coll, doc)
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+	return c.db.meta(coll, created), nil
+}
+
+// UpdateDocument updates a single document with given key in the collection.
+func (c *Collection) UpdateDocument(ctx context.Context, key string, update interface{}) (driver.DocumentMeta, error) {
+	return c.updateDocument(key, update, false)
+}
+
+// ReplaceDocument replaces a single document with given key in the collection.
+func (c *Collection) ReplaceDocument(ctx context.Context, key string, document interface{}) (driver.DocumentMeta, error) {
+	return c.updateDocument(key, document, true)
+}
+
+func (c *Collection) updateDocument(key string, update interface{}, replace bool) (driver.DocumentMeta, error) {
+	doc, err := toDocument(update)
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+
+	_, updated, err := c.db.update(coll, key, doc, replace)
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+	return c.db.meta(coll, updated), nil
+}
+
+// RemoveDocument removes a single document with given key from the collection.
+func (c *Collection) RemoveDocument(ctx context.Context, key string) (driver.DocumentMeta, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+
+	old, err := c.db.remove(coll, key)
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+	return c.db.meta(coll, old), nil
+}
+
+func toDocument(v interface{}) (map[string]interface{}, error) {
+	val, err := toValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, errDocumentTypeInvalid
+	}
+	return doc, nil
+}
+
+// EnsurePersistentIndex enforces unique indexes on top-level fields. Other
+// indexes are ignored since queries scan all documents anyway. The returned
+// index is always nil.
+func (c *Collection) EnsurePersistentIndex(ctx context.Context, fields []string, options *driver.EnsurePersistentIndexOptions) (driver.Index, bool, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	coll, err := c.data()
+	if err != nil || options == nil || !options.Unique {
+		return nil, false, err
+	}
+
+	for _, unique := range coll.unique {
+		if strings.Join(unique, "\x00") == strings.Join(fields, "\x00") {
+			return nil, false, nil
+		}
+	}
+
+	// like ArangoDB, refuse to create an index the documents violate
+	index := append([]string(nil), fields...)
+	coll.unique = append(coll.unique, index)
+	for _, key := range coll.keys {
+		err = coll.checkUnique(key, coll.docs[key])
+		if err != nil {
+			coll.unique = coll.unique[:len(coll.unique)-1]
+			return nil, false, err
+		}
+	}
+	return nil, true, nil
+}
@@ -0,0 +1,68 @@
+package arangotest
+
+import (
+	"context"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// Cursor is an in-memory implementation of driver.Cursor over the results
+// of a query.
+type Cursor struct {
+	results []interface{}
+	idx     int
+	writes  int64
+	closed  bool
+}
+
+// Close marks the cursor as closed. Reading from a closed cursor fails.
+func (c *Cursor) Close() error {
+	c.closed = true
+	return nil
+}
+
+// HasMore returns true if the next call to ReadDocument does not return a NoMoreDocuments error.
+func (c *Cursor) HasMore() bool {
+	return !c.closed && c.idx < len(c.results)
+}
+
+// ReadDocument reads the next document from the cursor.
+func (c *Cursor) ReadDocument(ctx context.Context, result interface{}) (driver.DocumentMeta, error) {
+	if !c.HasMore() {
+		return driver.DocumentMeta{}, driver.NoMoreDocumentsError{}
+	}
+
+	doc := c.results[c.idx]
+	c.idx++
+
+	var meta driver.DocumentMeta
+	if m, ok := doc.(map[string]interface{}); ok {
+		meta.Key, _ = m["_key"].(string)
+		meta.ID = driver.DocumentID(toString(m["_id"]))
+		meta.Rev, _ = m["_rev"].(string)
+	}
+	return meta, fromValue(doc, result)
+}
+
+// Count returns the total number of result documents.
+func (c *Cursor) Count() int64 {
+	return int64(len(c.results))
+}
+
+// Statistics returns the query execution statistics for this cursor.
+func (c *Cursor) Statistics() driver.QueryStatistics {
+	return statistics{writes: c.writes}
+}
+
+type statistics struct {
+	writes int64
+}
+
+func (s statistics) WritesExecuted() int64        { return s.writes }
+func (s statistics) WritesIgnored() int64         { return 0 }
+func (s statistics) ScannedFull() int64           { return 0 }
+func (s statistics) ScannedIndex() int64          { return 0 }
+func (s statistics) Filtered() int64              { return 0 }
+func (s statistics) FullCount() int64             { return 0 }
+func (s statistics) ExecutionTime() time.Duration { return 0 }
@@ -0,0 +1,285 @@
+// Package arangotest provides an in-memory stand-in for the parts of the
+// ArangoDB driver used by the arangodb package. It allows exercising the
+// storage code without a running server.
+//
+// Queries are interpreted by a small AQL engine that understands FOR, LET,
+// FILTER, SORT, LIMIT, RETURN, INSERT, UPDATE, REPLACE, REMOVE and UPSERT
+// as well as a handful of common functions. Everything else fails with an
+// error rather than silently returning wrong results.
+//
+// ArangoSearch views are supported to the extent of SEARCH with ANALYZER,
+// TOKENS and PHRASE. Scores returned by BM25 and TFIDF are plain term
+// frequencies, which is enough to rank results in tests.
+package arangotest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+var (
+	errDocumentTypeInvalid = newArangoError(http.StatusBadRequest, 1227, "invalid document type")
+	errDocumentKeyMissing  = newArangoError(http.StatusBadRequest, 1221, "illegal document key")
+)
+
+const (
+	errDataSourceNotFound = driver.ErrArangoDataSourceNotFound
+	errDocumentNotFound   = driver.ErrArangoDocumentNotFound
+	errDuplicateName      = 1207
+	errQueryParse         = 1501
+)
+
+func newArangoError(code int, errorNum int, msg string) error {
+	return driver.ArangoError{
+		HasError:     true,
+		Code:         code,
+		ErrorNum:     errorNum,
+		ErrorMessage: msg,
+	}
+}
+
+func newNotFoundError(errorNum int, msg string) error {
+	return newArangoError(http.StatusNotFound, errorNum, msg)
+}
+
+// Database is an in-memory implementation of driver.Database. Only the
+// methods needed by this module are implemented, calling any other method
+// panics.
+type Database struct {
+	driver.Database
+
+	name string
+
+	mu           sync.Mutex
+	collections  map[string]*collectionData
+	views        map[string]*viewData
+	transactions map[driver.TransactionID]*transactionData
+	counter      int64
+}
+
+type collectionData struct {
+	name string
+	keys []string
+	docs map[string]map[string]interface{}
+	// unique are the fields of the unique persistent indexes
+	unique [][]string
+}
+
+// NewDatabase returns an empty in-memory database.
+func NewDatabase(name string) *Database {
+	return &Database{
+		name:         name,
+		collections:  map[string]*collectionData{},
+		views:        map[string]*viewData{},
+		transactions: map[driver.TransactionID]*transactionData{},
+	}
+}
+
+// Name returns the name of the database.
+func (db *Database) Name() string {
+	return db.name
+}
+
+// Collection opens a connection to an existing collection within the database.
+func (db *Database) Collection(ctx context.Context, name string) (driver.Collection, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.collections[name]; !ok {
+		return nil, newNotFoundError(errDataSourceNotFound, "collection or view not found: "+name)
+	}
+
+	return &Collection{db: db, name: name}, nil
+}
+
+// CollectionExists returns true if a collection with given name exists within the database.
+func (db *Database) CollectionExists(ctx context.Context, name string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	_, ok := db.collections[name]
+	return ok, nil
+}
+
+// Collections returns a list of all collections in the database.
+func (db *Database) Collections(ctx context.Context) ([]driver.Collection, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	names := make([]string, 0, len(db.collections))
+	for name := range db.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	colls := make([]driver.Collection, len(names))
+	for i, name := range names {
+		colls[i] = &Collection{db: db, name: name}
+	}
+	return colls, nil
+}
+
+// CreateCollection creates a new collection with given name.
+func (db *Database) CreateCollection(ctx context.Context, name string, options *driver.CreateCollectionOptions) (driver.Collection, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.nameExists(name) {
+		return nil, newArangoError(http.StatusConflict, errDuplicateName, "duplicate name: "+name)
+	}
+
+	db.collections[name] = &collectionData{
+		name: name,
+		docs: map[string]map[string]interface{}{},
+	}
+	return &Collection{db: db, name: name}, nil
+}
+
+// Query parses and runs an AQL query. The returned cursor holds all
+// results in memory.
+func (db *Database) Query(ctx context.Context, query string, bindVars map[string]interface{}) (driver.Cursor, error) {
+	q, err := parse(query)
+	if err != nil {
+		return nil, newArangoError(http.StatusBadRequest, errQueryParse, err.Error())
+	}
+
+	vars := make(map[string]interface{}, len(bindVars))
+	for k, v := range bindVars {
+		vars[k], err = toValue(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	e := &executor{db: db, bindVars: vars}
+	results, err := e.run(q, frame{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cursor{
+		results: results,
+		writes:  e.writes,
+	}, nil
+}
+
+// ValidateQuery checks whether the query can be parsed by the fake.
+func (db *Database) ValidateQuery(ctx context.Context, query string) error {
+	_, err := parse(query)
+	if err != nil {
+		return newArangoError(http.StatusBadRequest, errQueryParse, err.Error())
+	}
+	return nil
+}
+
+func (db *Database) nextRevision() string {
+	db.counter++
+	return strconv.FormatInt(db.counter, 36)
+}
+
+func (db *Database) meta(coll *collectionData, doc map[string]interface{}) driver.DocumentMeta {
+	key, _ := doc["_key"].(string)
+	rev, _ := doc["_rev"].(string)
+	return driver.DocumentMeta{
+		Key: key,
+		ID:  driver.NewDocumentID(coll.name, key),
+		Rev: rev,
+	}
+}
+
+// insert stores a copy of doc in coll and returns the stored document
+// including its system attributes.
+func (db *Database) insert(coll *collectionData, doc map[string]interface{}) (map[string]interface{}, error) {
+	stored := copyValue(doc).(map[string]interface{})
+	rev := db.nextRevision()
+	key, ok := stored["_key"].(string)
+	if !ok || key == "" {
+		key = rev
+	}
+
+	if _, exists := coll.docs[key]; exists {
+		return nil, newArangoError(http.StatusConflict, driver.ErrArangoUniqueConstraintViolated, "unique constraint violated - in index primary of type primary over '_key'")
+	}
+	err := coll.checkUnique(key, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	stored["_key"] = key
+	stored["_id"] = coll.name + "/" + key
+	stored["_rev"] = rev
+	coll.keys = append(coll.keys, key)
+	coll.docs[key] = stored
+	return copyValue(stored).(map[string]interface{}), nil
+}
+
+// update merges (or replaces) the document with the given key and returns
+// the old and the new version of it.
+func (db *Database) update(coll *collectionData, key string, update map[string]interface{}, replace bool) (map[string]interface{}, map[string]interface{}, error) {
+	old, ok := coll.docs[key]
+	if !ok {
+		return nil, nil, newNotFoundError(errDocumentNotFound, "document not found")
+	}
+
+	var updated map[string]interface{}
+	if replace {
+		updated = copyValue(update).(map[string]interface{})
+	} else {
+		updated = mergeValues(old, update)
+	}
+	err := coll.checkUnique(key, updated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updated["_key"] = key
+	updated["_id"] = coll.name + "/" + key
+	updated["_rev"] = db.nextRevision()
+	coll.docs[key] = updated
+	return copyValue(old).(map[string]interface{}), copyValue(updated).(map[string]interface{}), nil
+}
+
+// remove deletes the document with the given key and returns it.
+func (db *Database) remove(coll *collectionData, key string) (map[string]interface{}, error) {
+	old, ok := coll.docs[key]
+	if !ok {
+		return nil, newNotFoundError(errDocumentNotFound, "document not found")
+	}
+
+	delete(coll.docs, key)
+	for i, k := range coll.keys {
+		if k == key {
+			coll.keys = append(coll.keys[:i], coll.keys[i+1:]...)
+			break
+		}
+	}
+	return old, nil
+}
+
+// checkUnique fails if a document other than the one with the given key has
+// the same values as doc in the fields of a unique index. Like ArangoDB's
+// non-sparse indexes, missing fields count as null.
+func (coll *collectionData) checkUnique(key string, doc map[string]interface{}) error {
+	for _, fields := range coll.unique {
+		for _, k := range coll.keys {
+			if k == key || !sameFields(coll.docs[k], doc, fields) {
+				continue
+			}
+			return newArangoError(http.StatusConflict, driver.ErrArangoUniqueConstraintViolated, "unique constraint violated - in index of type persistent over '"+strings.Join(fields, ", ")+"'")
+		}
+	}
+	return nil
+}
+
+func sameFields(a, b map[string]interface{}, fields []string) bool {
+	for _, field := range fields {
+		if !equalValues(a[field], b[field]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,286 @@
+package arangotest
+
+import (
+	"context"
+	"testing"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/stretchr/testify/assert"
+)
+
+type testDoc struct {
+	Key   string `json:"_key,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+	Age   int    `json:"age,omitempty"`
+}
+
+func readAll(t *testing.T, cursor driver.Cursor) []testDoc {
+	defer cursor.Close()
+	var docs []testDoc
+	for cursor.HasMore() {
+		var doc testDoc
+		_, err := cursor.ReadDocument(context.Background(), &doc)
+		assert.Nil(t, err)
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func TestCollections(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+
+	exists, err := db.CollectionExists(ctx, "things")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	_, err = db.Collection(ctx, "things")
+	assert.True(t, driver.IsNotFound(err))
+
+	_, err = db.CreateCollection(ctx, "things", nil)
+	assert.Nil(t, err)
+
+	_, err = db.CreateCollection(ctx, "things", nil)
+	assert.True(t, driver.IsConflict(err))
+
+	exists, err = db.CollectionExists(ctx, "things")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestDocuments(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+	coll, err := db.CreateCollection(ctx, "things", nil)
+	assert.Nil(t, err)
+
+	meta, err := coll.CreateDocument(ctx, testDoc{Key: "a", Name: "a", Value: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "a", meta.Key)
+	assert.Equal(t, driver.DocumentID("things/a"), meta.ID)
+
+	_, err = coll.CreateDocument(ctx, testDoc{Key: "a"})
+	assert.True(t, driver.IsPreconditionFailed(err))
+
+	_, err = coll.UpdateDocument(ctx, "a", map[string]interface{}{"value": "2"})
+	assert.Nil(t, err)
+
+	var doc testDoc
+	_, err = coll.ReadDocument(ctx, "a", &doc)
+	assert.Nil(t, err)
+	assert.Equal(t, testDoc{Key: "a", Name: "a", Value: "2"}, doc)
+
+	_, err = coll.RemoveDocument(ctx, "a")
+	assert.Nil(t, err)
+
+	_, err = coll.ReadDocument(ctx, "a", &doc)
+	assert.True(t, driver.IsNotFound(err))
+}
+
+func TestUpsertFilterRemove(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+	_, err := db.CreateCollection(ctx, "refs", nil)
+	assert.Nil(t, err)
+
+	upsert := "UPSERT { name: @name } INSERT { name: @name, value: @value } UPDATE { value: @value } IN refs"
+	for _, kv := range [][]string{{"a", "1"}, {"b", "2"}, {"a", "3"}} {
+		_, err = db.Query(ctx, upsert, map[string]interface{}{"name": kv[0], "value": kv[1]})
+		assert.Nil(t, err)
+	}
+
+	cursor, err := db.Query(ctx, "FOR r IN refs FILTER r.name == @name RETURN r", map[string]interface{}{"name": "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cursor.Count())
+	docs := readAll(t, cursor)
+	assert.Equal(t, 1, len(docs))
+	assert.Equal(t, "3", docs[0].Value)
+
+	_, err = db.Query(ctx, "FOR r IN refs FILTER r.name == @name REMOVE { _key: r._key } IN refs", map[string]interface{}{"name": "a"})
+	assert.Nil(t, err)
+
+	cursor, err = db.Query(ctx, "FOR r IN refs RETURN r", nil)
+	assert.Nil(t, err)
+	docs = readAll(t, cursor)
+	assert.Equal(t, 1, len(docs))
+	assert.Equal(t, "b", docs[0].Name)
+}
+
+func TestUniqueIndex(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+	coll, err := db.CreateCollection(ctx, "things", nil)
+	assert.Nil(t, err)
+
+	_, err = coll.CreateDocument(ctx, testDoc{Key: "a", Name: "x"})
+	assert.Nil(t, err)
+	_, err = coll.CreateDocument(ctx, testDoc{Key: "b", Name: "x"})
+	assert.Nil(t, err)
+
+	// the existing documents violate the index
+	_, _, err = coll.EnsurePersistentIndex(ctx, []string{"name"}, &driver.EnsurePersistentIndexOptions{Unique: true})
+	assert.True(t, driver.IsConflict(err))
+
+	_, err = coll.RemoveDocument(ctx, "b")
+	assert.Nil(t, err)
+	_, created, err := coll.EnsurePersistentIndex(ctx, []string{"name"}, &driver.EnsurePersistentIndexOptions{Unique: true})
+	assert.Nil(t, err)
+	assert.True(t, created)
+
+	_, err = coll.CreateDocument(ctx, testDoc{Key: "c", Name: "x"})
+	assert.True(t, driver.IsConflict(err))
+	_, err = db.Query(ctx, "UPSERT { _key: 'd' } INSERT { _key: 'd', name: 'x' } UPDATE {} IN things", nil)
+	assert.True(t, driver.IsConflict(err))
+
+	// updating the document itself doesn't conflict, moving another one
+	// onto its values does
+	_, err = coll.UpdateDocument(ctx, "a", map[string]interface{}{"value": "1"})
+	assert.Nil(t, err)
+	_, err = coll.CreateDocument(ctx, testDoc{Key: "e", Name: "y"})
+	assert.Nil(t, err)
+	_, err = db.Query(ctx, "UPDATE 'e' WITH { name: 'x' } IN things", nil)
+	assert.True(t, driver.IsConflict(err))
+}
+
+func TestSortLimitAndFunctions(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+	coll, err := db.CreateCollection(ctx, "people", nil)
+	assert.Nil(t, err)
+
+	for i, name := range []string{"carol", "alice", "bob", "dave"} {
+		_, err = coll.CreateDocument(ctx, testDoc{Name: name, Age: 20 + i})
+		assert.Nil(t, err)
+	}
+
+	query := "FOR p IN people FILTER p.age > @age && LIKE(p.name, '%a%') SORT p.name DESC LIMIT 0, 2 RETURN p"
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"age": 20})
+	assert.Nil(t, err)
+	docs := readAll(t, cursor)
+	assert.Equal(t, 2, len(docs))
+	assert.Equal(t, "dave", docs[0].Name)
+	assert.Equal(t, "alice", docs[1].Name)
+
+	cursor, err = db.Query(ctx, "FOR p IN @@coll FILTER p.name IN @names RETURN { name: UPPER(p.name) }", map[string]interface{}{
+		"@coll": "people",
+		"names": []string{"bob", "dave"},
+	})
+	assert.Nil(t, err)
+	docs = readAll(t, cursor)
+	assert.Equal(t, []testDoc{{Name: "BOB"}, {Name: "DAVE"}}, docs)
+}
+
+func TestQueryErrors(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+
+	_, err := db.Query(ctx, "FOR d IN missing RETURN d", nil)
+	assert.True(t, driver.IsNotFound(err))
+
+	_, err = db.Query(ctx, "FOR d IN RETURN", nil)
+	assert.True(t, driver.IsArangoErrorWithErrorNum(err, errQueryParse))
+
+	_, err = db.Query(ctx, "RETURN NO_SUCH_FUNCTION()", nil)
+	assert.NotNil(t, err)
+
+	cursor, err := db.Query(ctx, "RETURN 1", nil)
+	assert.Nil(t, err)
+	var one int
+	_, err = cursor.ReadDocument(ctx, &one)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, one)
+	_, err = cursor.ReadDocument(ctx, &one)
+	assert.True(t, driver.IsNoMoreDocuments(err))
+}
+
+func TestSearchView(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+	coll, err := db.CreateCollection(ctx, "docs", nil)
+	assert.Nil(t, err)
+
+	for _, v := range []string{"The quick brown fox", "A lazy dog", "Quick, quick!"} {
+		_, err = coll.CreateDocument(ctx, testDoc{Value: v})
+		assert.Nil(t, err)
+	}
+
+	_, err = db.CreateArangoSearchView(ctx, "docs_view", &driver.ArangoSearchViewProperties{
+		Links: driver.ArangoSearchLinks{
+			"docs": driver.ArangoSearchElementProperties{
+				Fields: driver.ArangoSearchFields{
+					"value": driver.ArangoSearchElementProperties{Analyzers: []string{"text_en"}},
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	_, err = db.CreateCollection(ctx, "docs_view", nil)
+	assert.True(t, driver.IsConflict(err))
+
+	query := "FOR d IN @@view SEARCH ANALYZER(d.value IN TOKENS(@terms, 'text_en'), 'text_en') SORT BM25(d) DESC RETURN d"
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"@view": "docs_view", "terms": "QUICK"})
+	assert.Nil(t, err)
+	docs := readAll(t, cursor)
+	assert.Equal(t, 2, len(docs))
+	assert.Equal(t, "Quick, quick!", docs[0].Value)
+
+	query = "FOR d IN docs_view SEARCH PHRASE(d.value, 'lazy dog', 'text_en') RETURN d"
+	cursor, err = db.Query(ctx, query, nil)
+	assert.Nil(t, err)
+	docs = readAll(t, cursor)
+	assert.Equal(t, 1, len(docs))
+	assert.Equal(t, "A lazy dog", docs[0].Value)
+
+	_, err = db.Query(ctx, "FOR d IN docs_view SEARCH ANALYZER(d.value == 'x', 'nope') RETURN d", nil)
+	assert.NotNil(t, err)
+}
+
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase("test")
+	coll, err := db.CreateCollection(ctx, "things", nil)
+	assert.Nil(t, err)
+
+	_, err = coll.CreateDocument(ctx, testDoc{Key: "a", Value: "1"})
+	assert.Nil(t, err)
+
+	_, err = db.BeginTransaction(ctx, driver.TransactionCollections{Write: []string{"missing"}}, nil)
+	assert.True(t, driver.IsNotFound(err))
+
+	tid, err := db.BeginTransaction(ctx, driver.TransactionCollections{Write: []string{"things"}}, nil)
+	assert.Nil(t, err)
+
+	_, err = coll.CreateDocument(driver.WithTransactionID(ctx, tid), testDoc{Key: "b"})
+	assert.Nil(t, err)
+	_, err = coll.UpdateDocument(driver.WithTransactionID(ctx, tid), "a", testDoc{Value: "2"})
+	assert.Nil(t, err)
+
+	err = db.AbortTransaction(ctx, tid, nil)
+	assert.Nil(t, err)
+
+	status, err := db.TransactionStatus(ctx, tid)
+	assert.Nil(t, err)
+	assert.Equal(t, driver.TransactionAborted, status.Status)
+
+	err = db.CommitTransaction(ctx, tid, nil)
+	assert.NotNil(t, err)
+
+	cursor, err := db.Query(ctx, "FOR d IN things RETURN d", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []testDoc{{Key: "a", Value: "1"}}, readAll(t, cursor))
+
+	tid, err = db.BeginTransaction(ctx, driver.TransactionCollections{Write: []string{"things"}}, nil)
+	assert.Nil(t, err)
+
+	_, err = coll.CreateDocument(driver.WithTransactionID(ctx, tid), testDoc{Key: "b"})
+	assert.Nil(t, err)
+
+	err = db.CommitTransaction(ctx, tid, nil)
+	assert.Nil(t, err)
+
+	count, err := coll.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -0,0 +1,641 @@
+package arangotest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// frame holds the variables visible to an expression. Frames are never
+// modified once created, with returns an extended copy instead.
+type frame map[string]interface{}
+
+func (f frame) with(name string, value interface{}) frame {
+	nf := make(frame, len(f)+1)
+	for k, v := range f {
+		nf[k] = v
+	}
+	nf[name] = value
+	return nf
+}
+
+// executor runs a parsed query against a database. The caller has to hold
+// the database lock for the duration of run.
+type executor struct {
+	db       *Database
+	bindVars map[string]interface{}
+	writes   int64
+}
+
+func (e *executor) run(q *query, outer frame) ([]interface{}, error) {
+	frames := []frame{outer}
+	for _, op := range q.ops {
+		var err error
+		switch o := op.(type) {
+		case forOp:
+			frames, err = e.runFor(o, frames)
+		case letOp:
+			frames, err = e.runLet(o, frames)
+		case filterOp:
+			frames, err = e.runFilter(o, frames)
+		case sortOp:
+			frames, err = e.runSort(o, frames)
+		case limitOp:
+			frames, err = e.runLimit(o, frames)
+		case returnOp:
+			return e.runReturn(o, frames)
+		case insertOp:
+			frames, err = e.runInsert(o, frames)
+		case updateOp:
+			frames, err = e.runUpdate(o, frames)
+		case removeOp:
+			frames, err = e.runRemove(o, frames)
+		case upsertOp:
+			frames, err = e.runUpsert(o, frames)
+		default:
+			err = fmt.Errorf("unsupported operation %T", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []interface{}{}, nil
+}
+
+func (e *executor) runFor(o forOp, frames []frame) ([]frame, error) {
+	var out []frame
+	for _, f := range frames {
+		var src interface{}
+		var err error
+		if ref, ok := o.src.(collectionRef); ok {
+			src, err = e.collectionDocuments(ref)
+		} else {
+			src, err = e.eval(o.src, f)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch x := src.(type) {
+		case nil:
+		case []interface{}:
+			for _, v := range x {
+				nf := f.with(o.variable, v)
+				if o.search != nil {
+					match, score, err := e.search(o.search, nf, "identity")
+					if err != nil {
+						return nil, err
+					} else if !match {
+						continue
+					}
+					nf = nf.with(scoreVariable(o.variable), score)
+				}
+				out = append(out, nf)
+			}
+		default:
+			return nil, fmt.Errorf("can't iterate over %T", src)
+		}
+	}
+	return out, nil
+}
+
+func (e *executor) runLet(o letOp, frames []frame) ([]frame, error) {
+	out := make([]frame, 0, len(frames))
+	for _, f := range frames {
+		v, err := e.eval(o.value, f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f.with(o.variable, v))
+	}
+	return out, nil
+}
+
+func (e *executor) runFilter(o filterOp, frames []frame) ([]frame, error) {
+	var out []frame
+	for _, f := range frames {
+		v, err := e.eval(o.cond, f)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(v) {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func (e *executor) runSort(o sortOp, frames []frame) ([]frame, error) {
+	keys := make([][]interface{}, len(frames))
+	for i, f := range frames {
+		for _, k := range o.keys {
+			v, err := e.eval(k.value, f)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = append(keys[i], v)
+		}
+	}
+
+	idx := make([]int, len(frames))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		for k, key := range o.keys {
+			c := compareValues(keys[idx[a]][k], keys[idx[b]][k])
+			if key.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	out := make([]frame, len(frames))
+	for i, j := range idx {
+		out[i] = frames[j]
+	}
+	return out, nil
+}
+
+func (e *executor) runLimit(o limitOp, frames []frame) ([]frame, error) {
+	offset := 0
+	if o.offset != nil {
+		v, err := e.eval(o.offset, frame{})
+		if err != nil {
+			return nil, err
+		}
+		offset = int(toNumber(v))
+	}
+
+	v, err := e.eval(o.count, frame{})
+	if err != nil {
+		return nil, err
+	}
+	count := int(toNumber(v))
+
+	if offset > len(frames) {
+		offset = len(frames)
+	}
+	end := offset + count
+	if end > len(frames) {
+		end = len(frames)
+	}
+	return frames[offset:end], nil
+}
+
+func (e *executor) runReturn(o returnOp, frames []frame) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(frames))
+	for _, f := range frames {
+		v, err := e.eval(o.value, f)
+		if err != nil {
+			return nil, err
+		}
+
+		if o.distinct && containsValue(out, v) {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (e *executor) runInsert(o insertOp, frames []frame) ([]frame, error) {
+	coll, err := e.collection(o.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]frame, 0, len(frames))
+	for _, f := range frames {
+		v, err := e.eval(o.doc, f)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errDocumentTypeInvalid
+		}
+
+		created, err := e.db.insert(coll, doc)
+		if err != nil {
+			return nil, err
+		}
+		e.writes++
+		out = append(out, f.with("NEW", created))
+	}
+	return out, nil
+}
+
+func (e *executor) runUpdate(o updateOp, frames []frame) ([]frame, error) {
+	coll, err := e.collection(o.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]frame, 0, len(frames))
+	for _, f := range frames {
+		k, err := e.eval(o.key, f)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := documentKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		with := k
+		if o.with != nil {
+			with, err = e.eval(o.with, f)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		update, ok := with.(map[string]interface{})
+		if !ok {
+			return nil, errDocumentTypeInvalid
+		}
+
+		old, updated, err := e.db.update(coll, key, update, o.replace)
+		if err != nil {
+			return nil, err
+		}
+		e.writes++
+		out = append(out, f.with("OLD", old).with("NEW", updated))
+	}
+	return out, nil
+}
+
+func (e *executor) runRemove(o removeOp, frames []frame) ([]frame, error) {
+	coll, err := e.collection(o.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]frame, 0, len(frames))
+	for _, f := range frames {
+		k, err := e.eval(o.key, f)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := documentKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		old, err := e.db.remove(coll, key)
+		if err != nil {
+			return nil, err
+		}
+		e.writes++
+		out = append(out, f.with("OLD", old))
+	}
+	return out, nil
+}
+
+func (e *executor) runUpsert(o upsertOp, frames []frame) ([]frame, error) {
+	coll, err := e.collection(o.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]frame, 0, len(frames))
+	for _, f := range frames {
+		v, err := e.eval(o.search, f)
+		if err != nil {
+			return nil, err
+		}
+
+		example, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errDocumentTypeInvalid
+		}
+
+		var found map[string]interface{}
+		for _, key := range coll.keys {
+			if doc := coll.docs[key]; matchesExample(doc, example) {
+				found = doc
+				break
+			}
+		}
+
+		if found == nil {
+			v, err = e.eval(o.insert, f)
+			if err != nil {
+				return nil, err
+			}
+
+			doc, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errDocumentTypeInvalid
+			}
+
+			created, err := e.db.insert(coll, doc)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, f.with("OLD", nil).with("NEW", created))
+		} else {
+			old := copyValue(found)
+			v, err = e.eval(o.update, f.with("OLD", old))
+			if err != nil {
+				return nil, err
+			}
+
+			update, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errDocumentTypeInvalid
+			}
+
+			_, updated, err := e.db.update(coll, found["_key"].(string), update, o.replace)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, f.with("OLD", old).with("NEW", updated))
+		}
+		e.writes++
+	}
+	return out, nil
+}
+
+func documentKey(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case map[string]interface{}:
+		if key, ok := x["_key"].(string); ok {
+			return key, nil
+		}
+	}
+	return "", errDocumentKeyMissing
+}
+
+func (e *executor) collection(ref collectionRef) (*collectionData, error) {
+	name := ref.name
+	if ref.bind != "" {
+		v, ok := e.bindVars["@"+ref.bind]
+		if !ok {
+			return nil, fmt.Errorf("bind parameter '@%s' not set", ref.bind)
+		}
+		name, _ = v.(string)
+	}
+
+	coll, ok := e.db.collections[name]
+	if !ok {
+		return nil, newNotFoundError(errDataSourceNotFound, "collection or view not found: "+name)
+	}
+	return coll, nil
+}
+
+// collectionDocuments returns the documents of a collection or, if ref
+// names a view, the documents of all collections linked to it.
+func (e *executor) collectionDocuments(ref collectionRef) ([]interface{}, error) {
+	name := ref.name
+	if ref.bind != "" {
+		name, _ = e.bindVars["@"+ref.bind].(string)
+	}
+	if view, ok := e.db.views[name]; ok {
+		return e.db.viewDocuments(view), nil
+	}
+
+	coll, err := e.collection(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]interface{}, 0, len(coll.keys))
+	for _, key := range coll.keys {
+		docs = append(docs, copyValue(coll.docs[key]))
+	}
+	return docs, nil
+}
+
+func (e *executor) eval(x expr, f frame) (interface{}, error) {
+	switch n := x.(type) {
+	case literalExpr:
+		return n.value, nil
+	case bindExpr:
+		v, ok := e.bindVars[n.name]
+		if !ok {
+			return nil, fmt.Errorf("bind parameter '%s' not set", n.name)
+		}
+		return v, nil
+	case varExpr:
+		if v, ok := f[n.name]; ok {
+			return v, nil
+		}
+		return e.collectionDocuments(collectionRef{name: n.name})
+	case attrExpr:
+		obj, err := e.eval(n.obj, f)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := obj.(map[string]interface{}); ok {
+			return m[n.name], nil
+		}
+		return nil, nil
+	case indexExpr:
+		return e.evalIndex(n, f)
+	case unaryExpr:
+		v, err := e.eval(n.x, f)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "-" {
+			return -toNumber(v), nil
+		}
+		return !truthy(v), nil
+	case binaryExpr:
+		return e.evalBinary(n, f)
+	case ternaryExpr:
+		cond, err := e.eval(n.cond, f)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return e.eval(n.then, f)
+		}
+		return e.eval(n.els, f)
+	case objectExpr:
+		obj := make(map[string]interface{}, len(n.keys))
+		for i, k := range n.keys {
+			v, err := e.eval(n.values[i], f)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = v
+		}
+		return obj, nil
+	case arrayExpr:
+		arr := make([]interface{}, 0, len(n.elems))
+		for _, elem := range n.elems {
+			v, err := e.eval(elem, f)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case callExpr:
+		if score, ok := scoreOf(n, f); ok {
+			return score, nil
+		}
+
+		args := make([]interface{}, 0, len(n.args))
+		for _, arg := range n.args {
+			v, err := e.eval(arg, f)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+		return callFunction(n.name, args)
+	case subqueryExpr:
+		return e.run(n.q, f)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", x)
+}
+
+func (e *executor) evalIndex(n indexExpr, f frame) (interface{}, error) {
+	obj, err := e.eval(n.obj, f)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := e.eval(n.idx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		if k, ok := idx.(string); ok {
+			return o[k], nil
+		}
+	case []interface{}:
+		i := int(toNumber(idx))
+		if i < 0 {
+			i += len(o)
+		}
+		if i >= 0 && i < len(o) {
+			return o[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (e *executor) evalBinary(n binaryExpr, f frame) (interface{}, error) {
+	l, err := e.eval(n.l, f)
+	if err != nil {
+		return nil, err
+	}
+
+	// logical operators short-circuit and return one of their operands
+	switch n.op {
+	case "&&":
+		if !truthy(l) {
+			return l, nil
+		}
+		return e.eval(n.r, f)
+	case "||":
+		if truthy(l) {
+			return l, nil
+		}
+		return e.eval(n.r, f)
+	}
+
+	r, err := e.eval(n.r, f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equalValues(l, r), nil
+	case "!=":
+		return !equalValues(l, r), nil
+	case "<":
+		return compareValues(l, r) < 0, nil
+	case "<=":
+		return compareValues(l, r) <= 0, nil
+	case ">":
+		return compareValues(l, r) > 0, nil
+	case ">=":
+		return compareValues(l, r) >= 0, nil
+	case "IN":
+		arr, _ := r.([]interface{})
+		return containsValue(arr, l), nil
+	case "NOT IN":
+		arr, _ := r.([]interface{})
+		return !containsValue(arr, l), nil
+	case "LIKE":
+		return like(toString(l), toString(r), false)
+	case "+":
+		return toNumber(l) + toNumber(r), nil
+	case "-":
+		return toNumber(l) - toNumber(r), nil
+	case "*":
+		return toNumber(l) * toNumber(r), nil
+	case "/":
+		d := toNumber(r)
+		if d == 0 {
+			return nil, nil
+		}
+		return toNumber(l) / d, nil
+	case "%":
+		d := int64(toNumber(r))
+		if d == 0 {
+			return nil, nil
+		}
+		return float64(int64(toNumber(l)) % d), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.op)
+}
+
+func containsValue(arr []interface{}, v interface{}) bool {
+	for _, e := range arr {
+		if equalValues(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func like(s, pattern string, caseInsensitive bool) (bool, error) {
+	var sb strings.Builder
+	if caseInsensitive {
+		sb.WriteString("(?i)")
+	}
+	sb.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			sb.WriteString("(?s:.*)")
+		case r == '_':
+			sb.WriteString("(?s:.)")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
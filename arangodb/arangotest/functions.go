@@ -0,0 +1,434 @@
+package arangotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type function func(args []interface{}) (interface{}, error)
+
+// functions holds the AQL functions known to the fake. Names are upper case.
+var functions = map[string]function{
+	"LENGTH":      fnLength,
+	"COUNT":       fnLength,
+	"CONCAT":      fnConcat,
+	"LOWER":       stringFunction(strings.ToLower),
+	"UPPER":       stringFunction(strings.ToUpper),
+	"TRIM":        stringFunction(strings.TrimSpace),
+	"TO_STRING":   fnToString,
+	"TO_NUMBER":   fnToNumber,
+	"TO_BOOL":     fnToBool,
+	"CONTAINS":    fnContains,
+	"STARTS_WITH": fnStartsWith,
+	"SUBSTRING":   fnSubstring,
+	"SPLIT":       fnSplit,
+	"LIKE":        fnLike,
+	"HAS":         fnHas,
+	"MERGE":       fnMerge,
+	"UNSET":       fnUnset,
+	"KEEP":        fnKeep,
+	"ATTRIBUTES":  fnAttributes,
+	"VALUES":      fnValues,
+	"FIRST":       fnFirst,
+	"LAST":        fnLast,
+	"POSITION":    fnPosition,
+	"UNIQUE":      fnUnique,
+	"APPEND":      fnAppend,
+	"PUSH":        fnPush,
+	"FLATTEN":     fnFlatten,
+	"MIN":         fnMin,
+	"MAX":         fnMax,
+	"SUM":         fnSum,
+	"NOT_NULL":    fnNotNull,
+	"IS_NULL":     fnIsNull,
+	"IS_STRING":   fnIsString,
+	"IS_ARRAY":    fnIsArray,
+	"IS_OBJECT":   fnIsObject,
+	"TOKENS":      fnTokens,
+}
+
+func callFunction(name string, args []interface{}) (interface{}, error) {
+	fn, ok := functions[strings.ToUpper(name)]
+	if !ok {
+		return nil, fmt.Errorf("usage of unknown function '%s()'", name)
+	}
+	return fn(args)
+}
+
+func arg(args []interface{}, i int) interface{} {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	bites, _ := json.Marshal(v)
+	return string(bites)
+}
+
+func stringFunction(f func(string) string) function {
+	return func(args []interface{}) (interface{}, error) {
+		return f(toString(arg(args, 0))), nil
+	}
+}
+
+func fnLength(args []interface{}) (interface{}, error) {
+	switch x := arg(args, 0).(type) {
+	case nil:
+		return 0.0, nil
+	case string:
+		return float64(len([]rune(x))), nil
+	case []interface{}:
+		return float64(len(x)), nil
+	case map[string]interface{}:
+		return float64(len(x)), nil
+	case bool:
+		if x {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	}
+	return float64(len(toString(arg(args, 0)))), nil
+}
+
+func fnConcat(args []interface{}) (interface{}, error) {
+	var sb strings.Builder
+	for _, a := range args {
+		if arr, ok := a.([]interface{}); ok && len(args) == 1 {
+			for _, e := range arr {
+				sb.WriteString(toString(e))
+			}
+			continue
+		}
+		sb.WriteString(toString(a))
+	}
+	return sb.String(), nil
+}
+
+func fnToString(args []interface{}) (interface{}, error) {
+	return toString(arg(args, 0)), nil
+}
+
+func fnToNumber(args []interface{}) (interface{}, error) {
+	return toNumber(arg(args, 0)), nil
+}
+
+func fnToBool(args []interface{}) (interface{}, error) {
+	return truthy(arg(args, 0)), nil
+}
+
+func fnContains(args []interface{}) (interface{}, error) {
+	s, search := toString(arg(args, 0)), toString(arg(args, 1))
+	if !truthy(arg(args, 2)) {
+		return strings.Contains(s, search), nil
+	}
+
+	idx := strings.Index(s, search)
+	if idx < 0 {
+		return -1.0, nil
+	}
+	return float64(len([]rune(s[:idx]))), nil
+}
+
+func fnStartsWith(args []interface{}) (interface{}, error) {
+	return strings.HasPrefix(toString(arg(args, 0)), toString(arg(args, 1))), nil
+}
+
+func fnSubstring(args []interface{}) (interface{}, error) {
+	rs := []rune(toString(arg(args, 0)))
+	offset := int(toNumber(arg(args, 1)))
+	if offset < 0 {
+		offset += len(rs)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(rs) {
+		offset = len(rs)
+	}
+
+	end := len(rs)
+	if len(args) > 2 && args[2] != nil {
+		end = offset + int(toNumber(args[2]))
+		if end > len(rs) {
+			end = len(rs)
+		}
+		if end < offset {
+			end = offset
+		}
+	}
+	return string(rs[offset:end]), nil
+}
+
+func fnSplit(args []interface{}) (interface{}, error) {
+	parts := strings.Split(toString(arg(args, 0)), toString(arg(args, 1)))
+	out := make([]interface{}, len(parts))
+	for i, p := range parts {
+		out[i] = p
+	}
+	return out, nil
+}
+
+func fnLike(args []interface{}) (interface{}, error) {
+	return like(toString(arg(args, 0)), toString(arg(args, 1)), truthy(arg(args, 2)))
+}
+
+func fnHas(args []interface{}) (interface{}, error) {
+	m, ok := arg(args, 0).(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+	_, ok = m[toString(arg(args, 1))]
+	return ok, nil
+}
+
+func fnMerge(args []interface{}) (interface{}, error) {
+	if arr, ok := arg(args, 0).([]interface{}); ok && len(args) == 1 {
+		args = arr
+	}
+
+	merged := map[string]interface{}{}
+	for _, a := range args {
+		m, ok := a.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid argument type in call to function 'MERGE()'")
+		}
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
+
+func attributeNames(args []interface{}) map[string]bool {
+	names := map[string]bool{}
+	for _, a := range args {
+		if arr, ok := a.([]interface{}); ok {
+			for _, e := range arr {
+				names[toString(e)] = true
+			}
+			continue
+		}
+		names[toString(a)] = true
+	}
+	return names
+}
+
+func fnUnset(args []interface{}) (interface{}, error) {
+	m, ok := arg(args, 0).(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	names := attributeNames(args[1:])
+	out := map[string]interface{}{}
+	for k, v := range m {
+		if !names[k] {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+func fnKeep(args []interface{}) (interface{}, error) {
+	m, ok := arg(args, 0).(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	names := attributeNames(args[1:])
+	out := map[string]interface{}{}
+	for k, v := range m {
+		if names[k] {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func fnAttributes(args []interface{}) (interface{}, error) {
+	m, _ := arg(args, 0).(map[string]interface{})
+	removeSystem := truthy(arg(args, 1))
+	out := []interface{}{}
+	for _, k := range sortedKeys(m) {
+		if removeSystem && strings.HasPrefix(k, "_") {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func fnValues(args []interface{}) (interface{}, error) {
+	m, _ := arg(args, 0).(map[string]interface{})
+	removeSystem := truthy(arg(args, 1))
+	out := []interface{}{}
+	for _, k := range sortedKeys(m) {
+		if removeSystem && strings.HasPrefix(k, "_") {
+			continue
+		}
+		out = append(out, m[k])
+	}
+	return out, nil
+}
+
+func fnFirst(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	if len(arr) == 0 {
+		return nil, nil
+	}
+	return arr[0], nil
+}
+
+func fnLast(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	if len(arr) == 0 {
+		return nil, nil
+	}
+	return arr[len(arr)-1], nil
+}
+
+func fnPosition(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	return containsValue(arr, arg(args, 1)), nil
+}
+
+func fnUnique(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	out := []interface{}{}
+	for _, v := range arr {
+		if !containsValue(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func fnAppend(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	out := append([]interface{}{}, arr...)
+	if more, ok := arg(args, 1).([]interface{}); ok {
+		out = append(out, more...)
+	} else {
+		out = append(out, arg(args, 1))
+	}
+	return out, nil
+}
+
+func fnPush(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	return append(append([]interface{}{}, arr...), arg(args, 1)), nil
+}
+
+func fnFlatten(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	out := []interface{}{}
+	for _, v := range arr {
+		if inner, ok := v.([]interface{}); ok {
+			out = append(out, inner...)
+		} else {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func fnMin(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	var out interface{}
+	for _, v := range arr {
+		if v != nil && (out == nil || compareValues(v, out) < 0) {
+			out = v
+		}
+	}
+	return out, nil
+}
+
+func fnMax(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	var out interface{}
+	for _, v := range arr {
+		if v != nil && (out == nil || compareValues(v, out) > 0) {
+			out = v
+		}
+	}
+	return out, nil
+}
+
+func fnSum(args []interface{}) (interface{}, error) {
+	arr, _ := arg(args, 0).([]interface{})
+	sum := 0.0
+	for _, v := range arr {
+		sum += toNumber(v)
+	}
+	return sum, nil
+}
+
+func fnNotNull(args []interface{}) (interface{}, error) {
+	for _, a := range args {
+		if a != nil {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+func fnIsNull(args []interface{}) (interface{}, error) {
+	return arg(args, 0) == nil, nil
+}
+
+func fnIsString(args []interface{}) (interface{}, error) {
+	_, ok := arg(args, 0).(string)
+	return ok, nil
+}
+
+func fnIsArray(args []interface{}) (interface{}, error) {
+	_, ok := arg(args, 0).([]interface{})
+	return ok, nil
+}
+
+func fnIsObject(args []interface{}) (interface{}, error) {
+	_, ok := arg(args, 0).(map[string]interface{})
+	return ok, nil
+}
+
+func fnTokens(args []interface{}) (interface{}, error) {
+	analyzer := "identity"
+	if len(args) > 1 {
+		analyzer = toString(args[1])
+	}
+
+	tokens, err := analyze(toString(arg(args, 0)), analyzer)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]interface{}, len(tokens))
+	for i, t := range tokens {
+		out[i] = t
+	}
+	return out, nil
+}
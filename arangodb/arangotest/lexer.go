@@ -0,0 +1,204 @@
+package arangotest
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokBind
+	tokCollectionBind
+	tokString
+	tokNumber
+	tokOp
+)
+
+var keywords = map[string]bool{
+	"FOR":      true,
+	"IN":       true,
+	"INTO":     true,
+	"FILTER":   true,
+	"SEARCH":   true,
+	"RETURN":   true,
+	"DISTINCT": true,
+	"LET":      true,
+	"SORT":     true,
+	"ASC":      true,
+	"DESC":     true,
+	"LIMIT":    true,
+	"UPSERT":   true,
+	"INSERT":   true,
+	"UPDATE":   true,
+	"REPLACE":  true,
+	"REMOVE":   true,
+	"WITH":     true,
+	"AND":      true,
+	"OR":       true,
+	"NOT":      true,
+	"LIKE":     true,
+	"TRUE":     true,
+	"FALSE":    true,
+	"NULL":     true,
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q at %d", t.text, t.pos)
+}
+
+// lex splits an AQL query into tokens. Keywords are upper-cased so that the
+// parser doesn't need to care about the spelling used in the query.
+func lex(query string) ([]token, error) {
+	var tokens []token
+	rs := []rune(query)
+	i := 0
+	for i < len(rs) {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			end := strings.Index(string(rs[i+2:]), "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment at %d", i)
+			}
+			i += len([]rune(string(rs[i+2:])[:end])) + 4
+		case r == '@':
+			kind := tokBind
+			start := i
+			i++
+			if i < len(rs) && rs[i] == '@' {
+				kind = tokCollectionBind
+				i++
+			}
+			nameStart := i
+			for i < len(rs) && isIdentRune(rs[i]) {
+				i++
+			}
+			if nameStart == i {
+				return nil, fmt.Errorf("invalid bind parameter at %d", start)
+			}
+			tokens = append(tokens, token{kind: kind, text: string(rs[nameStart:i]), pos: start})
+		case r == '"' || r == '\'':
+			s, n, err := lexString(rs[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s at %d", err.Error(), i)
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, pos: i})
+			i += n
+		case r == '`':
+			end := strings.IndexRune(string(rs[i+1:]), '`')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated name at %d", i)
+			}
+			name := string(rs[i+1:])[:end]
+			tokens = append(tokens, token{kind: tokIdent, text: name, pos: i})
+			i += len([]rune(name)) + 2
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.' || rs[i] == 'e' || rs[i] == 'E' ||
+				((rs[i] == '+' || rs[i] == '-') && (rs[i-1] == 'e' || rs[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(rs[start:i]), pos: start})
+		case isIdentRune(r):
+			start := i
+			for i < len(rs) && isIdentRune(rs[i]) {
+				i++
+			}
+			text := string(rs[start:i])
+			if keywords[strings.ToUpper(text)] {
+				tokens = append(tokens, token{kind: tokKeyword, text: strings.ToUpper(text), pos: start})
+			} else {
+				tokens = append(tokens, token{kind: tokIdent, text: text, pos: start})
+			}
+		default:
+			op := lexOperator(rs[i:])
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", r, i)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(rs)}), nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func lexString(rs []rune) (string, int, error) {
+	quote := rs[0]
+	var sb strings.Builder
+	for i := 1; i < len(rs); i++ {
+		switch rs[i] {
+		case quote:
+			return sb.String(), i + 1, nil
+		case '\\':
+			i++
+			if i >= len(rs) {
+				break
+			}
+			switch rs[i] {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			default:
+				sb.WriteRune(rs[i])
+			}
+		default:
+			sb.WriteRune(rs[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"<", ">", "!", "=", "+", "-", "*", "/", "%",
+	".", ",", ":", "?", "(", ")", "[", "]", "{", "}",
+}
+
+func lexOperator(rs []rune) string {
+	s := string(rs[:min(2, len(rs))])
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
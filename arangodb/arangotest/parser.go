@@ -0,0 +1,794 @@
+package arangotest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The AST below covers the part of AQL that the arangodb package (and code
+// built on top of it) issues: FOR loops over collections and arrays, LET,
+// FILTER, SORT, LIMIT, RETURN and the data modification operations.
+
+type expr interface{}
+
+type literalExpr struct{ value interface{} }
+type bindExpr struct{ name string }
+type varExpr struct{ name string }
+type attrExpr struct {
+	obj  expr
+	name string
+}
+type indexExpr struct {
+	obj expr
+	idx expr
+}
+type unaryExpr struct {
+	op string
+	x  expr
+}
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+type ternaryExpr struct {
+	cond, then, els expr
+}
+type objectExpr struct {
+	keys   []string
+	values []expr
+}
+type arrayExpr struct{ elems []expr }
+type callExpr struct {
+	name string
+	args []expr
+}
+
+// subqueryExpr is a parenthesized query used as an expression.
+type subqueryExpr struct{ q *query }
+
+type operation interface{}
+
+type forOp struct {
+	variable string
+	src      expr
+	search   expr
+}
+type letOp struct {
+	variable string
+	value    expr
+}
+type filterOp struct{ cond expr }
+type sortKey struct {
+	value expr
+	desc  bool
+}
+type sortOp struct{ keys []sortKey }
+type limitOp struct{ offset, count expr }
+type returnOp struct {
+	distinct bool
+	value    expr
+}
+
+// collectionRef is either a literal collection name or a @@ bind parameter.
+type collectionRef struct {
+	name string
+	bind string
+}
+
+type insertOp struct {
+	doc  expr
+	coll collectionRef
+}
+type updateOp struct {
+	key     expr
+	with    expr
+	replace bool
+	coll    collectionRef
+}
+type removeOp struct {
+	key  expr
+	coll collectionRef
+}
+type upsertOp struct {
+	search  expr
+	insert  expr
+	update  expr
+	replace bool
+	coll    collectionRef
+}
+
+type query struct {
+	ops []operation
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// noIn is set while parsing the document of a data modification
+	// operation where IN starts the collection rather than being an operator
+	noIn bool
+}
+
+func parse(q string) (*query, error) {
+	tokens, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	qry, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s", p.peek())
+	}
+	return qry, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if p.peek().is(kind, text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.accept(kind, text) {
+		return fmt.Errorf("expected %q but got %s", text, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return "", fmt.Errorf("expected name but got %s", t)
+	}
+	return t.text, nil
+}
+
+func (p *parser) parseQuery() (*query, error) {
+	q := &query{}
+	for {
+		t := p.peek()
+		if t.kind != tokKeyword {
+			break
+		}
+
+		var op operation
+		var err error
+		switch t.text {
+		case "FOR":
+			op, err = p.parseFor()
+		case "LET":
+			op, err = p.parseLet()
+		case "FILTER":
+			p.next()
+			var cond expr
+			cond, err = p.parseExpr()
+			op = filterOp{cond: cond}
+		case "SORT":
+			op, err = p.parseSort()
+		case "LIMIT":
+			op, err = p.parseLimit()
+		case "RETURN":
+			op, err = p.parseReturn()
+		case "INSERT":
+			op, err = p.parseInsert()
+		case "UPDATE", "REPLACE":
+			op, err = p.parseUpdate()
+		case "REMOVE":
+			op, err = p.parseRemove()
+		case "UPSERT":
+			op, err = p.parseUpsert()
+		default:
+			return q, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		q.ops = append(q.ops, op)
+		if _, ok := op.(returnOp); ok {
+			break
+		}
+	}
+
+	if len(q.ops) == 0 {
+		return nil, fmt.Errorf("expected query but got %s", p.peek())
+	}
+	return q, nil
+}
+
+func (p *parser) parseFor() (operation, error) {
+	p.next()
+	variable, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(tokKeyword, "IN"); err != nil {
+		return nil, err
+	}
+
+	var src expr
+	if t := p.peek(); t.kind == tokCollectionBind {
+		p.next()
+		src = collectionRef{bind: t.text}
+	} else {
+		src, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var search expr
+	if p.accept(tokKeyword, "SEARCH") {
+		search, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		// search options only tune consistency and index usage, both
+		// of which don't apply to an in-memory database
+		if t := p.peek(); t.kind == tokIdent && strings.ToUpper(t.text) == "OPTIONS" {
+			p.next()
+			if err := p.expect(tokOp, "{"); err != nil {
+				return nil, err
+			}
+			if _, err := p.parseObject(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return forOp{variable: variable, src: src, search: search}, nil
+}
+
+func (p *parser) parseLet() (operation, error) {
+	p.next()
+	variable, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(tokOp, "="); err != nil {
+		return nil, err
+	}
+
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	return letOp{variable: variable, value: value}, nil
+}
+
+func (p *parser) parseSort() (operation, error) {
+	p.next()
+	var op sortOp
+	for {
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		key := sortKey{value: value}
+		if p.accept(tokKeyword, "DESC") {
+			key.desc = true
+		} else {
+			p.accept(tokKeyword, "ASC")
+		}
+		op.keys = append(op.keys, key)
+
+		if !p.accept(tokOp, ",") {
+			return op, nil
+		}
+	}
+}
+
+func (p *parser) parseLimit() (operation, error) {
+	p.next()
+	first, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept(tokOp, ",") {
+		return limitOp{count: first}, nil
+	}
+
+	second, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	return limitOp{offset: first, count: second}, nil
+}
+
+func (p *parser) parseReturn() (operation, error) {
+	p.next()
+	distinct := p.accept(tokKeyword, "DISTINCT")
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	return returnOp{distinct: distinct, value: value}, nil
+}
+
+func (p *parser) parseCollectionRef() (collectionRef, error) {
+	if !p.accept(tokKeyword, "IN") && !p.accept(tokKeyword, "INTO") {
+		return collectionRef{}, fmt.Errorf("expected IN or INTO but got %s", p.peek())
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokIdent:
+		return collectionRef{name: t.text}, nil
+	case tokCollectionBind:
+		return collectionRef{bind: t.text}, nil
+	}
+	return collectionRef{}, fmt.Errorf("expected collection but got %s", t)
+}
+
+func (p *parser) parseInsert() (operation, error) {
+	p.next()
+	doc, err := p.parseDocumentExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	coll, err := p.parseCollectionRef()
+	if err != nil {
+		return nil, err
+	}
+
+	return insertOp{doc: doc, coll: coll}, nil
+}
+
+func (p *parser) parseUpdate() (operation, error) {
+	replace := p.next().text == "REPLACE"
+	key, err := p.parseDocumentExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	var with expr
+	if p.accept(tokKeyword, "WITH") {
+		with, err = p.parseDocumentExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	coll, err := p.parseCollectionRef()
+	if err != nil {
+		return nil, err
+	}
+
+	return updateOp{key: key, with: with, replace: replace, coll: coll}, nil
+}
+
+func (p *parser) parseRemove() (operation, error) {
+	p.next()
+	key, err := p.parseDocumentExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	coll, err := p.parseCollectionRef()
+	if err != nil {
+		return nil, err
+	}
+
+	return removeOp{key: key, coll: coll}, nil
+}
+
+func (p *parser) parseUpsert() (operation, error) {
+	p.next()
+	search, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(tokKeyword, "INSERT"); err != nil {
+		return nil, err
+	}
+
+	insert, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	replace := false
+	if p.accept(tokKeyword, "REPLACE") {
+		replace = true
+	} else if err := p.expect(tokKeyword, "UPDATE"); err != nil {
+		return nil, err
+	}
+
+	update, err := p.parseDocumentExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	coll, err := p.parseCollectionRef()
+	if err != nil {
+		return nil, err
+	}
+
+	return upsertOp{search: search, insert: insert, update: update, replace: replace, coll: coll}, nil
+}
+
+// parseDocumentExpr parses an expression that is followed by IN or INTO and
+// the name of a collection.
+func (p *parser) parseDocumentExpr() (expr, error) {
+	noIn := p.noIn
+	p.noIn = true
+	defer func() { p.noIn = noIn }()
+	return p.parseExpr()
+}
+
+// parseNestedExpr parses an expression inside brackets, where IN is always
+// an operator.
+func (p *parser) parseNestedExpr() (expr, error) {
+	noIn := p.noIn
+	p.noIn = false
+	defer func() { p.noIn = noIn }()
+	return p.parseExpr()
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept(tokOp, "?") {
+		return cond, nil
+	}
+
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(tokOp, ":"); err != nil {
+		return nil, err
+	}
+
+	els, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	return ternaryExpr{cond: cond, then: then, els: els}, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(tokOp, "||") || p.accept(tokKeyword, "OR") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: "||", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(tokOp, "&&") || p.accept(tokKeyword, "AND") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: "&&", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept(tokOp, "!") || p.accept(tokKeyword, "NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "!", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		var op string
+		switch {
+		case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+			op = t.text
+		case t.is(tokKeyword, "IN") && !p.noIn:
+			op = "IN"
+		case t.is(tokKeyword, "LIKE"):
+			op = "LIKE"
+		case t.is(tokKeyword, "NOT") && p.tokens[p.pos+1].is(tokKeyword, "IN") && !p.noIn:
+			p.next()
+			op = "NOT IN"
+		default:
+			return l, nil
+		}
+		p.next()
+
+		r, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	l, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if !t.is(tokOp, "+") && !t.is(tokOp, "-") {
+			return l, nil
+		}
+		p.next()
+
+		r, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if !t.is(tokOp, "*") && !t.is(tokOp, "/") && !t.is(tokOp, "%") {
+			return l, nil
+		}
+		p.next()
+
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.accept(tokOp, "-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "-", x: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.accept(tokOp, "."):
+			t := p.next()
+			if t.kind != tokIdent && t.kind != tokKeyword {
+				return nil, fmt.Errorf("expected attribute name but got %s", t)
+			}
+			x = attrExpr{obj: x, name: t.text}
+		case p.accept(tokOp, "["):
+			idx, err := p.parseNestedExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(tokOp, "]"); err != nil {
+				return nil, err
+			}
+			x = indexExpr{obj: x, idx: idx}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+		return literalExpr{value: f}, nil
+	case tokString:
+		return literalExpr{value: t.text}, nil
+	case tokBind:
+		return bindExpr{name: t.text}, nil
+	case tokKeyword:
+		switch t.text {
+		case "TRUE":
+			return literalExpr{value: true}, nil
+		case "FALSE":
+			return literalExpr{value: false}, nil
+		case "NULL":
+			return literalExpr{value: nil}, nil
+		case "LIKE":
+			if p.accept(tokOp, "(") {
+				return p.parseCall(t.text)
+			}
+		}
+	case tokIdent:
+		if p.accept(tokOp, "(") {
+			return p.parseCall(t.text)
+		}
+		return varExpr{name: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			return p.parseParenthesized()
+		case "{":
+			return p.parseObject()
+		case "[":
+			return p.parseArray()
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+func (p *parser) parseParenthesized() (expr, error) {
+	noIn := p.noIn
+	p.noIn = false
+	defer func() { p.noIn = noIn }()
+
+	var x expr
+	if p.peek().kind == tokKeyword && (p.peek().text == "FOR" || p.peek().text == "LET" || p.peek().text == "RETURN") {
+		q, err := p.parseQuery()
+		if err != nil {
+			return nil, err
+		}
+		x = subqueryExpr{q: q}
+	} else {
+		var err error
+		x, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expect(tokOp, ")"); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (p *parser) parseCall(name string) (expr, error) {
+	call := callExpr{name: name}
+	if p.accept(tokOp, ")") {
+		return call, nil
+	}
+
+	for {
+		arg, err := p.parseNestedExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+
+		if p.accept(tokOp, ")") {
+			return call, nil
+		}
+		if err := p.expect(tokOp, ","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseObject() (expr, error) {
+	obj := objectExpr{}
+	if p.accept(tokOp, "}") {
+		return obj, nil
+	}
+
+	for {
+		t := p.next()
+		var key string
+		switch t.kind {
+		case tokIdent, tokKeyword, tokString:
+			key = t.text
+		default:
+			return nil, fmt.Errorf("expected attribute name but got %s", t)
+		}
+
+		var value expr
+		if p.accept(tokOp, ":") {
+			var err error
+			value, err = p.parseNestedExpr()
+			if err != nil {
+				return nil, err
+			}
+		} else if t.kind == tokIdent {
+			// shorthand { name } is the same as { name: name }
+			value = varExpr{name: key}
+		} else {
+			return nil, fmt.Errorf("expected ':' but got %s", p.peek())
+		}
+		obj.keys = append(obj.keys, key)
+		obj.values = append(obj.values, value)
+
+		if p.accept(tokOp, "}") {
+			return obj, nil
+		}
+		if err := p.expect(tokOp, ","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseArray() (expr, error) {
+	arr := arrayExpr{}
+	if p.accept(tokOp, "]") {
+		return arr, nil
+	}
+
+	for {
+		elem, err := p.parseNestedExpr()
+		if err != nil {
+			return nil, err
+		}
+		arr.elems = append(arr.elems, elem)
+
+		if p.accept(tokOp, "]") {
+			return arr, nil
+		}
+		if err := p.expect(tokOp, ","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package arangotest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scoreVariable is the name of the hidden variable holding the relevance
+// score of the document bound to variable by a FOR ... SEARCH loop.
+func scoreVariable(variable string) string {
+	return "\x00score:" + variable
+}
+
+// scoreOf implements the scoring functions BM25 and TFIDF.
+func scoreOf(call callExpr, f frame) (float64, bool) {
+	name := strings.ToUpper(call.name)
+	if (name != "BM25" && name != "TFIDF") || len(call.args) == 0 {
+		return 0, false
+	}
+
+	v, ok := call.args[0].(varExpr)
+	if !ok {
+		return 0, false
+	}
+
+	score, ok := f[scoreVariable(v.name)].(float64)
+	return score, ok
+}
+
+// search evaluates the condition of a SEARCH operation. Comparisons
+// against document attributes are evaluated on the tokens produced by the
+// analyzer in effect. The returned score counts the matched tokens.
+func (e *executor) search(x expr, f frame, analyzer string) (bool, float64, error) {
+	switch n := x.(type) {
+	case callExpr:
+		switch strings.ToUpper(n.name) {
+		case "ANALYZER":
+			if len(n.args) != 2 {
+				return false, 0, fmt.Errorf("invalid number of arguments for function 'ANALYZER()'")
+			}
+			name, err := e.eval(n.args[1], f)
+			if err != nil {
+				return false, 0, err
+			}
+			return e.search(n.args[0], f, toString(name))
+		case "PHRASE":
+			return e.searchPhrase(n, f, analyzer)
+		}
+	case unaryExpr:
+		if n.op == "!" {
+			match, _, err := e.search(n.x, f, analyzer)
+			return !match, 0, err
+		}
+	case binaryExpr:
+		switch n.op {
+		case "&&":
+			lm, ls, err := e.search(n.l, f, analyzer)
+			if err != nil || !lm {
+				return false, 0, err
+			}
+			rm, rs, err := e.search(n.r, f, analyzer)
+			return rm, ls + rs, err
+		case "||":
+			lm, ls, err := e.search(n.l, f, analyzer)
+			if err != nil {
+				return false, 0, err
+			}
+			rm, rs, err := e.search(n.r, f, analyzer)
+			return lm || rm, ls + rs, err
+		case "==", "IN":
+			if _, ok := n.l.(attrExpr); ok {
+				return e.searchTerms(n, f, analyzer)
+			}
+		}
+	}
+
+	v, err := e.eval(x, f)
+	if err != nil {
+		return false, 0, err
+	}
+	return truthy(v), 0, nil
+}
+
+func (e *executor) searchTerms(n binaryExpr, f frame, analyzer string) (bool, float64, error) {
+	field, err := e.eval(n.l, f)
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens, err := analyze(field, analyzer)
+	if err != nil {
+		return false, 0, err
+	}
+
+	value, err := e.eval(n.r, f)
+	if err != nil {
+		return false, 0, err
+	}
+
+	terms := []interface{}{value}
+	if n.op == "IN" {
+		terms, _ = value.([]interface{})
+	}
+
+	score := 0.0
+	for _, term := range terms {
+		for _, token := range tokens {
+			if token == toString(term) {
+				score++
+			}
+		}
+	}
+	return score > 0, score, nil
+}
+
+func (e *executor) searchPhrase(n callExpr, f frame, analyzer string) (bool, float64, error) {
+	if len(n.args) < 2 {
+		return false, 0, fmt.Errorf("invalid number of arguments for function 'PHRASE()'")
+	}
+
+	if len(n.args) > 2 {
+		name, err := e.eval(n.args[2], f)
+		if err != nil {
+			return false, 0, err
+		}
+		analyzer = toString(name)
+	}
+
+	field, err := e.eval(n.args[0], f)
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens, err := analyze(field, analyzer)
+	if err != nil {
+		return false, 0, err
+	}
+
+	phrase, err := e.eval(n.args[1], f)
+	if err != nil {
+		return false, 0, err
+	}
+
+	terms, err := analyze(toString(phrase), analyzer)
+	if err != nil || len(terms) == 0 {
+		return false, 0, err
+	}
+
+	score := 0.0
+	for i := 0; i+len(terms) <= len(tokens); i++ {
+		match := true
+		for j, term := range terms {
+			if tokens[i+j] != term {
+				match = false
+				break
+			}
+		}
+		if match {
+			score++
+		}
+	}
+	return score > 0, score, nil
+}
@@ -0,0 +1,117 @@
+package arangotest
+
+import (
+	"context"
+	"net/http"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+const (
+	errTransactionNotFound = 1655
+	errTransactionAborted  = 1654
+)
+
+// transactionData holds what's needed to roll back a stream transaction.
+// Writes are applied immediately, an abort restores a copy of the write
+// collections taken when the transaction began. This means transactions
+// aren't isolated from each other, which is good enough for tests that
+// check that failed updates don't leave partial results behind.
+type transactionData struct {
+	status    driver.TransactionStatus
+	snapshots map[string]*collectionData
+}
+
+func (c *collectionData) copy() *collectionData {
+	cp := &collectionData{
+		name:   c.name,
+		keys:   append([]string(nil), c.keys...),
+		unique: c.unique,
+		docs:   make(map[string]map[string]interface{}, len(c.docs)),
+	}
+	for k, doc := range c.docs {
+		cp.docs[k] = copyValue(doc).(map[string]interface{})
+	}
+	return cp
+}
+
+// BeginTransaction starts a stream transaction on the given collections.
+func (db *Database) BeginTransaction(ctx context.Context, cols driver.TransactionCollections, opts *driver.BeginTransactionOptions) (driver.TransactionID, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx := &transactionData{
+		status:    driver.TransactionRunning,
+		snapshots: map[string]*collectionData{},
+	}
+	for _, names := range [][]string{cols.Read, cols.Write, cols.Exclusive} {
+		for _, name := range names {
+			if _, ok := db.collections[name]; !ok {
+				return "", newNotFoundError(errDataSourceNotFound, "collection or view not found: "+name)
+			}
+		}
+	}
+	for _, names := range [][]string{cols.Write, cols.Exclusive} {
+		for _, name := range names {
+			tx.snapshots[name] = db.collections[name].copy()
+		}
+	}
+
+	id := driver.TransactionID("tx" + db.nextRevision())
+	db.transactions[id] = tx
+	return id, nil
+}
+
+// CommitTransaction commits a running transaction.
+func (db *Database) CommitTransaction(ctx context.Context, tid driver.TransactionID, opts *driver.CommitTransactionOptions) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tx, err := db.runningTransaction(tid)
+	if err != nil {
+		return err
+	}
+
+	tx.status = driver.TransactionCommitted
+	tx.snapshots = nil
+	return nil
+}
+
+// AbortTransaction rolls back a running transaction.
+func (db *Database) AbortTransaction(ctx context.Context, tid driver.TransactionID, opts *driver.AbortTransactionOptions) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tx, err := db.runningTransaction(tid)
+	if err != nil {
+		return err
+	}
+
+	for name, snapshot := range tx.snapshots {
+		if _, ok := db.collections[name]; ok {
+			db.collections[name] = snapshot
+		}
+	}
+	tx.status = driver.TransactionAborted
+	tx.snapshots = nil
+	return nil
+}
+
+// TransactionStatus returns the status of a transaction.
+func (db *Database) TransactionStatus(ctx context.Context, tid driver.TransactionID) (driver.TransactionStatusRecord, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tx, ok := db.transactions[tid]
+	if !ok {
+		return driver.TransactionStatusRecord{}, newNotFoundError(errTransactionNotFound, "transaction not found")
+	}
+	return driver.TransactionStatusRecord{Status: tx.status}, nil
+}
+
+func (db *Database) runningTransaction(tid driver.TransactionID) (*transactionData, error) {
+	tx, ok := db.transactions[tid]
+	if !ok {
+		return nil, newNotFoundError(errTransactionNotFound, "transaction not found")
+	} else if tx.status != driver.TransactionRunning {
+		return nil, newArangoError(http.StatusBadRequest, errTransactionAborted, "transaction is "+string(tx.status))
+	}
+	return tx, nil
+}
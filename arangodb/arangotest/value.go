@@ -0,0 +1,212 @@
+package arangotest
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// Values handled by the fake are what encoding/json produces when decoding
+// into an interface{}: nil, bool, float64, string, []interface{} and
+// map[string]interface{}.
+
+// toValue converts an arbitrary go value into its JSON representation the
+// same way the driver would before sending it to the server.
+func toValue(v interface{}) (interface{}, error) {
+	bites, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var val interface{}
+	err = json.Unmarshal(bites, &val)
+	return val, err
+}
+
+// fromValue decodes a value into result the same way the driver would after
+// receiving it from the server.
+func fromValue(v interface{}, result interface{}) error {
+	bites, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bites, result)
+}
+
+// copyValue returns a deep copy of v so that documents stored in a collection
+// can't be modified through values handed out by queries.
+func copyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(x))
+		for i, e := range x {
+			a[i] = copyValue(e)
+		}
+		return a
+	}
+	return v
+}
+
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	case map[string]interface{}:
+		return 5
+	}
+	return 6
+}
+
+// compareValues orders values the way AQL does: null < bool < number <
+// string < array < object.
+func compareValues(a, b interface{}) int {
+	ta, tb := typeOrder(a), typeOrder(b)
+	if ta != tb {
+		return ta - tb
+	}
+
+	switch x := a.(type) {
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case float64:
+		y := b.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		y := b.(string)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case []interface{}:
+		y := b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compareValues(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return len(x) - len(y)
+	case map[string]interface{}:
+		y := b.(map[string]interface{})
+		keys := unionKeys(x, y)
+		for _, k := range keys {
+			if c := compareValues(x[k], y[k]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	return 0
+}
+
+func unionKeys(x, y map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]interface{}{x, y} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalValues(a, b interface{}) bool {
+	return compareValues(a, b) == 0
+}
+
+// truthy implements AQL's conversion of values to booleans.
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0 && !math.IsNaN(x)
+	case string:
+		return x != ""
+	}
+	return true
+}
+
+func toNumber(v interface{}) float64 {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return 1
+		}
+	case float64:
+		return x
+	case string:
+		var f float64
+		if err := json.Unmarshal([]byte(x), &f); err == nil {
+			return f
+		}
+	case []interface{}:
+		if len(x) == 1 {
+			return toNumber(x[0])
+		}
+	}
+	return 0
+}
+
+// mergeValues implements the default UPDATE semantics of merging objects
+// recursively. Attributes explicitly set to null are kept.
+func mergeValues(old, update map[string]interface{}) map[string]interface{} {
+	merged := copyValue(old).(map[string]interface{})
+	for k, v := range update {
+		oldObj, ok1 := merged[k].(map[string]interface{})
+		newObj, ok2 := v.(map[string]interface{})
+		if ok1 && ok2 {
+			merged[k] = mergeValues(oldObj, newObj)
+		} else {
+			merged[k] = copyValue(v)
+		}
+	}
+	return merged
+}
+
+// matchesExample reports whether all attributes of example are present in
+// doc with equal values.
+func matchesExample(doc, example map[string]interface{}) bool {
+	for k, v := range example {
+		if !equalValues(doc[k], v) {
+			return false
+		}
+	}
+	return true
+}
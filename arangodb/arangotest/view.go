@@ -0,0 +1,189 @@
+package arangotest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+type viewData struct {
+	name  string
+	props driver.ArangoSearchViewProperties
+}
+
+// View is an in-memory implementation of driver.ArangoSearchView. A view
+// exposes all documents of its linked collections to SEARCH queries.
+type View struct {
+	db   *Database
+	name string
+}
+
+// Name returns the name of the view.
+func (v *View) Name() string {
+	return v.name
+}
+
+// Type returns the type of this view.
+func (v *View) Type() driver.ViewType {
+	return driver.ViewTypeArangoSearch
+}
+
+// ArangoSearchView returns this view as an ArangoSearch view.
+func (v *View) ArangoSearchView() (driver.ArangoSearchView, error) {
+	return v, nil
+}
+
+// Database returns the database containing the view.
+func (v *View) Database() driver.Database {
+	return v.db
+}
+
+// Remove removes the entire view.
+func (v *View) Remove(ctx context.Context) error {
+	v.db.mu.Lock()
+	defer v.db.mu.Unlock()
+	if _, ok := v.db.views[v.name]; !ok {
+		return newNotFoundError(errDataSourceNotFound, "collection or view not found: "+v.name)
+	}
+	delete(v.db.views, v.name)
+	return nil
+}
+
+// Properties fetches extended information about the view.
+func (v *View) Properties(ctx context.Context) (driver.ArangoSearchViewProperties, error) {
+	v.db.mu.Lock()
+	defer v.db.mu.Unlock()
+	view, ok := v.db.views[v.name]
+	if !ok {
+		return driver.ArangoSearchViewProperties{}, newNotFoundError(errDataSourceNotFound, "collection or view not found: "+v.name)
+	}
+	return view.props, nil
+}
+
+// SetProperties changes properties of the view.
+func (v *View) SetProperties(ctx context.Context, options driver.ArangoSearchViewProperties) error {
+	v.db.mu.Lock()
+	defer v.db.mu.Unlock()
+	view, ok := v.db.views[v.name]
+	if !ok {
+		return newNotFoundError(errDataSourceNotFound, "collection or view not found: "+v.name)
+	}
+	view.props = options
+	return nil
+}
+
+// View opens a connection to an existing view within the database.
+func (db *Database) View(ctx context.Context, name string) (driver.View, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.views[name]; !ok {
+		return nil, newNotFoundError(errDataSourceNotFound, "collection or view not found: "+name)
+	}
+	return &View{db: db, name: name}, nil
+}
+
+// ViewExists returns true if a view with given name exists within the database.
+func (db *Database) ViewExists(ctx context.Context, name string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	_, ok := db.views[name]
+	return ok, nil
+}
+
+// Views returns a list of all views in the database.
+func (db *Database) Views(ctx context.Context) ([]driver.View, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	names := make([]string, 0, len(db.views))
+	for name := range db.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	views := make([]driver.View, len(names))
+	for i, name := range names {
+		views[i] = &View{db: db, name: name}
+	}
+	return views, nil
+}
+
+// CreateArangoSearchView creates a new view of type ArangoSearch.
+func (db *Database) CreateArangoSearchView(ctx context.Context, name string, options *driver.ArangoSearchViewProperties) (driver.ArangoSearchView, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.nameExists(name) {
+		return nil, newArangoError(http.StatusConflict, errDuplicateName, "duplicate name: "+name)
+	}
+
+	view := &viewData{name: name}
+	if options != nil {
+		view.props = *options
+	}
+	db.views[name] = view
+	return &View{db: db, name: name}, nil
+}
+
+func (db *Database) nameExists(name string) bool {
+	_, isColl := db.collections[name]
+	_, isView := db.views[name]
+	return isColl || isView
+}
+
+// viewDocuments returns all documents of the collections linked to a view.
+func (db *Database) viewDocuments(view *viewData) []interface{} {
+	names := make([]string, 0, len(view.props.Links))
+	for name := range view.props.Links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var docs []interface{}
+	for _, name := range names {
+		coll, ok := db.collections[name]
+		if !ok {
+			continue
+		}
+		for _, key := range coll.keys {
+			docs = append(docs, copyValue(coll.docs[key]))
+		}
+	}
+	return docs
+}
+
+// analyze splits a value into tokens the way the built-in analyzers do.
+// Only identity and the text_* analyzers are known, text analyzers don't
+// stem or remove stop words.
+func analyze(value interface{}, analyzer string) ([]string, error) {
+	var values []string
+	switch x := value.(type) {
+	case string:
+		values = []string{x}
+	case []interface{}:
+		for _, e := range x {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+	default:
+		return nil, nil
+	}
+
+	var tokens []string
+	for _, s := range values {
+		switch {
+		case analyzer == "" || analyzer == "identity":
+			tokens = append(tokens, s)
+		case strings.HasPrefix(analyzer, "text_"):
+			tokens = append(tokens, strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})...)
+		default:
+			return nil, newArangoError(http.StatusBadRequest, errQueryParse, "analyzer not found: "+analyzer)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,210 @@
+package arangodb
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidFilter is returned by QueryJSON if the filter isn't a single
+// AQL expression over doc and bind variables.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// filterKeywords are the AQL keywords that start or are part of an
+// operation. A filter containing them isn't a plain expression, e.g. it
+// could close the expression and modify data or read other collections.
+var filterKeywords = map[string]bool{
+	"AGGREGATE": true,
+	"COLLECT":   true,
+	"DISTINCT":  true,
+	"FILTER":    true,
+	"FOR":       true,
+	"GRAPH":     true,
+	"INSERT":    true,
+	"INTO":      true,
+	"KEEP":      true,
+	"LET":       true,
+	"LIMIT":     true,
+	"OPTIONS":   true,
+	"PRUNE":     true,
+	"REMOVE":    true,
+	"REPLACE":   true,
+	"RETURN":    true,
+	"SEARCH":    true,
+	"SORT":      true,
+	"UPDATE":    true,
+	"UPSERT":    true,
+	"WINDOW":    true,
+	"WITH":      true,
+}
+
+// filterNames are the bare names a filter can use, any other name would
+// refer to a collection.
+var filterNames = map[string]bool{
+	"DOC":   true,
+	"TRUE":  true,
+	"FALSE": true,
+	"NULL":  true,
+	"AND":   true,
+	"OR":    true,
+	"NOT":   true,
+	"IN":    true,
+	"LIKE":  true,
+	"ANY":   true,
+	"ALL":   true,
+	"NONE":  true,
+}
+
+// filterFunctions are the AQL functions that take the name of a collection
+// or call other functions by name.
+var filterFunctions = map[string]bool{
+	"APPLY":            true,
+	"CALL":             true,
+	"COLLECTIONS":      true,
+	"COLLECTION_COUNT": true,
+	"DOCUMENT":         true,
+	"FULLTEXT":         true,
+	"NEAR":             true,
+	"PREGEL_RESULT":    true,
+	"V8":               true,
+	"WITHIN":           true,
+	"WITHIN_RECTANGLE": true,
+}
+
+// checkFilter makes sure filter is a single AQL expression that can only
+// read doc and bind variables, so it can't break out of the query it's
+// embedded in. Filters are still AQL, so it's conservative and rejects
+// some valid expressions, e.g. inline filters on arrays.
+func checkFilter(filter string) error {
+	var closers []byte
+	var prev string
+	empty := true
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '/' && i+1 < len(filter) && (filter[i+1] == '/' || filter[i+1] == '*'):
+			return ErrInvalidFilter
+		case c == '"' || c == '\'':
+			end := quoteEnd(filter, i)
+			if end < 0 {
+				return ErrInvalidFilter
+			}
+			i = end
+			prev = "string"
+		case c == '`':
+			// quoted names are only allowed as attribute names
+			end := quoteEnd(filter, i)
+			if end < 0 || prev != "." {
+				return ErrInvalidFilter
+			}
+			i = end
+			prev = "name"
+		case c >= '0' && c <= '9':
+			for i < len(filter) && (isNameChar(filter[i]) || filter[i] == '.') {
+				i++
+			}
+			prev = "number"
+		case c == '@':
+			j := i + 1
+			for j < len(filter) && isNameChar(filter[j]) {
+				j++
+			}
+			// collection bind variables start with @@
+			if j == i+1 {
+				return ErrInvalidFilter
+			}
+			i = j
+			prev = "name"
+		case isNameStart(c):
+			j := i
+			for j < len(filter) && isNameChar(filter[j]) {
+				j++
+			}
+			name := strings.ToUpper(filter[i:j])
+			k := j
+			for k < len(filter) && filter[k] == ' ' {
+				k++
+			}
+			next := byte(0)
+			if k < len(filter) {
+				next = filter[k]
+			}
+
+			switch {
+			case prev == ".":
+				// attribute name
+			case filterKeywords[name]:
+				return ErrInvalidFilter
+			case next == '(':
+				if filterFunctions[name] {
+					return ErrInvalidFilter
+				}
+			case next == ':' && (prev == "{" || prev == ","):
+				// member name of an object literal
+			case !filterNames[name]:
+				return ErrInvalidFilter
+			}
+			if next == ':' && k+1 < len(filter) && filter[k+1] == ':' {
+				// user-defined functions can run anything
+				return ErrInvalidFilter
+			}
+			i = j
+			prev = "name"
+		case c == '(':
+			closers = append(closers, ')')
+			i++
+			prev = "("
+		case c == '[':
+			closers = append(closers, ']')
+			i++
+			prev = "["
+		case c == '{':
+			closers = append(closers, '}')
+			i++
+			prev = "{"
+		case c == ')' || c == ']' || c == '}':
+			if len(closers) == 0 || closers[len(closers)-1] != c {
+				return ErrInvalidFilter
+			}
+			closers = closers[:len(closers)-1]
+			i++
+			prev = string(c)
+		case c == ';':
+			return ErrInvalidFilter
+		default:
+			i++
+			prev = string(c)
+		}
+		empty = false
+	}
+
+	if empty || len(closers) > 0 {
+		return ErrInvalidFilter
+	}
+	return nil
+}
+
+// quoteEnd returns the index after the quoted string starting at i or -1
+// if it isn't terminated.
+func quoteEnd(s string, i int) int {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,248 @@
+package arangodb
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	pathCollectionName = "paths"
+
+	queryUpsertPathChanges = "FOR c IN @changes UPSERT { _key: c._key } INSERT c UPDATE {} IN @@coll"
+	queryPathChanges       = "FOR d IN @@coll FILTER d.path == @path RETURN d"
+	queryDirChanges        = "FOR d IN @@coll FILTER d.path >= @from && d.path < @to RETURN d"
+	queryIndexedCommits    = "FOR d IN @@coll FILTER d._key IN @keys RETURN d._key"
+
+	// indexBatchSize is the number of commits looked up at once when
+	// checking which commits are indexed
+	indexBatchSize = 1000
+)
+
+// PathChange records that a commit changed the file at Path compared to
+// its first parent. The path index holds one PathChange per changed file
+// of every commit. It also holds a PathChange without a Path for every
+// indexed commit, keyed by the commit hash, which tells commits that didn't
+// change any file from commits that aren't indexed.
+type PathChange struct {
+	Key    string `json:"_key,omitempty"`
+	Commit string `json:"commit"`
+	Path   string `json:"path,omitempty"`
+	// Blob is the hash of the new content, it's empty if the file was
+	// deleted or renamed
+	Blob string `json:"blob,omitempty"`
+	// From is the path the file was renamed from
+	From string `json:"from,omitempty"`
+}
+
+func newPathCollection(db driver.Database, prefix string) (driver.Collection, error) {
+	coll, err := getOrCreateCollection(db, prefix+pathCollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = coll.EnsurePersistentIndex(context.Background(), []string{"path"}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// history search looks up the changes that added a blob
+	_, _, err = coll.EnsurePersistentIndex(context.Background(), []string{"blob"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+// SetEncodedObject stores an object and adds the files changed by commits
+// to the path index. Commits whose trees aren't stored yet, as it happens
+// when a pack lists commits first, are left to IndexPaths.
+func (s *arangoStore) SetEncodedObject(o plumbing.EncodedObject) (plumbing.Hash, error) {
+	h, err := s.objectStorage.SetEncodedObject(o)
+	if err != nil || o.Type() != plumbing.CommitObject {
+		return h, err
+	}
+
+	c, err := object.DecodeCommit(s, o)
+	if err != nil {
+		return h, err
+	}
+
+	err = s.indexPaths(c)
+	if err == plumbing.ErrObjectNotFound {
+		return h, nil
+	}
+	return h, err
+}
+
+// IndexPaths adds those of commits to the path index that aren't indexed
+// yet, e.g. because they were stored before the index existed or before
+// their trees. It reports whether any commit had to be indexed.
+func (s *arangoStore) IndexPaths(commits []plumbing.Hash) (bool, error) {
+	added := false
+	for len(commits) > 0 {
+		batch := commits
+		if len(batch) > indexBatchSize {
+			batch = batch[:indexBatchSize]
+		}
+		commits = commits[len(batch):]
+
+		indexed, err := s.indexedCommits(batch)
+		if err != nil {
+			return false, err
+		}
+
+		for _, h := range batch {
+			if indexed[h.String()] {
+				continue
+			}
+
+			c, err := object.GetCommit(s, h)
+			if err != nil {
+				return false, err
+			}
+			err = s.indexPaths(c)
+			if err != nil {
+				return false, err
+			}
+			added = true
+		}
+	}
+	return added, nil
+}
+
+func (s *arangoStore) indexedCommits(commits []plumbing.Hash) (map[string]bool, error) {
+	keys := make([]string, len(commits))
+	for i, h := range commits {
+		keys[i] = h.String()
+	}
+
+	cursor, err := s.db.Query(context.Background(), queryIndexedCommits, map[string]interface{}{
+		"@coll": s.pathColl.Name(),
+		"keys":  keys,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	indexed := make(map[string]bool, len(commits))
+	for cursor.HasMore() {
+		var key string
+		_, err = cursor.ReadDocument(context.Background(), &key)
+		if err != nil {
+			return nil, err
+		}
+		indexed[key] = true
+	}
+	return indexed, nil
+}
+
+// PathChanges returns the changes of the file at path in all indexed
+// commits, including commits that aren't reachable from any reference.
+func (s *arangoStore) PathChanges(path string) ([]PathChange, error) {
+	return s.pathChanges(queryPathChanges, map[string]interface{}{
+		"@coll": s.pathColl.Name(),
+		"path":  path,
+	})
+}
+
+// DirChanges returns the changes of the files below the directory dir in
+// all indexed commits.
+func (s *arangoStore) DirChanges(dir string) ([]PathChange, error) {
+	// "0" follows "/", so the range holds exactly the paths below dir
+	return s.pathChanges(queryDirChanges, map[string]interface{}{
+		"@coll": s.pathColl.Name(),
+		"from":  dir + "/",
+		"to":    dir + "0",
+	})
+}
+
+func (s *arangoStore) pathChanges(query string, bindVars map[string]interface{}) ([]PathChange, error) {
+	cursor, err := s.db.Query(context.Background(), query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	var changes []PathChange
+	for cursor.HasMore() {
+		var ch PathChange
+		_, err = cursor.ReadDocument(context.Background(), &ch)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, ch)
+	}
+	return changes, nil
+}
+
+// indexPaths adds the files c changed compared to its first parent to the
+// path index. Renamed files are recorded as a deletion of the old path and
+// a change of the new path that remembers the old one. The commit is marked
+// as indexed along with its changes, so an interrupted attempt is redone.
+func (s *arangoStore) indexPaths(c *object.Commit) error {
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	var parent *object.Tree
+	if len(c.ParentHashes) > 0 {
+		parent, err = s.commitTree(c.ParentHashes[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	changes, err := object.DiffTree(parent, tree)
+	if err != nil {
+		return err
+	}
+
+	changes, err = object.DetectRenames(changes, nil)
+	if err != nil {
+		return err
+	}
+
+	var docs []PathChange
+	add := func(path string, blob plumbing.Hash, from string) {
+		doc := PathChange{
+			Key:    pathKey(c.Hash.String() + ":" + path),
+			Commit: c.Hash.String(),
+			Path:   path,
+			From:   from,
+		}
+		if !blob.IsZero() {
+			doc.Blob = blob.String()
+		}
+		docs = append(docs, doc)
+	}
+
+	for _, ch := range changes {
+		from, to := ch.From.Name, ch.To.Name
+		switch {
+		case to == "":
+			add(from, plumbing.ZeroHash, "")
+		case from == "" || from == to:
+			add(to, ch.To.TreeEntry.Hash, "")
+		default:
+			add(from, plumbing.ZeroHash, "")
+			add(to, ch.To.TreeEntry.Hash, from)
+		}
+	}
+	docs = append(docs, PathChange{Key: c.Hash.String(), Commit: c.Hash.String()})
+
+	cursor, err := s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertPathChanges, map[string]interface{}{
+		"@coll":   s.pathColl.Name(),
+		"changes": docs,
+	})
+	if err != nil {
+		return err
+	}
+
+	closeSilently(cursor)
+	return nil
+}
@@ -0,0 +1,405 @@
+package arangodb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+const (
+	materializedCollectionName = "materialized"
+
+	queryRemoveAllDocs                = "FOR d IN @@coll REMOVE d IN @@coll"
+	queryMaterializedMetaByCollection = "FOR d IN @@coll FILTER d.collection == @collection LIMIT 1 RETURN d._key"
+	queryUpsertMaterializedMeta       = "UPSERT { _key: @key } INSERT { _key: @key, ref: @ref, collection: @collection, commit: @commit } UPDATE { collection: @collection, commit: @commit } IN @@coll"
+)
+
+// ErrCollectionNotMaterialized is returned if the collection of a
+// materialized ref already contains documents that weren't materialized.
+var ErrCollectionNotMaterialized = errors.New("collection has documents that weren't materialized")
+
+// MaterializedDocument is the document stored for each file in the
+// collection of a materialized ref. Content is set for text files, Data for
+// all other files. JSON holds the parsed content of JSON files.
+type MaterializedDocument struct {
+	Key     string          `json:"_key,omitempty"`
+	Path    string          `json:"path"`
+	Hash    string          `json:"hash"`
+	Mode    string          `json:"mode"`
+	Size    int64           `json:"size"`
+	Content *string         `json:"content,omitempty"`
+	Data    []byte          `json:"data,omitempty"`
+	JSON    json.RawMessage `json:"json,omitempty"`
+}
+
+type materializedMetaDocument struct {
+	Key        string `json:"_key,omitempty"`
+	Ref        string `json:"ref,omitempty"`
+	Collection string `json:"collection,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+}
+
+// SetReference stores a reference and updates the collections of
+// materialized refs it affects.
+func (s *arangoStore) SetReference(ref *plumbing.Reference) error {
+	err := s.referenceStorage.SetReference(ref)
+	if err != nil {
+		return err
+	}
+	s.refChanged(ref.Name())
+	return nil
+}
+
+// CheckAndSetReference sets the reference `new`, but if `old` is
+// not `nil`, it first checks that the current stored value for
+// `old.Name()` matches the given reference value in `old`.  If
+// not, it returns an error and doesn't update `new`.
+func (s *arangoStore) CheckAndSetReference(new, old *plumbing.Reference) error {
+	err := s.referenceStorage.CheckAndSetReference(new, old)
+	if err != nil {
+		return err
+	}
+	s.refChanged(new.Name())
+	return nil
+}
+
+// CreateReference stores a new reference and updates the collections of
+// materialized refs it affects.
+func (s *arangoStore) CreateReference(ref *plumbing.Reference) error {
+	err := s.referenceStorage.CreateReference(ref)
+	if err != nil {
+		return err
+	}
+	s.refChanged(ref.Name())
+	return nil
+}
+
+// RemoveReference removes a reference and empties the collections of
+// materialized refs that no longer resolve.
+func (s *arangoStore) RemoveReference(n plumbing.ReferenceName) error {
+	err := s.referenceStorage.RemoveReference(n)
+	if err != nil {
+		return err
+	}
+	s.refChanged(n)
+	return nil
+}
+
+// SyncMaterialized brings the collections of all materialized refs up to
+// date. Reference updates don't fail if updating a collection fails, the
+// collections catch up with the next reference update or call of
+// SyncMaterialized, which returns the error if it persists.
+func (s *arangoStore) SyncMaterialized() error {
+	if len(s.options.Materialize) == 0 {
+		return nil
+	}
+
+	s.materializeMu.Lock()
+	defer s.materializeMu.Unlock()
+	s.materializeErr = s.syncMaterialized("")
+	return s.materializeErr
+}
+
+// refChanged updates the collections of the materialized refs affected by a
+// change of the ref called name. The ref is already written at this point,
+// so an error doesn't fail the write. After an error all collections are
+// updated with the next change.
+func (s *arangoStore) refChanged(name plumbing.ReferenceName) {
+	if len(s.options.Materialize) == 0 {
+		return
+	}
+
+	s.materializeMu.Lock()
+	defer s.materializeMu.Unlock()
+	if s.materializeErr != nil {
+		name = ""
+	}
+	s.materializeErr = s.syncMaterialized(name)
+}
+
+// syncMaterialized brings the collections of the materialized refs that
+// resolve through the ref called name up to date, or of all materialized
+// refs if name is empty. The caller has to hold materializeMu.
+func (s *arangoStore) syncMaterialized(name plumbing.ReferenceName) error {
+	refs := make([]string, 0, len(s.options.Materialize))
+	for ref := range s.options.Materialize {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		if name != "" {
+			ok, err := s.resolvesThrough(plumbing.ReferenceName(ref), name)
+			if err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+		}
+
+		err := s.materialize(plumbing.ReferenceName(ref), s.options.Materialize[ref])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolvesThrough reports whether resolving ref reads the ref called name,
+// i.e. whether it's name or a symbolic ref that leads to name.
+func (s *arangoStore) resolvesThrough(ref plumbing.ReferenceName, name plumbing.ReferenceName) (bool, error) {
+	for {
+		if ref == name {
+			return true, nil
+		}
+
+		r, err := s.referenceStorage.Reference(ref)
+		if err == plumbing.ErrReferenceNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		} else if r.Type() != plumbing.SymbolicReference {
+			return false, nil
+		}
+		ref = r.Target()
+	}
+}
+
+// materialize applies the tree diff between the commit the collection of
+// ref is at and the commit ref points to in a single transaction.
+func (s *arangoStore) materialize(ref plumbing.ReferenceName, collName string) error {
+	to, err := s.resolveCommit(ref)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var meta materializedMetaDocument
+	_, err = s.materializedColl.ReadDocument(ctx, refKey(ref), &meta)
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+
+	from := plumbing.NewHash(meta.Commit)
+	if from == to && meta.Collection == collName {
+		return nil
+	}
+
+	toTree, err := s.commitTree(to)
+	if err != nil {
+		return err
+	}
+
+	// start over if the collection changed or the commit it's at is gone
+	fromTree, err := s.commitTree(from)
+	rebuild := err == plumbing.ErrObjectNotFound || meta.Collection != collName
+	if rebuild {
+		fromTree = nil
+	} else if err != nil {
+		return err
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return err
+	}
+
+	coll, err := getOrCreateCollection(s.db, collName)
+	if err != nil {
+		return err
+	}
+
+	if rebuild {
+		err = s.checkMaterializedCollection(coll)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.transaction([]string{coll.Name(), s.materializedColl.Name()}, func(ctx context.Context) error {
+		return s.applyMaterialized(ctx, coll, ref, to, changes, toTree, rebuild)
+	})
+}
+
+// checkMaterializedCollection makes sure rebuilding coll doesn't remove
+// documents that weren't materialized. It returns
+// ErrCollectionNotMaterialized if coll has documents but no materialized
+// ref was ever written to it.
+func (s *arangoStore) checkMaterializedCollection(coll driver.Collection) error {
+	ctx := context.Background()
+	n, err := coll.Count(ctx)
+	if err != nil || n == 0 {
+		return err
+	}
+
+	cursor, err := s.db.Query(driver.WithQueryCount(ctx), queryMaterializedMetaByCollection, map[string]interface{}{
+		"@coll":      s.materializedColl.Name(),
+		"collection": coll.Name(),
+	})
+	if err != nil {
+		return err
+	}
+
+	defer closeSilently(cursor)
+	if cursor.Count() == 0 {
+		return ErrCollectionNotMaterialized
+	}
+	return nil
+}
+
+func (s *arangoStore) applyMaterialized(ctx context.Context, coll driver.Collection, ref plumbing.ReferenceName, commit plumbing.Hash, changes object.Changes, tree *object.Tree, rebuild bool) error {
+	if rebuild {
+		err := s.query(ctx, queryRemoveAllDocs, map[string]interface{}{
+			"@coll": coll.Name(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ch := range changes {
+		action, err := ch.Action()
+		if err != nil {
+			return err
+		}
+
+		if action == merkletrie.Delete {
+			_, err = coll.RemoveDocument(ctx, pathKey(ch.From.Name))
+			if err != nil && !driver.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+
+		doc, err := materializedDocument(tree, ch.To)
+		if err != nil {
+			return err
+		}
+
+		err = s.query(ctx, queryReplaceDocByKey, map[string]interface{}{
+			"@coll": coll.Name(),
+			"key":   doc.Key,
+			"doc":   doc,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.query(ctx, queryUpsertMaterializedMeta, map[string]interface{}{
+		"@coll":      s.materializedColl.Name(),
+		"key":        refKey(ref),
+		"ref":        ref.String(),
+		"collection": coll.Name(),
+		"commit":     commit.String(),
+	})
+}
+
+// transaction runs f in a stream transaction that writes to the collections
+// called write. The transaction is committed if f returns nil and aborted
+// otherwise.
+func (s *arangoStore) transaction(write []string, f func(ctx context.Context) error) error {
+	ctx := context.Background()
+	tid, err := s.db.BeginTransaction(ctx, driver.TransactionCollections{
+		Write: write,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	err = f(driver.WithTransactionID(ctx, tid))
+	if err != nil {
+		_ = s.db.AbortTransaction(ctx, tid, nil)
+		return err
+	}
+
+	return s.db.CommitTransaction(ctx, tid, nil)
+}
+
+func (s *arangoStore) query(ctx context.Context, query string, bindVars map[string]interface{}) error {
+	cursor, err := s.db.Query(ctx, query, bindVars)
+	if err != nil {
+		return err
+	}
+
+	closeSilently(cursor)
+	return nil
+}
+
+func materializedDocument(tree *object.Tree, entry object.ChangeEntry) (*MaterializedDocument, error) {
+	f, err := tree.TreeEntryFile(&entry.TreeEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := readIntoBuffer(f.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &MaterializedDocument{
+		Key:  pathKey(entry.Name),
+		Path: entry.Name,
+		Hash: f.Hash.String(),
+		Mode: f.Mode.String(),
+		Size: f.Size,
+	}
+	if isText(buf.Bytes()) {
+		content := buf.String()
+		doc.Content = &content
+		if json.Valid(buf.Bytes()) {
+			doc.JSON = json.RawMessage(buf.Bytes())
+		}
+	} else {
+		doc.Data = buf.Bytes()
+	}
+	return doc, nil
+}
+
+// resolveCommit returns the commit ref points to, peeling tags. It returns
+// plumbing.ZeroHash if ref doesn't exist.
+func (s *arangoStore) resolveCommit(ref plumbing.ReferenceName) (plumbing.Hash, error) {
+	r, err := storer.ResolveReference(s, ref)
+	if err == plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, nil
+	} else if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h := r.Hash()
+	for {
+		o, err := object.GetObject(s, h)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		switch x := o.(type) {
+		case *object.Commit:
+			return h, nil
+		case *object.Tag:
+			h = x.Target
+		default:
+			return plumbing.ZeroHash, plumbing.ErrInvalidType
+		}
+	}
+}
+
+// commitTree returns the tree of the commit h or nil for plumbing.ZeroHash.
+func (s *arangoStore) commitTree(h plumbing.Hash) (*object.Tree, error) {
+	if h.IsZero() {
+		return nil, nil
+	}
+
+	c, err := object.GetCommit(s, h)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tree()
+}
@@ -17,13 +17,13 @@ const (
 	indexKey   = "index-key"
 	configKey  = "config-key"
 
-	queryUpsertShallow = "UPSERT { _key: @key } INSERT { _key: @key, shallow: @shallow } UPDATE { shallow: @shallow } IN " + miscCollectionName
-	queryUpsertIndex   = "UPSERT { _key: @key } INSERT { _key: @key, idx: @idx } UPDATE { idx: @idx } IN " + miscCollectionName
-	queryUpsertConfig  = "UPSERT { _key: @key } INSERT { _key: @key, config: @config } UPDATE { config: @config } IN " + miscCollectionName
+	queryUpsertShallow = "UPSERT { _key: @key } INSERT { _key: @key, shallow: @shallow } UPDATE { shallow: @shallow } IN @@coll"
+	queryUpsertIndex   = "UPSERT { _key: @key } INSERT { _key: @key, idx: @idx } UPDATE { idx: @idx } IN @@coll"
+	queryUpsertConfig  = "UPSERT { _key: @key } INSERT { _key: @key, config: @config } UPDATE { config: @config } IN @@coll"
 )
 
-func newMiscStorage(db driver.Database) (miscStorage, error) {
-	coll, err := getOrCreateCollection(db, miscCollectionName)
+func newMiscStorage(db driver.Database, prefix string) (miscStorage, error) {
+	coll, err := getOrCreateCollection(db, prefix+miscCollectionName)
 	if err != nil {
 		return miscStorage{}, err
 	}
@@ -50,22 +50,23 @@ func (s *miscStorage) SetShallow(hashes []plumbing.Hash) error {
 		return err
 	}
 
-	_, err = s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertShallow, map[string]interface{}{
-		"key":     indexKey,
+	return s.upsert(queryUpsertShallow, map[string]interface{}{
+		"key":     shallowKey,
 		"shallow": string(json),
 	})
-	return err
 }
 
 func (s *miscStorage) Shallow() ([]plumbing.Hash, error) {
 	var doc shallowDocument
 	_, err := s.coll.ReadDocument(context.Background(), shallowKey, &doc)
-	if err != nil {
+	if driver.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
 
 	var shallow []plumbing.Hash
-	err = json.Unmarshal([]byte(doc.Shallow), shallow)
+	err = json.Unmarshal([]byte(doc.Shallow), &shallow)
 	return shallow, err
 }
 
@@ -80,18 +81,17 @@ func (s *miscStorage) SetIndex(idx *index.Index) error {
 		return err
 	}
 
-	_, err = s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertIndex, map[string]interface{}{
+	return s.upsert(queryUpsertIndex, map[string]interface{}{
 		"key": indexKey,
 		"idx": string(json),
 	})
-	return err
 }
 
 func (s *miscStorage) Index() (*index.Index, error) {
 	var doc indexDocument
 	_, err := s.coll.ReadDocument(context.Background(), indexKey, &doc)
 	if driver.IsNotFound(err) {
-		return &index.Index{}, nil
+		return &index.Index{Version: 2}, nil
 	} else if err != nil {
 		return nil, err
 	}
@@ -107,16 +107,19 @@ type configDocument struct {
 }
 
 func (s *miscStorage) SetConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
 	json, err := json.Marshal(cfg)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertConfig, map[string]interface{}{
+	return s.upsert(queryUpsertConfig, map[string]interface{}{
 		"key":    configKey,
 		"config": string(json),
 	})
-	return err
 }
 
 func (s *miscStorage) Config() (*config.Config, error) {
@@ -132,3 +135,14 @@ func (s *miscStorage) Config() (*config.Config, error) {
 	err = json.Unmarshal([]byte(doc.Config), cfg)
 	return cfg, err
 }
+
+func (s *miscStorage) upsert(query string, bindVars map[string]interface{}) error {
+	bindVars["@coll"] = s.coll.Name()
+	cursor, err := s.db.Query(driver.WithWaitForSync(context.Background()), query, bindVars)
+	if err != nil {
+		return err
+	}
+
+	closeSilently(cursor)
+	return nil
+}
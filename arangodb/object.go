@@ -1,9 +1,13 @@
 package arangodb
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"unicode/utf8"
 
 	driver "github.com/arangodb/go-driver"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -13,39 +17,71 @@ import (
 const (
 	objectCollectionName = "objects"
 
-	queryReadObjectDocByHash        = "FOR d IN " + objectCollectionName + " FILTER d.hash == @hash RETURN d"
-	queryReadObjectDocByHashAndType = "FOR d IN " + objectCollectionName + " FILTER d.hash == @hash && d.type == @type RETURN d"
-	queryIterAllObjectDocs          = "FOR d IN " + objectCollectionName + " RETURN d"
-	queryIterObjectDocsByType       = "FOR d IN " + objectCollectionName + " FILTER d.type == @type RETURN d"
-	queryUpsertObject               = "UPSERT { hash: @hash, type: @type } INSERT { hash: @hash, type: @type, object: @object } UPDATE { object: @object } IN " + objectCollectionName
+	queryReadObjectDocByHash        = "FOR d IN @@coll FILTER d.hash == @hash RETURN { type: d.type, object: d.object }"
+	queryReadObjectDocByHashAndType = "FOR d IN @@coll FILTER d.hash == @hash && d.type == @type RETURN { type: d.type, object: d.object }"
+	queryIterAllObjectDocs          = "FOR d IN @@coll RETURN { type: d.type, object: d.object }"
+	queryIterObjectDocsByType       = "FOR d IN @@coll FILTER d.type == @type RETURN { type: d.type, object: d.object }"
+	queryReadObjectSizeByHash       = "FOR d IN @@coll FILTER d.hash == @hash RETURN { size: d.size, object: d.size == null ? d.object : null }"
+	queryUpsertObject               = "UPSERT { hash: @hash, type: @type } INSERT { hash: @hash, type: @type, size: @size, object: @object, content: @content, json: @json } UPDATE { size: @size, object: @object, content: @content, json: @json } IN @@coll"
+	queryJSONObjectDocs             = "FOR o IN @@coll FILTER o.hash IN @hashes && o.json != null LET doc = o.json FILTER (%s) SORT o.hash RETURN { hash: o.hash, json: doc }"
 )
 
 var (
 	errTooManyResults    = errors.New("too many results")
 	errInvalidObjectType = errors.New("invalid object type")
+	// ErrReservedBindVar is returned by QueryJSON if the caller sets one of
+	// the bind variables used by the query itself.
+	ErrReservedBindVar = errors.New("reserved bind variable")
 )
 
-func newObjectStorage(db driver.Database) (objectStorage, error) {
-	coll, err := getOrCreateCollection(db, objectCollectionName)
+func newObjectStorage(db driver.Database, prefix string, parseJSON bool, indexContent bool) (objectStorage, error) {
+	coll, err := getOrCreateCollection(db, prefix+objectCollectionName)
+	if err != nil {
+		return objectStorage{}, err
+	}
+
+	// the unique index makes sure concurrent writers of the same object
+	// don't store it twice, UPSERT alone isn't atomic
+	_, _, err = coll.EnsurePersistentIndex(context.Background(), []string{"hash"}, &driver.EnsurePersistentIndexOptions{Unique: true})
 	if err != nil {
 		return objectStorage{}, err
 	}
 
 	return objectStorage{
-		db:   db,
-		coll: coll,
+		db:           db,
+		coll:         coll,
+		parseJSON:    parseJSON,
+		indexContent: indexContent,
 	}, nil
 }
 
 type objectStorage struct {
-	db   driver.Database
-	coll driver.Collection
+	db           driver.Database
+	coll         driver.Collection
+	parseJSON    bool
+	indexContent bool
 }
 
 type objectDocument struct {
 	Hash   string              `json:"hash,omitempty"`
 	Type   plumbing.ObjectType `json:"type,omitempty"`
 	Object []byte              `json:"object,omitempty"`
+	// Size is the length of Object, it is nil for objects stored by older
+	// versions
+	Size *int64 `json:"size,omitempty"`
+	// Content is the content of text blobs as a string, it is indexed by
+	// the objects view for history search. It is only set if the store was
+	// opened with Options.IndexContent.
+	Content string `json:"content,omitempty"`
+	// JSON is the parsed content of blobs that are valid JSON, it is only
+	// set if the store was opened with Options.ParseJSON
+	JSON json.RawMessage `json:"json,omitempty"`
+}
+
+// JSONDocument is a blob stored with its parsed JSON content.
+type JSONDocument struct {
+	Hash string          `json:"hash,omitempty"`
+	JSON json.RawMessage `json:"json,omitempty"`
 }
 
 // NewEncodedObject returns a new plumbing.EncodedObject, the real type
@@ -66,15 +102,24 @@ func (s *objectStorage) SetEncodedObject(o plumbing.EncodedObject) (plumbing.Has
 	}
 
 	h := o.Hash()
-	_, err = s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertObject, map[string]interface{}{
-		"hash":   h.String(),
-		"type":   o.Type(),
-		"object": buf.Bytes(),
+	cursor, err := s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertObject, map[string]interface{}{
+		"@coll":   s.coll.Name(),
+		"hash":    h.String(),
+		"type":    o.Type(),
+		"size":    buf.Len(),
+		"object":  buf.Bytes(),
+		"content": s.textContent(o.Type(), buf.Bytes()),
+		"json":    s.jsonContent(o.Type(), buf.Bytes()),
 	})
-	if err != nil {
+	if driver.IsConflict(err) {
+		// another writer inserted the object in between, objects with the
+		// same hash have the same content
+		return h, nil
+	} else if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
+	closeSilently(cursor)
 	return h, nil
 }
 
@@ -115,10 +160,13 @@ func (s *objectStorage) IterEncodedObjects(t plumbing.ObjectType) (storer.Encode
 	var cursor driver.Cursor
 	var err error
 	if t == plumbing.AnyObject {
-		cursor, err = s.db.Query(context.Background(), queryIterAllObjectDocs, nil)
+		cursor, err = s.db.Query(context.Background(), queryIterAllObjectDocs, map[string]interface{}{
+			"@coll": s.coll.Name(),
+		})
 	} else {
 		cursor, err = s.db.Query(context.Background(), queryIterObjectDocsByType, map[string]interface{}{
-			"type": t,
+			"@coll": s.coll.Name(),
+			"type":  t,
 		})
 	}
 	if err != nil {
@@ -142,40 +190,51 @@ func (s *objectStorage) HasEncodedObject(h plumbing.Hash) error {
 
 // EncodedObjectSize returns the plaintext size of the encoded object.
 func (s *objectStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
-	doc, err := s.readOneDocByHash(h)
-	if err == plumbing.ErrObjectNotFound {
-		return 0, nil
-	} else if err != nil {
+	doc, err := s.readOneDoc(queryReadObjectSizeByHash, map[string]interface{}{
+		"@coll": s.coll.Name(),
+		"hash":  h.String(),
+	})
+	if err != nil {
 		return 0, err
+	} else if doc.Size != nil {
+		return *doc.Size, nil
 	}
 
+	// objects stored before the size was recorded only come with their
+	// content
 	return int64(len(doc.Object)), nil
 }
 
 func (s *objectStorage) readOneDocByHashAndType(h plumbing.Hash, t plumbing.ObjectType) (*objectDocument, error) {
 	return s.readOneDoc(queryReadObjectDocByHashAndType, map[string]interface{}{
-		"hash": h.String(),
-		"type": t,
+		"@coll": s.coll.Name(),
+		"hash":  h.String(),
+		"type":  t,
 	})
 }
 
 func (s *objectStorage) readOneDocByHash(h plumbing.Hash) (*objectDocument, error) {
 	return s.readOneDoc(queryReadObjectDocByHash, map[string]interface{}{
-		"hash": h.String(),
+		"@coll": s.coll.Name(),
+		"hash":  h.String(),
 	})
 }
 
 func (s *objectStorage) readOneDoc(query string, bindVars map[string]interface{}) (*objectDocument, error) {
 	cursor, err := s.db.Query(driver.WithQueryCount(context.Background()), query, bindVars)
-	if driver.IsNotFound(err) || cursor.Count() == 0 {
+	if driver.IsNotFound(err) {
 		return nil, plumbing.ErrObjectNotFound
 	} else if err != nil {
 		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	if cursor.Count() == 0 {
+		return nil, plumbing.ErrObjectNotFound
 	} else if cursor.Count() > 1 {
 		return nil, errTooManyResults
 	}
 
-	defer closeSilently(cursor)
 	var doc *objectDocument
 	_, err = cursor.ReadDocument(context.Background(), &doc)
 	return doc, err
@@ -221,6 +280,76 @@ func (iter *objectIter) Close() {
 	closeSilently(iter.cursor)
 }
 
+// textContent returns the content of text blobs. It returns nil for all
+// other objects or if indexing content is disabled, so that they don't end
+// up in the objects view.
+func (s *objectStorage) textContent(t plumbing.ObjectType, b []byte) interface{} {
+	if !s.indexContent || t != plumbing.BlobObject || !isText(b) {
+		return nil
+	}
+	return string(b)
+}
+
+// isText reports whether b is UTF-8 without NUL bytes.
+func isText(b []byte) bool {
+	return bytes.IndexByte(b, 0) < 0 && utf8.Valid(b)
+}
+
+// jsonContent returns the content of blobs that are valid JSON as a
+// json.RawMessage so that the driver stores it as a document. It returns nil
+// for all other objects or if parsing JSON is disabled.
+func (s *objectStorage) jsonContent(t plumbing.ObjectType, b []byte) interface{} {
+	if !s.parseJSON || t != plumbing.BlobObject || !json.Valid(b) {
+		return nil
+	}
+	return json.RawMessage(b)
+}
+
+// QueryJSON returns the parsed JSON blobs among hashes for which the AQL
+// expression filter is true. The parsed content of a blob is available as
+// doc in filter, e.g. "doc.age > @age". Only blobs stored while parsing JSON
+// was enabled are considered. filter is embedded into the query, so it's
+// rejected with ErrInvalidFilter unless it's a single expression that only
+// reads doc and bind variables.
+func (s *objectStorage) QueryJSON(hashes []plumbing.Hash, filter string, bindVars map[string]interface{}) ([]JSONDocument, error) {
+	err := checkFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]interface{}, len(bindVars)+2)
+	for k, v := range bindVars {
+		if k == "@coll" || k == "hashes" {
+			return nil, ErrReservedBindVar
+		}
+		vars[k] = v
+	}
+
+	hs := make([]string, len(hashes))
+	for i, h := range hashes {
+		hs[i] = h.String()
+	}
+	vars["@coll"] = s.coll.Name()
+	vars["hashes"] = hs
+
+	cursor, err := s.db.Query(context.Background(), fmt.Sprintf(queryJSONObjectDocs, filter), vars)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	var docs []JSONDocument
+	for cursor.HasMore() {
+		var doc JSONDocument
+		_, err = cursor.ReadDocument(context.Background(), &doc)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
 func newEncodedObject() *plumbing.MemoryObject {
 	return &plumbing.MemoryObject{}
 }
@@ -13,15 +13,17 @@ import (
 const (
 	referenceCollectionName = "refs"
 
-	queryReference               = "FOR r IN " + referenceCollectionName + " FILTER r.name == @name RETURN r"
-	queryUpsertReference         = "UPSERT { name: @name } INSERT { name: @name, target: @target } UPDATE { target: @target } IN " + referenceCollectionName
-	queryIterReferenceDocsByType = "FOR r IN " + referenceCollectionName + " RETURN r"
-	queryRemoveReference         = "FOR r IN " + referenceCollectionName + " FILTER r.name == @name REMOVE { _key: r._key } IN " + referenceCollectionName
-	queryAllReferences           = "FOR r IN " + referenceCollectionName + " RETURN r"
+	queryReference               = "FOR r IN @@coll FILTER r.name == @name RETURN r"
+	queryUpsertReference         = "UPSERT { name: @name } INSERT { _key: @key, name: @name, target: @target } UPDATE { target: @target } IN @@coll"
+	queryInsertReference         = "INSERT { _key: @key, name: @name, target: @target } IN @@coll"
+	queryCheckAndSetReference    = "FOR r IN @@coll FILTER r.name == @name && r.target == @old UPDATE r WITH { target: @target } IN @@coll RETURN 1"
+	queryIterReferenceDocsByType = "FOR r IN @@coll RETURN r"
+	queryRemoveReference         = "FOR r IN @@coll FILTER r.name == @name REMOVE { _key: r._key } IN @@coll"
+	queryAllReferences           = "FOR r IN @@coll RETURN r"
 )
 
-func newReferenceStorage(db driver.Database) (referenceStorage, error) {
-	coll, err := getOrCreateCollection(db, referenceCollectionName)
+func newReferenceStorage(db driver.Database, prefix string) (referenceStorage, error) {
+	coll, err := getOrCreateCollection(db, prefix+referenceCollectionName)
 	if err != nil {
 		return referenceStorage{}, err
 	}
@@ -44,39 +46,90 @@ type referenceDocument struct {
 
 func (s *referenceStorage) SetReference(ref *plumbing.Reference) error {
 	parts := ref.Strings()
-	_, err := s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertReference, map[string]interface{}{
+	cursor, err := s.db.Query(driver.WithWaitForSync(context.Background()), queryUpsertReference, map[string]interface{}{
+		"@coll":  s.coll.Name(),
+		"key":    referenceKey(parts[0]),
 		"name":   parts[0],
 		"target": parts[1],
 	})
-	return err
+	if err != nil {
+		return err
+	}
+
+	closeSilently(cursor)
+	return nil
+}
+
+// CreateReference stores ref if there is no reference with the same name
+// yet. It returns storage.ErrReferenceHasChanged otherwise.
+func (s *referenceStorage) CreateReference(ref *plumbing.Reference) error {
+	_, err := s.Reference(ref.Name())
+	if err == nil {
+		return storage.ErrReferenceHasChanged
+	} else if err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	// the key is derived from the name, so concurrent inserts conflict
+	parts := ref.Strings()
+	cursor, err := s.db.Query(driver.WithWaitForSync(context.Background()), queryInsertReference, map[string]interface{}{
+		"@coll":  s.coll.Name(),
+		"key":    referenceKey(parts[0]),
+		"name":   parts[0],
+		"target": parts[1],
+	})
+	if driver.IsConflict(err) {
+		return storage.ErrReferenceHasChanged
+	} else if err != nil {
+		return err
+	}
+
+	closeSilently(cursor)
+	return nil
 }
 
 // CheckAndSetReference sets the reference `new`, but if `old` is
 // not `nil`, it first checks that the current stored value for
 // `old.Name()` matches the given reference value in `old`.  If
 // not, it returns an error and doesn't update `new`.
+//
+// The check and the update run in a single query that only updates the
+// reference if it still has the old value, so concurrent updates can't
+// overwrite each other.
 func (s *referenceStorage) CheckAndSetReference(new, old *plumbing.Reference) error {
 	if new == nil {
 		return nil
+	} else if old == nil {
+		return s.SetReference(new)
+	}
+
+	cursor, err := s.db.Query(driver.WithQueryCount(driver.WithWaitForSync(context.Background())), queryCheckAndSetReference, map[string]interface{}{
+		"@coll":  s.coll.Name(),
+		"name":   old.Name(),
+		"old":    old.Strings()[1],
+		"target": new.Strings()[1],
+	})
+	if driver.IsConflict(err) {
+		return storage.ErrReferenceHasChanged
+	} else if err != nil {
+		return err
 	}
 
-	if old != nil {
-		oldRef, err := s.Reference(old.Name())
+	defer closeSilently(cursor)
+	if cursor.Count() == 0 {
+		_, err = s.Reference(old.Name())
 		if err != nil {
 			return err
 		}
-
-		if oldRef.Hash() != old.Hash() {
-			return storage.ErrReferenceHasChanged
-		}
+		return storage.ErrReferenceHasChanged
 	}
-
-	return s.SetReference(new)
+	return nil
 }
 
 func (s *referenceStorage) Reference(refName plumbing.ReferenceName) (*plumbing.Reference, error) {
 	doc, err := s.readOneDoc(queryReference, map[string]interface{}{
-		"name": refName,
+		"@coll": s.coll.Name(),
+		"name":  refName,
 	})
 	if err != nil {
 		return nil, err
@@ -89,7 +142,9 @@ func (s *referenceStorage) Reference(refName plumbing.ReferenceName) (*plumbing.
 }
 
 func (s *referenceStorage) IterReferences() (storer.ReferenceIter, error) {
-	cursor, err := s.db.Query(context.Background(), queryIterReferenceDocsByType, nil)
+	cursor, err := s.db.Query(context.Background(), queryIterReferenceDocsByType, map[string]interface{}{
+		"@coll": s.coll.Name(),
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -100,14 +155,22 @@ func (s *referenceStorage) IterReferences() (storer.ReferenceIter, error) {
 }
 
 func (s *referenceStorage) RemoveReference(refName plumbing.ReferenceName) error {
-	_, err := s.db.Query(driver.WithWaitForSync(context.Background()), queryRemoveReference, map[string]interface{}{
-		"name": refName,
+	cursor, err := s.db.Query(driver.WithWaitForSync(context.Background()), queryRemoveReference, map[string]interface{}{
+		"@coll": s.coll.Name(),
+		"name":  refName,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+
+	closeSilently(cursor)
+	return nil
 }
 
 func (s *referenceStorage) CountLooseRefs() (int, error) {
-	cursor, err := s.db.Query(driver.WithQueryCount(context.Background()), queryAllReferences, nil)
+	cursor, err := s.db.Query(driver.WithQueryCount(context.Background()), queryAllReferences, map[string]interface{}{
+		"@coll": s.coll.Name(),
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -122,18 +185,22 @@ func (s *referenceStorage) PackRefs() error {
 
 func (s *referenceStorage) readOneDoc(query string, bindVars map[string]interface{}) (*referenceDocument, error) {
 	cursor, err := s.db.Query(driver.WithQueryCount(context.Background()), query, bindVars)
-	if driver.IsNotFound(err) || cursor.Count() == 0 {
+	if driver.IsNotFound(err) {
 		return nil, plumbing.ErrReferenceNotFound
 	} else if err != nil {
 		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	if cursor.Count() == 0 {
+		return nil, plumbing.ErrReferenceNotFound
 	} else if cursor.Count() > 1 {
 		return nil, errTooManyResults
 	}
 
-	defer closeSilently(cursor)
 	var doc *referenceDocument
 	_, err = cursor.ReadDocument(context.Background(), &doc)
-	return doc, nil
+	return doc, err
 }
 
 type referenceIter struct {
@@ -172,3 +239,9 @@ func (iter *referenceIter) ForEach(f func(*plumbing.Reference) error) error {
 func (iter *referenceIter) Close() {
 	closeSilently(iter.cursor)
 }
+
+// referenceKey returns the key of the document that stores the reference
+// called name.
+func referenceKey(name string) string {
+	return pathKey(name)
+}
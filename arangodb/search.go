@@ -0,0 +1,374 @@
+package arangodb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const (
+	searchCollectionName = "search_indexes"
+	objectViewName       = "objects_view"
+
+	// DefaultSearchAnalyzer is used when a search doesn't ask for a
+	// specific analyzer.
+	DefaultSearchAnalyzer = "text_en"
+
+	searchContentField = "content"
+
+	queryIterSearchIndexDocs = "FOR d IN @@coll RETURN d"
+	queryUpsertSearchIndex   = "UPSERT { _key: @key } INSERT { _key: @key, ref: @ref, commit: @commit } UPDATE { commit: @commit } IN @@coll"
+	queryUpsertSearchDoc     = "UPSERT { _key: @key } INSERT { _key: @key, path: @path, hash: @hash, content: @content } UPDATE { path: @path, hash: @hash, content: @content } IN @@coll"
+	querySearchHistory       = "FOR d IN @@view SEARCH ANALYZER(d.content IN TOKENS(@terms, @analyzer), @analyzer) OPTIONS { waitForSync: true } LET changes = (FOR p IN @@paths FILTER p.blob == d.hash && p.commit IN @commits RETURN p) FILTER LENGTH(changes) > 0 SORT BM25(d) DESC, d.hash LIMIT @offset, @limit RETURN { hash: d.hash, content: d.content, score: BM25(d), changes: changes }"
+	querySearch              = "FOR d IN @@view SEARCH ANALYZER(d.content IN TOKENS(@terms, @analyzer), @analyzer) OPTIONS { waitForSync: true } SORT BM25(d) DESC, d.path LIMIT @offset, @limit RETURN { path: d.path, hash: d.hash, content: d.content, score: BM25(d) }"
+)
+
+// ErrContentNotIndexed is returned by SearchHistory if the store wasn't
+// opened with Options.IndexContent.
+var ErrContentNotIndexed = errors.New("content not indexed")
+
+// SearchDocument is a file as it is stored in a search index.
+type SearchDocument struct {
+	Path    string `json:"path,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// SearchQuery -
+type SearchQuery struct {
+	// Terms is the text to search for, it's tokenized by Analyzer
+	Terms string
+	// Analyzer defaults to DefaultSearchAnalyzer
+	Analyzer string
+	Offset   int
+	Limit    int
+}
+
+// SearchHit is a file matching a SearchQuery.
+type SearchHit struct {
+	SearchDocument
+	Score float64 `json:"score"`
+}
+
+// HistoryHit is a text blob matching a history search. Changes are the
+// entries of the path index that set a file to the blob.
+type HistoryHit struct {
+	SearchHit
+	Changes []PathChange `json:"changes"`
+}
+
+func newSearchStorage(db driver.Database, prefix string) (searchStorage, error) {
+	coll, err := getOrCreateCollection(db, prefix+searchCollectionName)
+	if err != nil {
+		return searchStorage{}, err
+	}
+
+	return searchStorage{
+		db:     db,
+		coll:   coll,
+		prefix: prefix,
+	}, nil
+}
+
+// searchStorage maintains one collection and one ArangoSearch view per
+// indexed ref. The coll collection records which commit each index is at.
+type searchStorage struct {
+	db     driver.Database
+	coll   driver.Collection
+	prefix string
+}
+
+type searchIndexDocument struct {
+	Key    string `json:"_key,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+}
+
+// refKey returns the document key used for per-ref metadata.
+func refKey(ref plumbing.ReferenceName) string {
+	h := sha1.Sum([]byte(ref))
+	return hex.EncodeToString(h[:8])
+}
+
+func pathKey(path string) string {
+	h := sha1.Sum([]byte(path))
+	return hex.EncodeToString(h[:])
+}
+
+func (s *searchStorage) searchCollectionName(ref plumbing.ReferenceName) string {
+	return s.prefix + "search_" + refKey(ref)
+}
+
+func (s *searchStorage) searchViewName(ref plumbing.ReferenceName) string {
+	return s.searchCollectionName(ref) + "_view"
+}
+
+// SearchIndexCommit returns the commit the search index of ref is at. It
+// returns plumbing.ZeroHash if ref isn't indexed.
+func (s *searchStorage) SearchIndexCommit(ref plumbing.ReferenceName) (plumbing.Hash, error) {
+	var doc searchIndexDocument
+	_, err := s.coll.ReadDocument(context.Background(), refKey(ref), &doc)
+	if driver.IsNotFound(err) {
+		return plumbing.ZeroHash, nil
+	} else if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return plumbing.NewHash(doc.Commit), nil
+}
+
+// SearchIndexRefs returns all refs that have a search index.
+func (s *searchStorage) SearchIndexRefs() ([]plumbing.ReferenceName, error) {
+	cursor, err := s.db.Query(context.Background(), queryIterSearchIndexDocs, map[string]interface{}{
+		"@coll": s.coll.Name(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	var refs []plumbing.ReferenceName
+	for cursor.HasMore() {
+		var doc searchIndexDocument
+		_, err = cursor.ReadDocument(context.Background(), &doc)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, plumbing.ReferenceName(doc.Ref))
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	return refs, nil
+}
+
+// UpdateSearchIndex writes upserts to and removes the files at deletes from
+// the search index of ref and records that the index is at commit. The
+// index is created if it doesn't exist yet.
+func (s *searchStorage) UpdateSearchIndex(ref plumbing.ReferenceName, commit plumbing.Hash, upserts []SearchDocument, deletes []string) error {
+	coll, err := getOrCreateCollection(s.db, s.searchCollectionName(ref))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.searchView(ref, DefaultSearchAnalyzer)
+	if err != nil {
+		return err
+	}
+
+	ctx := driver.WithWaitForSync(context.Background())
+	for _, path := range deletes {
+		_, err = coll.RemoveDocument(ctx, pathKey(path))
+		if err != nil && !driver.IsNotFound(err) {
+			return err
+		}
+	}
+
+	for _, doc := range upserts {
+		cursor, err := s.db.Query(ctx, queryUpsertSearchDoc, map[string]interface{}{
+			"@coll":   coll.Name(),
+			"key":     pathKey(doc.Path),
+			"path":    doc.Path,
+			"hash":    doc.Hash,
+			"content": doc.Content,
+		})
+		if err != nil {
+			return err
+		}
+		closeSilently(cursor)
+	}
+
+	// the commit is recorded last so that an interrupted update is redone
+	// the next time the index is brought up to date
+	cursor, err := s.db.Query(ctx, queryUpsertSearchIndex, map[string]interface{}{
+		"@coll":  s.coll.Name(),
+		"key":    refKey(ref),
+		"ref":    ref.String(),
+		"commit": commit.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	closeSilently(cursor)
+	return nil
+}
+
+// DropSearchIndex removes the search index of ref including its view.
+func (s *searchStorage) DropSearchIndex(ref plumbing.ReferenceName) error {
+	ctx := context.Background()
+	view, err := s.db.View(ctx, s.searchViewName(ref))
+	if err == nil {
+		err = view.Remove(ctx)
+	}
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+
+	coll, err := s.db.Collection(ctx, s.searchCollectionName(ref))
+	if err == nil {
+		err = coll.Remove(ctx)
+	}
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+
+	_, err = s.coll.RemoveDocument(ctx, refKey(ref))
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Search runs q against the search index of ref. Hits are ordered by
+// descending relevance.
+func (s *searchStorage) Search(ref plumbing.ReferenceName, q SearchQuery) ([]SearchHit, error) {
+	analyzer := q.Analyzer
+	if analyzer == "" {
+		analyzer = DefaultSearchAnalyzer
+	}
+
+	view, err := s.searchView(ref, analyzer)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.db.Query(context.Background(), querySearch, map[string]interface{}{
+		"@view":    view.Name(),
+		"terms":    q.Terms,
+		"analyzer": analyzer,
+		"offset":   q.Offset,
+		"limit":    q.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	var hits []SearchHit
+	for cursor.HasMore() {
+		var hit SearchHit
+		_, err = cursor.ReadDocument(context.Background(), &hit)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// searchView returns the view over the search collection of ref and makes
+// sure the content field is indexed with analyzer.
+func (s *searchStorage) searchView(ref plumbing.ReferenceName, analyzer string) (driver.ArangoSearchView, error) {
+	return s.contentView(s.searchViewName(ref), s.searchCollectionName(ref), analyzer)
+}
+
+// contentView returns the view called viewName over the content field of
+// collName. The view is created if it doesn't exist and analyzer is added
+// to the analyzers of the field if it's missing.
+func (s *searchStorage) contentView(viewName string, collName string, analyzer string) (driver.ArangoSearchView, error) {
+	ctx := context.Background()
+	exists, err := s.db.ViewExists(ctx, viewName)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return s.db.CreateArangoSearchView(ctx, viewName, &driver.ArangoSearchViewProperties{
+			Links: driver.ArangoSearchLinks{
+				collName: searchLink(analyzer),
+			},
+		})
+	}
+
+	v, err := s.db.View(ctx, viewName)
+	if err != nil {
+		return nil, err
+	}
+
+	view, err := v.ArangoSearchView()
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := view.Properties(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	analyzers := props.Links[collName].Fields[searchContentField].Analyzers
+	for _, a := range analyzers {
+		if a == analyzer {
+			return view, nil
+		}
+	}
+
+	err = view.SetProperties(ctx, driver.ArangoSearchViewProperties{
+		Links: driver.ArangoSearchLinks{
+			collName: searchLink(append(analyzers, analyzer)...),
+		},
+	})
+	return view, err
+}
+
+func searchLink(analyzers ...string) driver.ArangoSearchElementProperties {
+	return driver.ArangoSearchElementProperties{
+		Fields: driver.ArangoSearchFields{
+			searchContentField: driver.ArangoSearchElementProperties{
+				Analyzers: analyzers,
+			},
+		},
+	}
+}
+
+// SearchHistory runs q against the text blobs that commits set a file to
+// according to the path index, best matches first. Offset and Limit count
+// blobs. The Path of the returned hits is empty, the paths are in Changes.
+// Only blobs stored with Options.IndexContent are found.
+func (s *arangoStore) SearchHistory(q SearchQuery, commits []plumbing.Hash) ([]HistoryHit, error) {
+	if !s.options.IndexContent {
+		return nil, ErrContentNotIndexed
+	}
+
+	analyzer := q.Analyzer
+	if analyzer == "" {
+		analyzer = DefaultSearchAnalyzer
+	}
+
+	view, err := s.contentView(s.prefix+objectViewName, s.prefix+objectCollectionName, analyzer)
+	if err != nil {
+		return nil, err
+	}
+
+	hs := make([]string, len(commits))
+	for i, h := range commits {
+		hs[i] = h.String()
+	}
+
+	cursor, err := s.db.Query(context.Background(), querySearchHistory, map[string]interface{}{
+		"@view":    view.Name(),
+		"@paths":   s.pathColl.Name(),
+		"terms":    q.Terms,
+		"analyzer": analyzer,
+		"commits":  hs,
+		"offset":   q.Offset,
+		"limit":    q.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	var hits []HistoryHit
+	for cursor.HasMore() {
+		var hit HistoryHit
+		_, err = cursor.ReadDocument(context.Background(), &hit)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
@@ -0,0 +1,117 @@
+package arangodb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+const (
+	queryReadCollectionDocs      = "FOR d IN @@coll SORT d._key RETURN UNSET(d, '_id', '_rev')"
+	queryReadCollectionDocsByKey = "FOR d IN @@coll FILTER d._key IN @keys SORT d._key RETURN UNSET(d, '_id', '_rev')"
+	queryReadCollectionRevisions = "FOR d IN @@coll RETURN { key: d._key, rev: d._rev }"
+	queryReplaceDocByKey         = "UPSERT { _key: @key } INSERT @doc REPLACE @doc IN @@coll"
+)
+
+// CollectionDocuments returns all documents of the collection called name
+// ordered by key. The _id and _rev attributes are left out as they change
+// without the content of a document changing.
+func (s *arangoStore) CollectionDocuments(name string) ([]json.RawMessage, error) {
+	return s.readDocuments(queryReadCollectionDocs, map[string]interface{}{
+		"@coll": name,
+	})
+}
+
+// CollectionDocumentsByKey is like CollectionDocuments but only returns the
+// documents with the given keys.
+func (s *arangoStore) CollectionDocumentsByKey(name string, keys []string) ([]json.RawMessage, error) {
+	return s.readDocuments(queryReadCollectionDocsByKey, map[string]interface{}{
+		"@coll": name,
+		"keys":  keys,
+	})
+}
+
+// CollectionRevisions returns the revision of each document in the
+// collection called name by key.
+func (s *arangoStore) CollectionRevisions(name string) (map[string]string, error) {
+	cursor, err := s.db.Query(context.Background(), queryReadCollectionRevisions, map[string]interface{}{
+		"@coll": name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	revs := map[string]string{}
+	for cursor.HasMore() {
+		var doc struct {
+			Key string `json:"key"`
+			Rev string `json:"rev"`
+		}
+		_, err = cursor.ReadDocument(context.Background(), &doc)
+		if err != nil {
+			return nil, err
+		}
+		revs[doc.Key] = doc.Rev
+	}
+	return revs, nil
+}
+
+func (s *arangoStore) readDocuments(query string, bindVars map[string]interface{}) ([]json.RawMessage, error) {
+	cursor, err := s.db.Query(context.Background(), query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeSilently(cursor)
+	var docs []json.RawMessage
+	for cursor.HasMore() {
+		var doc json.RawMessage
+		_, err = cursor.ReadDocument(context.Background(), &doc)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// ReplaceDocuments replaces the documents of the collection called name
+// that have the keys of docs by docs, inserting missing ones, and removes
+// the documents with the keys in removes. All changes are made in a single
+// transaction.
+func (s *arangoStore) ReplaceDocuments(name string, docs map[string]json.RawMessage, removes []string) error {
+	coll, err := s.db.Collection(context.Background(), name)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return s.transaction([]string{name}, func(ctx context.Context) error {
+		for _, key := range removes {
+			_, err := coll.RemoveDocument(ctx, key)
+			if err != nil && !driver.IsNotFound(err) {
+				return err
+			}
+		}
+
+		for _, key := range keys {
+			err := s.query(ctx, queryReplaceDocByKey, map[string]interface{}{
+				"@coll": name,
+				"key":   key,
+				"doc":   docs[key],
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,24 +1,79 @@
 package arangodb
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
 	driver "github.com/arangodb/go-driver"
 	"github.com/arangodb/go-driver/http"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/storage"
 )
 
 // ArangoStore -
 type ArangoStore interface {
 	storage.Storer
+
+	CreateReference(ref *plumbing.Reference) error
+	SearchIndexCommit(ref plumbing.ReferenceName) (plumbing.Hash, error)
+	SearchIndexRefs() ([]plumbing.ReferenceName, error)
+	UpdateSearchIndex(ref plumbing.ReferenceName, commit plumbing.Hash, upserts []SearchDocument, deletes []string) error
+	DropSearchIndex(ref plumbing.ReferenceName) error
+	Search(ref plumbing.ReferenceName, q SearchQuery) ([]SearchHit, error)
+	SearchHistory(q SearchQuery, commits []plumbing.Hash) ([]HistoryHit, error)
+	CollectionDocuments(name string) ([]json.RawMessage, error)
+	CollectionDocumentsByKey(name string, keys []string) ([]json.RawMessage, error)
+	CollectionRevisions(name string) (map[string]string, error)
+	ReplaceDocuments(name string, docs map[string]json.RawMessage, removes []string) error
+	QueryJSON(hashes []plumbing.Hash, filter string, bindVars map[string]interface{}) ([]JSONDocument, error)
+	PathChanges(path string) ([]PathChange, error)
+	DirChanges(dir string) ([]PathChange, error)
+	IndexPaths(commits []plumbing.Hash) (bool, error)
+	SyncMaterialized() error
+}
+
+// Options configures an arango git store.
+type Options struct {
+	// ParseJSON makes the store keep a parsed copy of every blob that is
+	// valid JSON next to its raw bytes, so that it can be queried with AQL
+	ParseJSON bool
+	// IndexContent makes the store keep the content of text blobs as a
+	// string, so that it can be searched with SearchHistory
+	IndexContent bool
+	// Materialize maps full reference names, e.g. refs/heads/master, to
+	// the names of collections that hold one document per file of the
+	// commit the reference points to. The collections are updated
+	// whenever a reference they resolve through changes, see
+	// SyncMaterialized. Collections that hold documents which weren't
+	// materialized are refused with ErrCollectionNotMaterialized.
+	Materialize map[string]string
 }
 
 type arangoStore struct {
 	conn   driver.Connection
 	client driver.Client
 	db     driver.Database
+	// prefix is prepended to all collection names, it is empty for the
+	// main repository and set for submodules
+	prefix  string
+	options Options
+	// materializedColl records the commit the collection of each
+	// materialized ref is at, it is nil if no ref is materialized
+	materializedColl driver.Collection
+	// materializeMu serializes updates of the materialized collections
+	materializeMu sync.Mutex
+	// materializeErr is the error of the last failed update of the
+	// materialized collections, see SyncMaterialized
+	materializeErr error
+	// pathColl is the path index, see PathChange
+	pathColl driver.Collection
 
 	objectStorage
 	referenceStorage
 	miscStorage
+	searchStorage
 }
 
 // NewStore creates a new arango git store and sets it up for use by go-git
@@ -33,29 +88,80 @@ func NewStore(connURL string, dbName string) (ArangoStore, bool, error) {
 		return nil, false, err
 	}
 
-	os, err := newObjectStorage(db)
+	s, err := newStore(db, "", Options{})
 	if err != nil {
 		return nil, false, err
 	}
 
-	rs, err := newReferenceStorage(db)
+	s.conn = conn
+	s.client = c
+	return s, created, nil
+}
+
+// NewStoreFromDatabase creates a new arango git store on top of an existing
+// database handle. This is useful when the caller manages connections
+// itself or wants to run against a stand-in like the one in arangotest.
+func NewStoreFromDatabase(db driver.Database) (ArangoStore, error) {
+	return newStore(db, "", Options{})
+}
+
+// NewStoreFromDatabaseWithOptions is like NewStoreFromDatabase but allows
+// configuring the store.
+func NewStoreFromDatabaseWithOptions(db driver.Database, opts Options) (ArangoStore, error) {
+	return newStore(db, "", opts)
+}
+
+func newStore(db driver.Database, prefix string, opts Options) (*arangoStore, error) {
+	os, err := newObjectStorage(db, prefix, opts.ParseJSON, opts.IndexContent)
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
 
-	ms, err := newMiscStorage(db)
+	rs, err := newReferenceStorage(db, prefix)
 	if err != nil {
-		return nil, false, err
+		return nil, err
+	}
+
+	ms, err := newMiscStorage(db, prefix)
+	if err != nil {
+		return nil, err
 	}
 
-	return &arangoStore{
-		conn:             conn,
-		client:           c,
+	ss, err := newSearchStorage(db, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := newPathCollection(db, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &arangoStore{
 		db:               db,
+		prefix:           prefix,
+		options:          opts,
 		objectStorage:    os,
 		referenceStorage: rs,
 		miscStorage:      ms,
-	}, created, nil
+		searchStorage:    ss,
+		pathColl:         pc,
+	}
+	if len(opts.Materialize) == 0 {
+		return s, nil
+	}
+
+	s.materializedColl, err = getOrCreateCollection(db, prefix+materializedCollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	// catch up with commits made while materializing was off
+	err = s.SyncMaterialized()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 func newConnectionAndClient(url string) (driver.Connection, driver.Client, error) {
@@ -78,6 +184,20 @@ func newConnectionAndClient(url string) (driver.Connection, driver.Client, error
 	return conn, c, nil
 }
 
+// Module returns the store of a submodule. Submodules live in the same
+// database as their parent in collections with a prefix derived from the
+// module name.
 func (s *arangoStore) Module(name string) (storage.Storer, error) {
-	return nil, nil
+	h := sha1.Sum([]byte(name))
+	ms, err := newStore(s.db, s.prefix+"module_"+hex.EncodeToString(h[:8])+"_", Options{
+		ParseJSON:    s.options.ParseJSON,
+		IndexContent: s.options.IndexContent,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ms.conn = s.conn
+	ms.client = s.client
+	return ms, nil
 }
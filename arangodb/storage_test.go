@@ -0,0 +1,296 @@
+package arangodb
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/test"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+// StorageSuite runs go-git's storer conformance tests against an arangoStore
+// backed by the in-memory database fake.
+type StorageSuite struct {
+	test.BaseStorageSuite
+}
+
+var _ = Suite(&StorageSuite{})
+
+func (s *StorageSuite) SetUpTest(c *C) {
+	store, err := NewStoreFromDatabase(arangotest.NewDatabase("test"))
+	c.Assert(err, IsNil)
+	s.BaseStorageSuite = test.NewBaseStorageSuite(store)
+}
+
+func (s *StorageSuite) TestEncodedObjectSize(c *C) {
+	o := s.Storer.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	w, err := o.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("hello"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	h, err := s.Storer.SetEncodedObject(o)
+	c.Assert(err, IsNil)
+
+	size, err := s.Storer.EncodedObjectSize(h)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(5))
+
+	_, err = s.Storer.EncodedObjectSize(plumbing.ZeroHash)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+
+	// objects stored without their size
+	db := arangotest.NewDatabase("test")
+	store, err := NewStoreFromDatabase(db)
+	c.Assert(err, IsNil)
+	coll, err := db.Collection(context.Background(), objectCollectionName)
+	c.Assert(err, IsNil)
+	_, err = coll.CreateDocument(context.Background(), objectDocument{Hash: h.String(), Type: plumbing.BlobObject, Object: []byte("hello")})
+	c.Assert(err, IsNil)
+
+	size, err = store.EncodedObjectSize(h)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(5))
+}
+
+func (s *StorageSuite) TestCreateReference(c *C) {
+	store := s.Storer.(ArangoStore)
+	ref := plumbing.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	c.Assert(store.CreateReference(ref), IsNil)
+
+	other := plumbing.NewReferenceFromStrings("refs/heads/foo", "482e0eada5de4039e6f216b45b3c9b683b83bfa")
+	c.Assert(store.CreateReference(other), Equals, storage.ErrReferenceHasChanged)
+
+	stored, err := store.Reference("refs/heads/foo")
+	c.Assert(err, IsNil)
+	c.Assert(stored.Hash(), Equals, ref.Hash())
+}
+
+func (s *StorageSuite) TestCheckAndSetReferenceConcurrently(c *C) {
+	old := plumbing.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	c.Assert(s.Storer.SetReference(old), IsNil)
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h := plumbing.ComputeHash(plumbing.BlobObject, []byte{byte(i)})
+			errs <- s.Storer.CheckAndSetReference(plumbing.NewHashReference(old.Name(), h), old)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			c.Assert(err, Equals, storage.ErrReferenceHasChanged)
+		}
+	}
+	c.Assert(succeeded, Equals, 1)
+}
+
+func (s *StorageSuite) TestSetEncodedObjectConcurrently(c *C) {
+	db := arangotest.NewDatabase("test")
+	store, err := NewStoreFromDatabase(db)
+	c.Assert(err, IsNil)
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := store.NewEncodedObject()
+			o.SetType(plumbing.BlobObject)
+			w, err := o.Writer()
+			if err == nil {
+				_, err = w.Write([]byte("0"))
+			}
+			if err == nil {
+				_, err = store.SetEncodedObject(o)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Assert(err, IsNil)
+	}
+
+	h := plumbing.ComputeHash(plumbing.BlobObject, []byte("0"))
+	_, err = store.EncodedObject(plumbing.BlobObject, h)
+	c.Assert(err, IsNil)
+
+	// the index rejects a second document for the same hash
+	coll, err := db.Collection(context.Background(), objectCollectionName)
+	c.Assert(err, IsNil)
+	_, err = coll.CreateDocument(context.Background(), objectDocument{Hash: h.String(), Type: plumbing.BlobObject})
+	c.Assert(driver.IsConflict(err), Equals, true)
+}
+
+func (s *StorageSuite) TestIndexPathsOfCommitsStoredFirst(c *C) {
+	store := s.Storer.(ArangoStore)
+	blob := store.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("a"))
+	c.Assert(err, IsNil)
+
+	tree := &object.Tree{Entries: []object.TreeEntry{{Name: "a.txt", Mode: filemode.Regular, Hash: blob.Hash()}}}
+	treeObj := store.NewEncodedObject()
+	c.Assert(tree.Encode(treeObj), IsNil)
+	commit := &object.Commit{TreeHash: treeObj.Hash(), Message: "a"}
+	commitObj := store.NewEncodedObject()
+	c.Assert(commit.Encode(commitObj), IsNil)
+
+	// packs list commits before their trees
+	for _, o := range []plumbing.EncodedObject{commitObj, treeObj, blob} {
+		_, err = store.SetEncodedObject(o)
+		c.Assert(err, IsNil)
+	}
+	changes, err := store.PathChanges("a.txt")
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 0)
+
+	added, err := store.IndexPaths([]plumbing.Hash{commitObj.Hash()})
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, true)
+	changes, err = store.PathChanges("a.txt")
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].Commit, Equals, commitObj.Hash().String())
+	c.Assert(changes[0].Blob, Equals, blob.Hash().String())
+
+	// indexing again doesn't duplicate the changes
+	added, err = store.IndexPaths([]plumbing.Hash{commitObj.Hash()})
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, false)
+	changes, err = store.PathChanges("a.txt")
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+}
+
+func (s *StorageSuite) TestIndexContent(c *C) {
+	for _, indexContent := range []bool{false, true} {
+		db := arangotest.NewDatabase("test")
+		store, err := NewStoreFromDatabaseWithOptions(db, Options{IndexContent: indexContent})
+		c.Assert(err, IsNil)
+
+		o := store.NewEncodedObject()
+		o.SetType(plumbing.BlobObject)
+		w, err := o.Writer()
+		c.Assert(err, IsNil)
+		_, err = w.Write([]byte("some text"))
+		c.Assert(err, IsNil)
+		h, err := store.SetEncodedObject(o)
+		c.Assert(err, IsNil)
+
+		coll, err := db.Collection(context.Background(), objectCollectionName)
+		c.Assert(err, IsNil)
+		cursor, err := db.Query(context.Background(), "FOR d IN @@coll RETURN d", map[string]interface{}{"@coll": coll.Name()})
+		c.Assert(err, IsNil)
+		var doc objectDocument
+		_, err = cursor.ReadDocument(context.Background(), &doc)
+		c.Assert(err, IsNil)
+		c.Assert(doc.Content != "", Equals, indexContent)
+
+		_, err = store.SearchHistory(SearchQuery{Terms: "text"}, nil)
+		if indexContent {
+			c.Assert(err, IsNil)
+		} else {
+			c.Assert(err, Equals, ErrContentNotIndexed)
+		}
+
+		// reads only fetch the raw object
+		cursor, err = db.Query(context.Background(), queryReadObjectDocByHash, map[string]interface{}{"@coll": coll.Name(), "hash": h.String()})
+		c.Assert(err, IsNil)
+		var raw map[string]interface{}
+		_, err = cursor.ReadDocument(context.Background(), &raw)
+		c.Assert(err, IsNil)
+		c.Assert(raw["content"], IsNil)
+		c.Assert(raw["object"], NotNil)
+	}
+}
+
+func (s *StorageSuite) TestMaterialize(c *C) {
+	ctx := context.Background()
+	db := arangotest.NewDatabase("test")
+	users, err := db.CreateCollection(ctx, "users", nil)
+	c.Assert(err, IsNil)
+	_, err = users.CreateDocument(ctx, map[string]interface{}{"_key": "a"})
+	c.Assert(err, IsNil)
+
+	// collections with other documents aren't emptied
+	_, err = NewStoreFromDatabaseWithOptions(db, Options{Materialize: map[string]string{"refs/heads/master": "users"}})
+	c.Assert(err, Equals, ErrCollectionNotMaterialized)
+	n, err := users.Count(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(1))
+
+	store, err := NewStoreFromDatabaseWithOptions(db, Options{Materialize: map[string]string{
+		"HEAD":             "head_files",
+		"refs/heads/other": "other_files",
+	}})
+	c.Assert(err, IsNil)
+	c.Assert(store.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master")), IsNil)
+
+	blob := store.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("a"))
+	c.Assert(err, IsNil)
+	tree := &object.Tree{Entries: []object.TreeEntry{{Name: "a.txt", Mode: filemode.Regular, Hash: blob.Hash()}}}
+	treeObj := store.NewEncodedObject()
+	c.Assert(tree.Encode(treeObj), IsNil)
+	commit := &object.Commit{TreeHash: treeObj.Hash(), Message: "a"}
+	commitObj := store.NewEncodedObject()
+	c.Assert(commit.Encode(commitObj), IsNil)
+	for _, o := range []plumbing.EncodedObject{blob, treeObj, commitObj} {
+		_, err = store.SetEncodedObject(o)
+		c.Assert(err, IsNil)
+	}
+
+	// the collection of HEAD follows the branch HEAD points to
+	c.Assert(store.SetReference(plumbing.NewHashReference("refs/heads/master", commitObj.Hash())), IsNil)
+	count := func(name string) int64 {
+		coll, err := db.Collection(ctx, name)
+		c.Assert(err, IsNil)
+		n, err := coll.Count(ctx)
+		c.Assert(err, IsNil)
+		return n
+	}
+	c.Assert(count("head_files"), Equals, int64(1))
+
+	// the ref is written even if its collection can't be updated
+	missing := plumbing.NewHashReference("refs/heads/other", plumbing.ComputeHash(plumbing.CommitObject, []byte("missing")))
+	c.Assert(store.SetReference(missing), IsNil)
+	ref, err := store.Reference("refs/heads/other")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, missing.Hash())
+	c.Assert(store.SyncMaterialized(), Equals, plumbing.ErrObjectNotFound)
+
+	c.Assert(store.SetReference(plumbing.NewHashReference("refs/heads/other", commitObj.Hash())), IsNil)
+	c.Assert(store.SyncMaterialized(), IsNil)
+	c.Assert(count("other_files"), Equals, int64(1))
+}
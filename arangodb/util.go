@@ -43,6 +43,9 @@ func getOrCreateCollection(db driver.Database, collectionName string) (driver.Co
 	} else {
 		coll, err = db.CreateCollection(ctx, collectionName, &driver.CreateCollectionOptions{})
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	return coll, nil
 }
@@ -0,0 +1,197 @@
+package arangit
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+var (
+	// ErrBranchExists -
+	ErrBranchExists = errors.New("branch already exists")
+	// ErrBranchNotFound -
+	ErrBranchNotFound = errors.New("branch not found")
+	// ErrBranchCheckedOut is returned when deleting the branch HEAD points to.
+	ErrBranchCheckedOut = errors.New("branch is checked out")
+	// ErrInvalidBranchName -
+	ErrInvalidBranchName = errors.New("invalid branch name")
+)
+
+// CreateBranch creates the branch called name at the revision rev, which
+// defaults to HEAD. It returns ErrBranchExists if the branch exists already.
+func (r *repository) CreateBranch(name string, rev string) error {
+	branch, err := branchReferenceName(name)
+	if err != nil {
+		return err
+	}
+
+	if rev == "" {
+		rev = plumbing.HEAD.String()
+	}
+	h, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return err
+	}
+
+	defer r.lockRef(branch)()
+	err = r.store.CreateReference(plumbing.NewHashReference(branch, *h))
+	if err == storage.ErrReferenceHasChanged {
+		return ErrBranchExists
+	}
+	return err
+}
+
+// DeleteBranch deletes the branch called name. The branch HEAD points to
+// can't be deleted.
+func (r *repository) DeleteBranch(name string) error {
+	branch, err := branchReferenceName(name)
+	if err != nil {
+		return err
+	}
+
+	err = r.deleteBranch(branch)
+	if err != nil {
+		return err
+	}
+	return r.updateSearchIndexes()
+}
+
+func (r *repository) deleteBranch(branch plumbing.ReferenceName) error {
+	defer r.lockRef(branch)()
+	r.locks.worktree.Lock()
+	defer r.locks.worktree.Unlock()
+
+	_, err := r.repo.Reference(branch, false)
+	if err == plumbing.ErrReferenceNotFound {
+		return ErrBranchNotFound
+	} else if err != nil {
+		return err
+	}
+
+	head, err := r.repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return err
+	} else if head.Type() == plumbing.SymbolicReference && head.Target() == branch {
+		return ErrBranchCheckedOut
+	}
+
+	return r.store.RemoveReference(branch)
+}
+
+// ListBranches returns the names of all branches in alphabetical order.
+func (r *repository) ListBranches() ([]string, error) {
+	iter, err := r.repo.Branches()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// CheckoutBranch points HEAD to the branch called name and updates the
+// worktree. It fails if the worktree has uncommitted changes.
+func (r *repository) CheckoutBranch(name string) error {
+	branch, err := branchReferenceName(name)
+	if err != nil {
+		return err
+	}
+
+	r.locks.worktree.Lock()
+	defer r.locks.worktree.Unlock()
+
+	_, err = r.repo.Reference(branch, false)
+	if err == plumbing.ErrReferenceNotFound {
+		return ErrBranchNotFound
+	} else if err != nil {
+		return err
+	}
+
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return wt.Checkout(&git.CheckoutOptions{
+		Branch: branch,
+	})
+}
+
+// CommitFileToBranch commits the content read from rdr to path on the
+// branch called name without touching the worktree, unless the branch is
+// checked out. opts can be nil, the message defaults to "Update <path>".
+// The branch has to exist, except for the branch HEAD points to in a
+// repository without commits.
+func (r *repository) CommitFileToBranch(name string, path string, rdr io.Reader, opts *CommitOptions) error {
+	branch, err := branchReferenceName(name)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return err
+	}
+
+	info := r.commitInfo(opts, "Update "+path)
+	_, err = r.commitChanges(branch, []fileChange{{Path: path, Content: content}}, info, r.branchExists(branch))
+	if err == ErrNothingToCommit {
+		return nil
+	}
+	return err
+}
+
+// branchExists returns a check for commitChanges that fails with
+// ErrBranchNotFound if branch doesn't exist, unless HEAD points to it in a
+// repository without commits.
+func (r *repository) branchExists(branch plumbing.ReferenceName) func(*object.Tree) error {
+	return func(tree *object.Tree) error {
+		if tree != nil {
+			return nil
+		}
+
+		head, err := r.repo.Reference(plumbing.HEAD, false)
+		if err != nil {
+			return err
+		} else if head.Type() != plumbing.SymbolicReference || head.Target() != branch {
+			return ErrBranchNotFound
+		}
+		return nil
+	}
+}
+
+// branchReferenceName returns the full reference name of the branch called
+// name. It rejects names git wouldn't accept.
+func branchReferenceName(name string) (plumbing.ReferenceName, error) {
+	name = strings.TrimPrefix(name, "refs/heads/")
+	if name == "" || name == "HEAD" || strings.HasPrefix(name, "-") ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "//") ||
+		strings.Contains(name, "@{") || strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return "", ErrInvalidBranchName
+	}
+
+	for _, c := range name {
+		if c < 0x20 {
+			return "", ErrInvalidBranchName
+		}
+	}
+	return plumbing.NewBranchReferenceName(name), nil
+}
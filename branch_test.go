@@ -0,0 +1,147 @@
+package arangit
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranches(t *testing.T) {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("a.txt", bytes.NewBufferString("master"))
+	assert.Nil(t, err)
+
+	err = repo.CreateBranch("team/a", "")
+	assert.Nil(t, err)
+	err = repo.CreateBranch("team/a", "")
+	assert.Equal(t, ErrBranchExists, err)
+	err = repo.CreateBranch("bad..name", "")
+	assert.Equal(t, ErrInvalidBranchName, err)
+
+	branches, err := repo.ListBranches()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"master", "team/a"}, branches)
+
+	// committing to another branch leaves master and the worktree alone
+	err = repo.CommitFileToBranch("team/a", "a.txt", bytes.NewBufferString("team a"), nil)
+	assert.Nil(t, err)
+	err = repo.CommitFileToBranch("team/b", "a.txt", bytes.NewBufferString("team b"), nil)
+	assert.Equal(t, ErrBranchNotFound, err)
+
+	bites, err := repo.ReadFileFromHead("a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "master", string(bites))
+	bites, err = repo.ReadFile("team/a", "a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "team a", string(bites))
+
+	err = repo.CheckoutBranch("team/b")
+	assert.Equal(t, ErrBranchNotFound, err)
+	err = repo.CheckoutBranch("team/a")
+	assert.Nil(t, err)
+
+	r := repo.(*repository)
+	f, err := r.fs.Open("a.txt")
+	assert.Nil(t, err)
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "team a", buf.String())
+	assert.Nil(t, f.Close())
+
+	// commits through the worktree go to the checked out branch
+	err = repo.CommitFile("b.txt", bytes.NewBufferString("b"))
+	assert.Nil(t, err)
+	_, err = repo.ReadFile("master", "b.txt")
+	assert.Equal(t, object.ErrFileNotFound, err)
+	bites, err = repo.ReadFile("team/a", "b.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(bites))
+
+	err = repo.DeleteBranch("team/a")
+	assert.Equal(t, ErrBranchCheckedOut, err)
+	err = repo.CheckoutBranch("master")
+	assert.Nil(t, err)
+	err = repo.DeleteBranch("team/a")
+	assert.Nil(t, err)
+	err = repo.DeleteBranch("team/a")
+	assert.Equal(t, ErrBranchNotFound, err)
+
+	branches, err = repo.ListBranches()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"master"}, branches)
+}
+
+func TestBranchUpdatesAcrossRepositories(t *testing.T) {
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+	err = repo.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+
+	// separate repositories on the same database don't share locks, so
+	// only the compare-and-set in the store prevents lost updates
+	const n = 8
+	repos := make([]Repository, n)
+	for i := range repos {
+		repos[i], err = OpenRepoFromDatabase(db)
+		assert.Nil(t, err)
+	}
+
+	var wg sync.WaitGroup
+	created := make(chan error, n)
+	committed := make(chan error, n)
+	for i, other := range repos {
+		wg.Add(1)
+		go func(i int, other Repository) {
+			defer wg.Done()
+			created <- other.CreateBranch("feature", "")
+			committed <- other.CommitFileToBranch("master", fmt.Sprintf("%d.txt", i), bytes.NewBufferString("x"), nil)
+		}(i, other)
+	}
+	wg.Wait()
+	close(created)
+	close(committed)
+
+	succeeded := 0
+	for err := range created {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.Equal(t, ErrBranchExists, err)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+
+	succeeded = 0
+	for err := range committed {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.Equal(t, storage.ErrReferenceHasChanged, err)
+		}
+	}
+
+	var files []string
+	for i := 0; i < n; i++ {
+		_, err := repo.ReadFile("master", fmt.Sprintf("%d.txt", i))
+		if err == nil {
+			files = append(files, fmt.Sprintf("%d.txt", i))
+		}
+	}
+
+	// every successful commit is in the history
+	r := repo.(*repository)
+	h, err := r.repo.ResolveRevision("master")
+	assert.Nil(t, err)
+	assert.Equal(t, succeeded, len(files))
+	assert.Equal(t, succeeded+1, len(firstParentHistory(t, r, *h)))
+}
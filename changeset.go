@@ -0,0 +1,118 @@
+package arangit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ErrEmptyChangeset is returned when committing a changeset without changes.
+var ErrEmptyChangeset = errors.New("changeset is empty")
+
+// Changeset collects changes to several files that CommitChangeset commits
+// at once. The changes are applied in the order they were added, so a file
+// can be renamed and then updated. A Changeset isn't safe for concurrent
+// use.
+type Changeset struct {
+	changes []fileChange
+}
+
+// NewChangeset returns an empty changeset.
+func NewChangeset() *Changeset {
+	return &Changeset{}
+}
+
+// Put adds the file at path or replaces its content.
+func (c *Changeset) Put(path string, content []byte) *Changeset {
+	c.changes = append(c.changes, fileChange{Path: path, Content: content})
+	return c
+}
+
+// Delete removes the file at path or, if path is a directory, all files in
+// it. Committing fails with object.ErrFileNotFound if there is nothing at
+// path.
+func (c *Changeset) Delete(path string) *Changeset {
+	c.changes = append(c.changes, fileChange{Path: path, Delete: true, Strict: true})
+	return c
+}
+
+// Rename moves the file or directory at from to to. Committing fails with
+// object.ErrFileNotFound if there is nothing at from and with
+// ErrPathConflict if a moved file would replace another one.
+func (c *Changeset) Rename(from string, to string) *Changeset {
+	c.changes = append(c.changes, fileChange{Path: to, From: from})
+	return c
+}
+
+// Len returns the number of changes in the changeset.
+func (c *Changeset) Len() int {
+	return len(c.changes)
+}
+
+// message returns the default commit message for the changeset.
+func (c *Changeset) message() string {
+	if len(c.changes) == 1 {
+		ch := c.changes[0]
+		switch {
+		case ch.Delete:
+			return "Delete " + ch.Path
+		case ch.From != "":
+			return "Rename " + ch.From + " to " + ch.Path
+		default:
+			return "Update " + ch.Path
+		}
+	}
+	return fmt.Sprintf("Update %d files", len(c.changes))
+}
+
+// CommitChangeset commits all changes in cs as a single commit on the branch
+// called branch, or the branch HEAD points to if branch is empty, and
+// returns the commit. Either all changes are committed or none. opts can be
+// nil, the message defaults to a summary of the changes. It returns
+// ErrEmptyChangeset if cs has no changes and ErrNothingToCommit if the
+// changes don't change any file.
+func (r *repository) CommitChangeset(branch string, cs *Changeset, opts *CommitOptions) (plumbing.Hash, error) {
+	if cs == nil || cs.Len() == 0 {
+		return plumbing.ZeroHash, ErrEmptyChangeset
+	}
+
+	name, err := r.branchOrHead(branch)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.commitChanges(name, cs.changes, r.commitInfo(opts, cs.message()), r.branchExists(name))
+}
+
+// DeleteFile deletes the file or directory at path on the branch HEAD points
+// to and commits the deletion. The worktree and the index are updated. The
+// message defaults to "Delete <path>".
+func (r *repository) DeleteFile(path string, opts *CommitOptions) error {
+	_, err := r.CommitChangeset("", NewChangeset().Delete(path), opts)
+	return err
+}
+
+// MoveFile moves the file or directory at from to to on the branch HEAD
+// points to and commits the move. The content of moved files doesn't
+// change, so history queries detect the move as a rename. The message
+// defaults to "Rename <from> to <to>".
+func (r *repository) MoveFile(from string, to string, opts *CommitOptions) error {
+	_, err := r.CommitChangeset("", NewChangeset().Rename(from, to), opts)
+	return err
+}
+
+// branchOrHead returns the reference name of the branch called branch or,
+// if branch is empty, of the branch HEAD points to.
+func (r *repository) branchOrHead(branch string) (plumbing.ReferenceName, error) {
+	if branch != "" {
+		return branchReferenceName(branch)
+	}
+
+	head, err := r.repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return "", err
+	} else if head.Type() != plumbing.SymbolicReference {
+		return "", ErrDetachedHead
+	}
+	return head.Target(), nil
+}
@@ -0,0 +1,176 @@
+package arangit
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitChangeset(t *testing.T) {
+	r := openTestRepo(t)
+	err := r.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+	err = r.CommitFile("b.txt", bytes.NewBufferString("b"))
+	assert.Nil(t, err)
+	parent := headCommit(t, r, "HEAD")
+
+	cs := NewChangeset().
+		Put("config/app.json", []byte(`{"v":2}`)).
+		Put("a.txt", []byte("a2")).
+		Delete("b.txt").
+		Rename("a.txt", "docs/a.txt").
+		Put("docs/a.txt", []byte("a3"))
+	h, err := r.CommitChangeset("", cs, nil)
+	assert.Nil(t, err)
+
+	// all changes end up in a single commit
+	c := headCommit(t, r, "HEAD")
+	assert.Equal(t, h, c.Hash)
+	assert.Equal(t, []plumbing.Hash{parent.Hash}, c.ParentHashes)
+	assert.Equal(t, "Update 5 files", c.Message)
+
+	files, err := commitEntries(c)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, `{"v":2}`, readString(t, r, "HEAD", "config/app.json"))
+	assert.Equal(t, "a3", readString(t, r, "HEAD", "docs/a.txt"))
+
+	// the checked out branch was changed, so the worktree follows
+	wt, err := r.repo.Worktree()
+	assert.Nil(t, err)
+	st, err := wt.Status()
+	assert.Nil(t, err)
+	assert.True(t, st.IsClean())
+
+	h, err = r.CommitChangeset("master", NewChangeset().Rename("docs/a.txt", "a.txt"), &CommitOptions{Author: alice})
+	assert.Nil(t, err)
+	c = headCommit(t, r, "master")
+	assert.Equal(t, h, c.Hash)
+	assert.Equal(t, "Rename docs/a.txt to a.txt", c.Message)
+	assert.Equal(t, "Alice", c.Author.Name)
+}
+
+func TestCommitChangesetRejected(t *testing.T) {
+	r := openTestRepo(t)
+	err := r.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+	head := headCommit(t, r, "HEAD").Hash
+
+	for _, tc := range []struct {
+		cs     *Changeset
+		branch string
+		err    error
+	}{
+		{nil, "", ErrEmptyChangeset},
+		{NewChangeset(), "", ErrEmptyChangeset},
+		{NewChangeset().Put("b.txt", []byte("b")).Delete("c.txt"), "", object.ErrFileNotFound},
+		{NewChangeset().Rename("c.txt", "d.txt"), "", object.ErrFileNotFound},
+		{NewChangeset().Put("b.txt", []byte("b")).Rename("b.txt", "a.txt"), "", ErrPathConflict},
+		{NewChangeset().Put("a.txt/b.txt", []byte("b")), "", ErrPathConflict},
+		{NewChangeset().Put("/", []byte("b")), "", ErrInvalidPath},
+		{NewChangeset().Put("a.txt", []byte("a")), "", ErrNothingToCommit},
+		{NewChangeset().Put("b.txt", []byte("b")), "unknown", ErrBranchNotFound},
+	} {
+		_, err := r.CommitChangeset(tc.branch, tc.cs, nil)
+		assert.Equal(t, tc.err, err)
+		assert.Equal(t, head, headCommit(t, r, "HEAD").Hash)
+	}
+
+	_, err = r.ReadFile("HEAD", "b.txt")
+	assert.Equal(t, object.ErrFileNotFound, err)
+}
+
+func TestDeleteFile(t *testing.T) {
+	r := openTestRepo(t)
+	_, err := r.CommitChangeset("", NewChangeset().
+		Put("a.txt", []byte("a")).
+		Put("dir/b.txt", []byte("b")).
+		Put("dir/sub/c.txt", []byte("c")), nil)
+	assert.Nil(t, err)
+
+	err = r.DeleteFile("a.txt", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "Delete a.txt", headCommit(t, r, "HEAD").Message)
+	_, err = r.fs.Stat("a.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	err = r.DeleteFile("dir", &CommitOptions{Message: "remove dir"})
+	assert.Nil(t, err)
+	c := headCommit(t, r, "HEAD")
+	assert.Equal(t, "remove dir", c.Message)
+	files, err := commitEntries(c)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(files))
+	_, err = r.fs.Stat("dir/sub/c.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	err = r.DeleteFile("dir", nil)
+	assert.Equal(t, object.ErrFileNotFound, err)
+
+	// the index matches the worktree and HEAD
+	wt, err := r.repo.Worktree()
+	assert.Nil(t, err)
+	st, err := wt.Status()
+	assert.Nil(t, err)
+	assert.True(t, st.IsClean())
+}
+
+func TestMoveFile(t *testing.T) {
+	r := openTestRepo(t)
+	_, err := r.CommitChangeset("", NewChangeset().
+		Put("a.txt", []byte("a")).
+		Put("dir/b.txt", []byte("b")).
+		Put("dir/sub/c.txt", []byte("c")), nil)
+	assert.Nil(t, err)
+	before := headCommit(t, r, "HEAD")
+
+	err = r.MoveFile("dir", "moved", nil)
+	assert.Nil(t, err)
+	err = r.MoveFile("a.txt", "moved/sub/a.txt", nil)
+	assert.Nil(t, err)
+	after := headCommit(t, r, "HEAD")
+	assert.Equal(t, "Rename a.txt to moved/sub/a.txt", after.Message)
+
+	files, err := commitEntries(after)
+	assert.Nil(t, err)
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{"moved/b.txt", "moved/sub/a.txt", "moved/sub/c.txt"}, paths)
+	f, err := r.fs.Open("moved/sub/a.txt")
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	// the moves show up as renames
+	from, err := before.Tree()
+	assert.Nil(t, err)
+	to, err := after.Tree()
+	assert.Nil(t, err)
+	changes, err := object.DiffTree(from, to)
+	assert.Nil(t, err)
+	changes, err = object.DetectRenames(changes, nil)
+	assert.Nil(t, err)
+	renames := map[string]string{}
+	for _, ch := range changes {
+		renames[ch.From.Name] = ch.To.Name
+	}
+	assert.Equal(t, map[string]string{
+		"a.txt":         "moved/sub/a.txt",
+		"dir/b.txt":     "moved/b.txt",
+		"dir/sub/c.txt": "moved/sub/c.txt",
+	}, renames)
+
+	err = r.MoveFile("moved/b.txt", "moved/sub/a.txt", nil)
+	assert.Equal(t, ErrPathConflict, err)
+	err = r.MoveFile("moved", "moved/again", nil)
+	assert.Equal(t, ErrInvalidPath, err)
+	err = r.MoveFile("unknown", "b.txt", nil)
+	assert.Equal(t, object.ErrFileNotFound, err)
+}
@@ -0,0 +1,426 @@
+package arangit
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrNothingToCommit is returned when a commit wouldn't change any file.
+	ErrNothingToCommit = errors.New("nothing to commit")
+	// ErrPathConflict is returned when a change would put a file where
+	// another file or a directory is.
+	ErrPathConflict = errors.New("path conflicts with an existing file or directory")
+	// ErrInvalidPath -
+	ErrInvalidPath = errors.New("invalid path")
+)
+
+// CommitOptions configures the commits and tags made by write operations.
+// Unset fields fall back to the defaults of the repository, see
+// RepoOptions.
+type CommitOptions struct {
+	// Author defaults to the identity of the repository. Its When is used
+	// if it's set and When isn't.
+	Author *object.Signature
+	// Committer defaults to Author
+	Committer *object.Signature
+	// Message replaces the message the operation would generate
+	Message string
+	// When is the time of the commit, it defaults to the time of the
+	// repository clock
+	When time.Time
+	// Trailers are appended to the message
+	Trailers []Trailer
+}
+
+// Trailer is a "Key: Value" line at the end of a commit message, e.g.
+// Signed-off-by or Reviewed-by.
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// commitInfo holds everything about a commit except its tree and parents.
+type commitInfo struct {
+	author    object.Signature
+	committer object.Signature
+	message   string
+}
+
+// commitInfo resolves opts, which can be nil, against the defaults of the
+// repository. message is used if opts doesn't set one.
+func (r *repository) commitInfo(opts *CommitOptions, message string) commitInfo {
+	if opts == nil {
+		opts = &CommitOptions{}
+	}
+
+	now := r.clock()
+	sign := func(sig *object.Signature, fallback object.Signature) object.Signature {
+		if sig == nil {
+			sig = &fallback
+		}
+		s := *sig
+		switch {
+		case !opts.When.IsZero():
+			s.When = opts.When
+		case s.When.IsZero():
+			s.When = now
+		}
+		return s
+	}
+
+	info := commitInfo{message: message}
+	info.author = sign(opts.Author, r.identity)
+	info.committer = sign(opts.Committer, info.author)
+	if opts.Message != "" {
+		info.message = opts.Message
+	}
+
+	if len(opts.Trailers) > 0 {
+		var sb strings.Builder
+		sb.WriteString(strings.TrimRight(info.message, "\n"))
+		sb.WriteString("\n\n")
+		for _, t := range opts.Trailers {
+			sb.WriteString(t.Key + ": " + t.Value + "\n")
+		}
+		info.message = sb.String()
+	}
+	return info
+}
+
+// fileChange sets the content of the file at Path, deletes it or moves the
+// file at From to it. Deletes and moves of directories apply to all files
+// in them. Deleting a path that doesn't exist is a no-op unless Strict is
+// set.
+type fileChange struct {
+	Path    string
+	Content []byte
+	Delete  bool
+	From    string
+	Strict  bool
+}
+
+// commitChanges commits changes on top of the tip of branch without going
+// through the worktree and returns the new commit. The branch is created if
+// it doesn't exist. If branch is checked out the worktree is reset to the
+// new commit. If check isn't nil it's called with the tree of the tip, or
+// nil if the branch doesn't exist, and nothing is committed if it returns
+// an error. The branch is only moved or created if nobody else changed it
+// in between.
+func (r *repository) commitChanges(branch plumbing.ReferenceName, changes []fileChange, info commitInfo, check func(*object.Tree) error) (plumbing.Hash, error) {
+	defer r.lockRef(branch)()
+
+	old, err := r.repo.Reference(branch, false)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, err
+	}
+
+	var tree *object.Tree
+	var parents []plumbing.Hash
+	if old != nil {
+		parents = append(parents, old.Hash())
+		tree, err = r.commitTree(old.Hash())
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	if check != nil {
+		err = check(tree)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	entries, err := treeEntries(tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	changed := false
+	for _, ch := range changes {
+		p := cleanPath(ch.Path)
+		if p == "" {
+			return plumbing.ZeroHash, ErrInvalidPath
+		}
+
+		if ch.Delete {
+			files := filesAt(entries, p)
+			if len(files) == 0 && ch.Strict {
+				return plumbing.ZeroHash, object.ErrFileNotFound
+			}
+			for _, f := range files {
+				delete(entries, f)
+				changed = true
+			}
+			continue
+		}
+
+		if ch.From != "" {
+			moved, err := moveFiles(entries, cleanPath(ch.From), p)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			changed = changed || moved
+			continue
+		}
+
+		h, err := r.writeBlob(ch.Content)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if e, ok := entries[p]; !ok || e.Hash != h {
+			entries[p] = object.TreeEntry{Name: p, Mode: filemode.Regular, Hash: h}
+			changed = true
+		}
+	}
+	if !changed {
+		return plumbing.ZeroHash, ErrNothingToCommit
+	}
+
+	err = checkPaths(entries)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h, err := r.writeCommit(entries, parents, info)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	err = r.updateBranch(branch, old, h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return h, nil
+}
+
+// filesAt returns the path of the file at p or, if p is a directory, the
+// paths of all files in it.
+func filesAt(files map[string]object.TreeEntry, p string) []string {
+	if _, ok := files[p]; ok {
+		return []string{p}
+	}
+
+	var paths []string
+	for f := range files {
+		if strings.HasPrefix(f, p+"/") {
+			paths = append(paths, f)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// moveFiles moves the file or directory at from to to and reports whether
+// anything moved.
+func moveFiles(files map[string]object.TreeEntry, from string, to string) (bool, error) {
+	paths := filesAt(files, from)
+	if from == "" || len(paths) == 0 {
+		return false, object.ErrFileNotFound
+	} else if from == to {
+		return false, nil
+	} else if strings.HasPrefix(to, from+"/") {
+		// a directory can't be moved into itself
+		return false, ErrInvalidPath
+	}
+
+	moved := map[string]object.TreeEntry{}
+	for _, p := range paths {
+		e := files[p]
+		e.Name = to + strings.TrimPrefix(p, from)
+		moved[e.Name] = e
+		delete(files, p)
+	}
+
+	for p, e := range moved {
+		if _, ok := files[p]; ok {
+			return false, ErrPathConflict
+		}
+		files[p] = e
+	}
+	return true, nil
+}
+
+// checkPaths returns ErrPathConflict if the path of a file in files is the
+// directory of another one, because such files can't be written to a tree.
+func checkPaths(files map[string]object.TreeEntry) error {
+	for p := range files {
+		for dir := parentDir(p); dir != ""; dir = parentDir(dir) {
+			if _, ok := files[dir]; ok {
+				return ErrPathConflict
+			}
+		}
+	}
+	return nil
+}
+
+// cleanPath returns p relative to the root of the tree. It returns "" for
+// the root itself.
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// treeEntries returns the files in tree keyed by their full path. It
+// returns an empty map for a nil tree.
+func treeEntries(tree *object.Tree) (map[string]object.TreeEntry, error) {
+	entries := map[string]object.TreeEntry{}
+	if tree == nil {
+		return entries, nil
+	}
+
+	err := tree.Files().ForEach(func(f *object.File) error {
+		entries[f.Name] = object.TreeEntry{Name: f.Name, Mode: f.Mode, Hash: f.Hash}
+		return nil
+	})
+	return entries, err
+}
+
+// writeCommit writes the trees for files and a commit of them with the
+// given parents and returns the hash of the commit.
+func (r *repository) writeCommit(files map[string]object.TreeEntry, parents []plumbing.Hash, info commitInfo) (plumbing.Hash, error) {
+	treeHash, err := r.writeTree(files)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit := &object.Commit{
+		Author:       info.author,
+		Committer:    info.committer,
+		Message:      info.message,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+	obj := r.repo.Storer.NewEncodedObject()
+	err = commit.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.repo.Storer.SetEncodedObject(obj)
+}
+
+// updateBranch moves branch from old, which is nil if the branch doesn't
+// exist, to the commit h and brings the worktree and the search indexes up
+// to date. The caller has to hold the lock of branch.
+func (r *repository) updateBranch(branch plumbing.ReferenceName, old *plumbing.Reference, h plumbing.Hash) error {
+	var err error
+	ref := plumbing.NewHashReference(branch, h)
+	if old == nil {
+		err = r.store.CreateReference(ref)
+	} else {
+		err = r.store.CheckAndSetReference(ref, old)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = r.resetIfCheckedOut(branch, h)
+	if err != nil {
+		return err
+	}
+	return r.updateSearchIndexes()
+}
+
+// resetIfCheckedOut moves the worktree to commit h if HEAD points to
+// branch. Otherwise the next commit through the worktree would undo the
+// changes made behind its back.
+func (r *repository) resetIfCheckedOut(branch plumbing.ReferenceName, h plumbing.Hash) error {
+	r.locks.worktree.Lock()
+	defer r.locks.worktree.Unlock()
+
+	head, err := r.repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return err
+	} else if head.Type() != plumbing.SymbolicReference || head.Target() != branch {
+		return nil
+	}
+
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return wt.Reset(&git.ResetOptions{
+		Commit: h,
+		Mode:   git.HardReset,
+	})
+}
+
+func (r *repository) writeBlob(content []byte) (plumbing.Hash, error) {
+	obj := r.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	_, err = w.Write(content)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.repo.Storer.SetEncodedObject(obj)
+}
+
+// writeTree writes the trees for files, which maps full paths to entries,
+// and returns the hash of the root tree.
+func (r *repository) writeTree(files map[string]object.TreeEntry) (plumbing.Hash, error) {
+	var entries []object.TreeEntry
+	subtrees := map[string]map[string]object.TreeEntry{}
+	for p, e := range files {
+		i := strings.IndexByte(p, '/')
+		if i < 0 {
+			e.Name = p
+			entries = append(entries, e)
+			continue
+		}
+
+		dir := p[:i]
+		if subtrees[dir] == nil {
+			subtrees[dir] = map[string]object.TreeEntry{}
+		}
+		subtrees[dir][p[i+1:]] = e
+	}
+
+	for dir, sub := range subtrees {
+		h, err := r.writeTree(sub)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: h})
+	}
+
+	// git orders entries by name with directories sorting as if their
+	// name ended in a slash
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+
+	tree := &object.Tree{Entries: entries}
+	obj := r.repo.Storer.NewEncodedObject()
+	err := tree.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.repo.Storer.SetEncodedObject(obj)
+}
@@ -0,0 +1,139 @@
+package arangit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testTime  = time.Date(2020, 11, 3, 10, 0, 0, 0, time.UTC)
+	alice     = &object.Signature{Name: "Alice", Email: "alice@example.com"}
+	bob       = &object.Signature{Name: "Bob", Email: "bob@example.com"}
+	ciService = &object.Signature{Name: "CI", Email: "ci@example.com"}
+)
+
+func openTestRepo(t *testing.T) *repository {
+	repo, err := OpenRepoFromDatabaseWithOptions(arangotest.NewDatabase("arangit"), &RepoOptions{
+		Identity: ciService,
+		Clock:    func() time.Time { return testTime },
+	})
+	assert.Nil(t, err)
+	return repo.(*repository)
+}
+
+func headCommit(t *testing.T, r *repository, rev string) *object.Commit {
+	h, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	assert.Nil(t, err)
+	c, err := r.repo.CommitObject(*h)
+	assert.Nil(t, err)
+	return c
+}
+
+func TestCommitDefaults(t *testing.T) {
+	r := openTestRepo(t)
+
+	err := r.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+
+	c := headCommit(t, r, "HEAD")
+	assert.Equal(t, "Update a.txt", c.Message)
+	assert.Equal(t, "CI", c.Author.Name)
+	assert.Equal(t, "ci@example.com", c.Committer.Email)
+	assert.True(t, testTime.Equal(c.Author.When))
+	assert.True(t, testTime.Equal(c.Committer.When))
+
+	err = r.TagHead("v1")
+	assert.Nil(t, err)
+	tag, err := r.repo.Tag("v1")
+	assert.Nil(t, err)
+	tagObj, err := r.repo.TagObject(tag.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "CI", tagObj.Tagger.Name)
+	assert.True(t, testTime.Equal(tagObj.Tagger.When))
+
+	// the repository is deterministic, so the same commit has the same hash
+	other := openTestRepo(t)
+	err = other.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, c.Hash, headCommit(t, other, "HEAD").Hash)
+}
+
+func TestCommitOptions(t *testing.T) {
+	r := openTestRepo(t)
+	when := testTime.Add(time.Hour)
+
+	err := r.CommitFileWithOptions("a.txt", bytes.NewBufferString("a"), &CommitOptions{
+		Author:    alice,
+		Committer: bob,
+		Message:   "Add a\n",
+		When:      when,
+		Trailers:  []Trailer{{"Reviewed-by", "Bob <bob@example.com>"}, {"Request-Id", "42"}},
+	})
+	assert.Nil(t, err)
+
+	c := headCommit(t, r, "HEAD")
+	assert.Equal(t, "Add a\n\nReviewed-by: Bob <bob@example.com>\nRequest-Id: 42\n", c.Message)
+	assert.Equal(t, "Alice", c.Author.Name)
+	assert.Equal(t, "Bob", c.Committer.Name)
+	assert.True(t, when.Equal(c.Author.When))
+	assert.True(t, when.Equal(c.Committer.When))
+
+	// the committer defaults to the author and the time of the author is kept
+	authored := &object.Signature{Name: "Alice", Email: "alice@example.com", When: when}
+	err = r.CommitFileToBranch("master", "b.txt", bytes.NewBufferString("b"), &CommitOptions{Author: authored})
+	assert.Nil(t, err)
+
+	c = headCommit(t, r, "master")
+	assert.Equal(t, "Update b.txt", c.Message)
+	assert.Equal(t, "Alice", c.Committer.Name)
+	assert.True(t, when.Equal(c.Author.When))
+	assert.True(t, when.Equal(c.Committer.When))
+
+	err = r.TagHeadWithOptions("v1", &CommitOptions{Committer: bob, Message: "release 1"})
+	assert.Nil(t, err)
+	tag, err := r.repo.Tag("v1")
+	assert.Nil(t, err)
+	tagObj, err := r.repo.TagObject(tag.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "Bob", tagObj.Tagger.Name)
+	assert.Equal(t, "release 1\n", tagObj.Message)
+}
+
+func TestCommitOptionsOfOperations(t *testing.T) {
+	r := openTestRepo(t)
+	err := r.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+
+	kv, err := r.KV(&KVOptions{CommitOptions: CommitOptions{Author: alice}})
+	assert.Nil(t, err)
+	_, err = kv.Put("key", []byte("value"))
+	assert.Nil(t, err)
+
+	c := headCommit(t, r, "HEAD")
+	assert.Equal(t, "Put key", c.Message)
+	assert.Equal(t, "Alice", c.Author.Name)
+
+	err = r.CreateBranch("feature", "")
+	assert.Nil(t, err)
+	err = r.CommitFileToBranch("feature", "b.txt", bytes.NewBufferString("b"), nil)
+	assert.Nil(t, err)
+	err = r.CommitFileToBranch("master", "c.txt", bytes.NewBufferString("c"), nil)
+	assert.Nil(t, err)
+
+	_, err = r.Merge("feature", "master", &MergeOptions{CommitOptions: CommitOptions{
+		Author:   bob,
+		Trailers: []Trailer{{"Approved-by", "Alice"}},
+	}})
+	assert.Nil(t, err)
+
+	c = headCommit(t, r, "master")
+	assert.Equal(t, "Merge feature into master\n\nApproved-by: Alice\n", c.Message)
+	assert.Equal(t, "Bob", c.Author.Name)
+	assert.Equal(t, 2, c.NumParents())
+}
@@ -0,0 +1,291 @@
+package arangit
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const defaultContextLines = 3
+
+// ChangeType -
+type ChangeType int
+
+const (
+	// ChangeAdded -
+	ChangeAdded ChangeType = iota
+	// ChangeModified -
+	ChangeModified
+	// ChangeDeleted -
+	ChangeDeleted
+	// ChangeRenamed is a file that was moved and possibly modified
+	ChangeRenamed
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeAdded:
+		return "added"
+	case ChangeModified:
+		return "modified"
+	case ChangeDeleted:
+		return "deleted"
+	case ChangeRenamed:
+		return "renamed"
+	default:
+		return "unknown"
+	}
+}
+
+// DiffOptions -
+type DiffOptions struct {
+	// Paths limits the diff to the files at or below these paths. A renamed
+	// file is included if either of its paths matches.
+	Paths []string
+	// ContextLines is the number of unchanged lines around each change in
+	// the patches. It defaults to 3 and is at least 1.
+	ContextLines int
+	// NoRenames reports renamed files as a deletion and an addition
+	NoRenames bool
+	// Structural compares files with a StructuralDiffer for their
+	// extension, see FileDiff.Structural
+	Structural bool
+	// Differs adds to and overrides the differs of the repository by
+	// extension such as ".json", a nil differ disables the extension
+	Differs map[string]StructuralDiffer
+}
+
+// FileDiff describes how a file differs between two revisions. From is
+// empty for added files, To for deleted files.
+type FileDiff struct {
+	Type     ChangeType
+	From     string
+	To       string
+	FromHash plumbing.Hash
+	ToHash   plumbing.Hash
+	FromMode filemode.FileMode
+	ToMode   filemode.FileMode
+	Binary   bool
+	// Patch is the unified diff of the file
+	Patch string
+	// Structural is the structural diff of the file if
+	// DiffOptions.Structural is set, the extension of the file has a
+	// differ and both versions could be parsed
+	Structural *StructuralDiff
+}
+
+// DiffResult -
+type DiffResult struct {
+	// From and To are the commits that were compared, From is
+	// plumbing.ZeroHash when diffing against the empty tree
+	From  plumbing.Hash
+	To    plumbing.Hash
+	Files []FileDiff
+}
+
+// Patch returns the unified diff of all files.
+func (d *DiffResult) Patch() string {
+	var sb strings.Builder
+	for _, f := range d.Files {
+		sb.WriteString(f.Patch)
+	}
+	return sb.String()
+}
+
+// Diff compares the revisions from and to, which can be anything git
+// rev-parse understands. An empty from compares to against the empty tree.
+// Files are sorted by path, the trees are read from the object store so the
+// worktree isn't touched. opts can be nil.
+func (r *repository) Diff(from string, to string, opts *DiffOptions) (*DiffResult, error) {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
+	result := &DiffResult{}
+	var fromTree *object.Tree
+	if from != "" {
+		c, err := r.revisionCommit(from)
+		if err != nil {
+			return nil, err
+		}
+
+		fromTree, err = c.Tree()
+		if err != nil {
+			return nil, err
+		}
+		result.From = c.Hash
+	}
+
+	c, err := r.revisionCommit(to)
+	if err != nil {
+		return nil, err
+	}
+
+	toTree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	result.To = c.Hash
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.NoRenames {
+		changes, err = object.DetectRenames(changes, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make([]string, len(opts.Paths))
+	for i, p := range opts.Paths {
+		paths[i] = cleanPath(p)
+	}
+
+	contextLines := opts.ContextLines
+	if contextLines == 0 {
+		contextLines = defaultContextLines
+	} else if contextLines < 0 {
+		// go-git's encoder numbers hunks without context wrongly
+		contextLines = 1
+	}
+
+	for _, ch := range changes {
+		if !diffPathsMatch(paths, ch.From.Name) && !diffPathsMatch(paths, ch.To.Name) {
+			continue
+		}
+
+		f, err := fileDiff(ch, contextLines, r.structuralDiffer(opts, ch))
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, f)
+	}
+
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].path() < result.Files[j].path()
+	})
+	return result, nil
+}
+
+// path returns the path the file diff is sorted by.
+func (f *FileDiff) path() string {
+	if f.To != "" {
+		return f.To
+	}
+	return f.From
+}
+
+// structuralDiffer returns the differ for the extension of the file of ch
+// or nil if there is none.
+func (r *repository) structuralDiffer(opts *DiffOptions, ch *object.Change) StructuralDiffer {
+	if !opts.Structural {
+		return nil
+	}
+
+	p := ch.To.Name
+	if p == "" {
+		p = ch.From.Name
+	}
+
+	ext := strings.ToLower(path.Ext(p))
+	if differ, ok := opts.Differs[ext]; ok {
+		return differ
+	}
+	return r.differs[ext]
+}
+
+func fileDiff(ch *object.Change, contextLines int, differ StructuralDiffer) (FileDiff, error) {
+	f := FileDiff{
+		From:     ch.From.Name,
+		To:       ch.To.Name,
+		FromHash: ch.From.TreeEntry.Hash,
+		ToHash:   ch.To.TreeEntry.Hash,
+		FromMode: ch.From.TreeEntry.Mode,
+		ToMode:   ch.To.TreeEntry.Mode,
+	}
+
+	switch {
+	case f.From == "":
+		f.Type = ChangeAdded
+	case f.To == "":
+		f.Type = ChangeDeleted
+	case f.From != f.To:
+		f.Type = ChangeRenamed
+	default:
+		f.Type = ChangeModified
+	}
+
+	patch, err := ch.Patch()
+	if err != nil {
+		return FileDiff{}, err
+	}
+
+	for _, fp := range patch.FilePatches() {
+		f.Binary = f.Binary || fp.IsBinary()
+	}
+
+	var sb strings.Builder
+	err = fdiff.NewUnifiedEncoder(&sb, contextLines).Encode(patch)
+	if err != nil {
+		return FileDiff{}, err
+	}
+	f.Patch = sb.String()
+
+	if differ != nil && !f.Binary {
+		f.Structural, err = structuralDiff(ch, differ)
+	}
+	return f, err
+}
+
+// structuralDiff compares the versions of the file of ch with differ. It
+// returns nil if a version can't be parsed.
+func structuralDiff(ch *object.Change, differ StructuralDiffer) (*StructuralDiff, error) {
+	from, to, err := ch.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions [2][]byte
+	for i, f := range []*object.File{from, to} {
+		if f == nil {
+			continue
+		}
+
+		content, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+		versions[i] = []byte(content)
+	}
+
+	d, err := differ(versions[0], versions[1])
+	if err != nil {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// diffPathsMatch reports whether p is at or below one of paths. Every path
+// matches if there are no paths.
+func diffPathsMatch(paths []string, p string) bool {
+	if len(paths) == 0 {
+		return true
+	} else if p == "" {
+		return false
+	}
+
+	for _, dir := range paths {
+		if dir == "" || p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package arangit
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/stretchr/testify/assert"
+)
+
+const tenLines = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+
+func newDiffRepo(t *testing.T) *repository {
+	r := openTestRepo(t)
+	_, err := r.CommitChangeset("", NewChangeset().
+		Put("a.txt", []byte(tenLines)).
+		Put("b.txt", []byte("b\n")).
+		Put("dir/c.txt", []byte("c\n")), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, r.TagHead("v1"))
+
+	_, err = r.CommitChangeset("", NewChangeset().
+		Put("a.txt", []byte("1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n")).
+		Delete("b.txt").
+		Rename("dir/c.txt", "dir/d.txt").
+		Put("e.bin", []byte{0, 1, 2}), nil)
+	assert.Nil(t, err)
+	return r
+}
+
+func diffSummary(result *DiffResult) []string {
+	var summary []string
+	for _, f := range result.Files {
+		summary = append(summary, f.Type.String()+" "+f.From+" "+f.To)
+	}
+	return summary
+}
+
+func TestDiff(t *testing.T) {
+	r := newDiffRepo(t)
+
+	result, err := r.Diff("v1", "master", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, headCommit(t, r, "v1").Hash, result.From)
+	assert.Equal(t, headCommit(t, r, "HEAD").Hash, result.To)
+	assert.Equal(t, []string{
+		"modified a.txt a.txt",
+		"deleted b.txt ",
+		"renamed dir/c.txt dir/d.txt",
+		"added  e.bin",
+	}, diffSummary(result))
+
+	a := result.Files[0]
+	assert.Equal(t, plumbing.ComputeHash(plumbing.BlobObject, []byte(tenLines)), a.FromHash)
+	assert.Equal(t, filemode.Regular, a.ToMode)
+	assert.False(t, a.Binary)
+	assert.Equal(t, ""+
+		"diff --git a/a.txt b/a.txt\n"+
+		"index "+a.FromHash.String()+".."+a.ToHash.String()+" 100644\n"+
+		"--- a/a.txt\n"+
+		"+++ b/a.txt\n"+
+		"@@ -2,7 +2,7 @@ 1\n"+
+		" 2\n"+
+		" 3\n"+
+		" 4\n"+
+		"-5\n"+
+		"+five\n"+
+		" 6\n"+
+		" 7\n"+
+		" 8\n", a.Patch)
+
+	assert.Equal(t, plumbing.ZeroHash, result.Files[1].ToHash)
+	assert.True(t, result.Files[3].Binary)
+	assert.Contains(t, result.Files[3].Patch, "Binary files /dev/null and b/e.bin differ")
+	assert.Equal(t, a.Patch+result.Files[1].Patch+result.Files[2].Patch+result.Files[3].Patch, result.Patch())
+
+	// the reverse diff swaps the sides
+	result, err = r.Diff("HEAD", "v1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"modified a.txt a.txt",
+		"added  b.txt",
+		"renamed dir/d.txt dir/c.txt",
+		"deleted e.bin ",
+	}, diffSummary(result))
+
+	result, err = r.Diff("", "v1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, plumbing.ZeroHash, result.From)
+	assert.Equal(t, []string{"added  a.txt", "added  b.txt", "added  dir/c.txt"}, diffSummary(result))
+
+	result, err = r.Diff("HEAD", "master", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(result.Files))
+
+	_, err = r.Diff("v2", "HEAD", nil)
+	assert.Equal(t, plumbing.ErrReferenceNotFound, err)
+}
+
+func TestDiffOptions(t *testing.T) {
+	r := newDiffRepo(t)
+
+	for _, tc := range []struct {
+		opts    *DiffOptions
+		summary []string
+	}{
+		{&DiffOptions{Paths: []string{"a.txt"}}, []string{"modified a.txt a.txt"}},
+		{&DiffOptions{Paths: []string{"/dir/", "e.bin"}}, []string{"renamed dir/c.txt dir/d.txt", "added  e.bin"}},
+		{&DiffOptions{Paths: []string{"dir/c.txt"}}, []string{"renamed dir/c.txt dir/d.txt"}},
+		{&DiffOptions{Paths: []string{"di"}}, nil},
+		{&DiffOptions{Paths: []string{"dir"}, NoRenames: true}, []string{"deleted dir/c.txt ", "added  dir/d.txt"}},
+	} {
+		result, err := r.Diff("v1", "HEAD", tc.opts)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.summary, diffSummary(result), "%+v", tc.opts)
+	}
+
+	// the line before a hunk is shown after its header like git does
+	result, err := r.Diff("v1", "HEAD", &DiffOptions{Paths: []string{"a.txt"}, ContextLines: 1})
+	assert.Nil(t, err)
+	assert.Contains(t, result.Files[0].Patch, "@@ -4,3 +4,3 @@ 3\n 4\n-5\n+five\n 6\n")
+
+	result, err = r.Diff("v1", "HEAD", &DiffOptions{Paths: []string{"a.txt"}, ContextLines: -1})
+	assert.Nil(t, err)
+	assert.Contains(t, result.Files[0].Patch, "@@ -4,3 +4,3 @@ 3\n")
+
+	result, err = r.Diff("v1", "HEAD", &DiffOptions{Paths: []string{"a.txt"}, ContextLines: 5})
+	assert.Nil(t, err)
+	assert.Contains(t, result.Files[0].Patch, "@@ -1,10 +1,10 @@\n")
+}
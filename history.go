@@ -0,0 +1,166 @@
+package arangit
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb"
+)
+
+// FileHistoryOptions -
+type FileHistoryOptions struct {
+	// Follow continues the history of a renamed file with the path it was
+	// renamed from
+	Follow bool
+}
+
+// FileVersion is a commit that changed a file.
+type FileVersion struct {
+	Commit plumbing.Hash
+	// When is the commit time of Commit
+	When time.Time
+	// Path is the path of the file in Commit, it differs from the path
+	// whose history was requested for versions before a rename
+	Path string
+	// Hash is the hash of the content, it's plumbing.ZeroHash if Commit
+	// deleted the file
+	Hash plumbing.Hash
+	// From is the path Commit renamed the file from
+	From string
+
+	r *repository
+}
+
+// Deleted reports whether the commit deleted the file.
+func (v FileVersion) Deleted() bool {
+	return v.Hash.IsZero()
+}
+
+// Content reads the content of the file in this version. It returns
+// object.ErrFileNotFound if the commit deleted the file.
+func (v FileVersion) Content() ([]byte, error) {
+	if v.Deleted() {
+		return nil, object.ErrFileNotFound
+	}
+
+	blob, err := v.r.repo.BlobObject(v.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	rdr, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rdr.Close() }()
+	return ioutil.ReadAll(rdr)
+}
+
+// FileHistory returns the commits reachable from ref that changed the file
+// at p, newest first. The commits are looked up in the path index of the
+// database, so no trees have to be read except for merge commits, which
+// are only listed if the file differs from all their parents, and commits
+// missing from the index, which are indexed first. opts can be nil.
+func (r *repository) FileHistory(ref string, p string, opts *FileHistoryOptions) ([]FileVersion, error) {
+	if opts == nil {
+		opts = &FileHistoryOptions{}
+	}
+
+	h, err := r.repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := r.indexedHistory(*h)
+	if err != nil {
+		return nil, err
+	}
+
+	p = cleanPath(p)
+	changes, err := r.pathChanges(p)
+	if err != nil {
+		return nil, err
+	}
+
+	merges := newLogFilter(r, &LogOptions{Path: p})
+	var versions []FileVersion
+	for _, c := range commits {
+		ch, ok := changes[c.Hash]
+		if !ok {
+			continue
+		}
+
+		if c.NumParents() > 1 {
+			ok, err = merges.match(c)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+		}
+
+		versions = append(versions, FileVersion{
+			Commit: c.Hash,
+			When:   c.Committer.When,
+			Path:   p,
+			Hash:   plumbing.NewHash(ch.Blob),
+			From:   ch.From,
+			r:      r,
+		})
+
+		if opts.Follow && ch.From != "" {
+			p = ch.From
+			changes, err = r.pathChanges(p)
+			if err != nil {
+				return nil, err
+			}
+			merges = newLogFilter(r, &LogOptions{Path: p})
+		}
+	}
+	return versions, nil
+}
+
+// indexedHistory returns the commits reachable from h, newest first, and
+// makes sure they're all in the path index.
+func (r *repository) indexedHistory(h plumbing.Hash) ([]*object.Commit, error) {
+	w, err := r.newLogWalker(h)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*object.Commit
+	var hashes []plumbing.Hash
+	for {
+		c, err := w.next()
+		if err != nil {
+			return nil, err
+		} else if c == nil {
+			break
+		}
+		commits = append(commits, c)
+		hashes = append(hashes, c.Hash)
+	}
+
+	_, err = r.store.IndexPaths(hashes)
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// pathChanges returns the changes of the file at p by commit.
+func (r *repository) pathChanges(p string) (map[plumbing.Hash]arangodb.PathChange, error) {
+	changes, err := r.store.PathChanges(p)
+	if err != nil {
+		return nil, err
+	}
+
+	byCommit := make(map[plumbing.Hash]arangodb.PathChange, len(changes))
+	for _, ch := range changes {
+		byCommit[plumbing.NewHash(ch.Commit)] = ch
+	}
+	return byCommit, nil
+}
@@ -0,0 +1,111 @@
+package arangit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func versionContents(t *testing.T, versions []FileVersion) []string {
+	var contents []string
+	for _, v := range versions {
+		if v.Deleted() {
+			contents = append(contents, v.Path+" deleted")
+			continue
+		}
+
+		content, err := v.Content()
+		assert.Nil(t, err)
+		contents = append(contents, v.Path+"="+string(content))
+	}
+	return contents
+}
+
+func TestFileHistory(t *testing.T) {
+	r := openTestRepo(t)
+	commit := func(branch string, p string, content string, minute int) {
+		err := r.CommitFileToBranch(branch, p, bytes.NewBufferString(content), &CommitOptions{When: at(minute)})
+		assert.Nil(t, err)
+	}
+
+	commit("master", "config.json", "v1", 1)
+	assert.Nil(t, r.CreateBranch("unrelated", ""))
+	commit("unrelated", "config.json", "unrelated", 2)
+	commit("master", "other.txt", "other", 3)
+	commit("master", "config.json", "v2", 4)
+	assert.Nil(t, r.MoveFile("config.json", "settings/config.json", &CommitOptions{When: at(5)}))
+	commit("master", "settings/config.json", "v3", 6)
+	assert.Nil(t, r.CreateBranch("feature", ""))
+	commit("feature", "settings/config.json", "v4", 7)
+	commit("master", "other.txt", "other 2", 8)
+	_, err := r.Merge("feature", "master", &MergeOptions{CommitOptions: CommitOptions{When: at(9)}})
+	assert.Nil(t, err)
+
+	versions, err := r.FileHistory("master", "settings/config.json", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"settings/config.json=v4",
+		"settings/config.json=v3",
+		"settings/config.json=v2",
+	}, versionContents(t, versions))
+	assert.Equal(t, headCommit(t, r, "feature").Hash, versions[0].Commit)
+	assert.True(t, at(7).Equal(versions[0].When))
+	assert.Equal(t, "config.json", versions[2].From)
+	assert.Equal(t, plumbing.ComputeHash(plumbing.BlobObject, []byte("v2")), versions[2].Hash)
+
+	versions, err = r.FileHistory("master", "/settings/config.json", &FileHistoryOptions{Follow: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"settings/config.json=v4",
+		"settings/config.json=v3",
+		"settings/config.json=v2",
+		"config.json=v2",
+		"config.json=v1",
+	}, versionContents(t, versions))
+
+	versions, err = r.FileHistory("master", "config.json", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"config.json deleted", "config.json=v2", "config.json=v1"}, versionContents(t, versions))
+	_, err = versions[0].Content()
+	assert.Equal(t, object.ErrFileNotFound, err)
+
+	versions, err = r.FileHistory("unrelated", "config.json", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"config.json=unrelated", "config.json=v1"}, versionContents(t, versions))
+
+	versions, err = r.FileHistory("master~1", "other.txt", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"other.txt=other 2", "other.txt=other"}, versionContents(t, versions))
+
+	versions, err = r.FileHistory("master", "missing.txt", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(versions))
+}
+
+func TestFileHistoryWithoutIndex(t *testing.T) {
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	commitToBranch(t, repo, "master", "a.txt", "1")
+	commitToBranch(t, repo, "master", "b.txt", "1")
+	commitToBranch(t, repo, "master", "a.txt", "2")
+
+	// the history was written before the path index existed
+	paths, err := db.Collection(context.Background(), "paths")
+	assert.Nil(t, err)
+	assert.Nil(t, paths.Truncate(context.Background()))
+
+	versions, err := repo.FileHistory("master", "a.txt", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt=2", "a.txt=1"}, versionContents(t, versions))
+
+	count, err := paths.Count(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), count)
+}
@@ -0,0 +1,83 @@
+package arangit
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// JSONResult is a JSON file matching a QueryJSON filter.
+type JSONResult struct {
+	Path     string
+	Hash     plumbing.Hash
+	Document json.RawMessage
+}
+
+// QueryJSON returns the JSON files at ref for which the AQL expression
+// filter is true. The parsed file is available as doc in filter, e.g.
+// "doc.age > @age && doc.company == @company". ref can be any revision,
+// which allows querying past versions through tags or commit hashes. Only
+// files committed while RepoOptions.ParseJSON was set are considered.
+// Filters that aren't a single expression over doc and bind variables, e.g.
+// ones that access collections, are rejected with
+// arangodb.ErrInvalidFilter. Values from untrusted input belong in
+// bindVars, never in filter.
+func (r *repository) QueryJSON(ref string, filter string, bindVars map[string]interface{}) ([]JSONResult, error) {
+	h, err := r.repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := r.commitTree(*h)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[plumbing.Hash][]string{}
+	var hashes []plumbing.Hash
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !entry.Mode.IsFile() {
+			continue
+		}
+		if _, ok := paths[entry.Hash]; !ok {
+			hashes = append(hashes, entry.Hash)
+		}
+		paths[entry.Hash] = append(paths[entry.Hash], name)
+	}
+
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	docs, err := r.store.QueryJSON(hashes, filter, bindVars)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []JSONResult
+	for _, doc := range docs {
+		h := plumbing.NewHash(doc.Hash)
+		for _, path := range paths[h] {
+			results = append(results, JSONResult{
+				Path:     path,
+				Hash:     h,
+				Document: doc.JSON,
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results, nil
+}
@@ -0,0 +1,87 @@
+package arangit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mhelmich/arangit/arangodb"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryJSON(t *testing.T) {
+	repo, err := OpenRepoFromDatabaseWithOptions(arangotest.NewDatabase("arangit"), &RepoOptions{ParseJSON: true})
+	assert.Nil(t, err)
+
+	for _, f := range [][]string{{"1.json", json1}, {"2.json", json2}, {"readme.txt", "age 99"}} {
+		err = repo.CommitFile(f[0], bytes.NewBufferString(f[1]))
+		assert.Nil(t, err)
+	}
+
+	err = repo.TagHead("v1")
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("3.json", bytes.NewBufferString(json3))
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("1.json", bytes.NewBufferString(`{"name":"Vang Pace","age":31,"company":"HINWAY"}`))
+	assert.Nil(t, err)
+
+	results, err := repo.QueryJSON("HEAD", "doc.age > @age", map[string]interface{}{"age": 25})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "1.json", results[0].Path)
+	assert.JSONEq(t, `{"name":"Vang Pace","age":31,"company":"HINWAY"}`, string(results[0].Document))
+	assert.Equal(t, "2.json", results[1].Path)
+
+	results, err = repo.QueryJSON("v1", "doc.age == 30", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "1.json", results[0].Path)
+	assert.JSONEq(t, json1, string(results[0].Document))
+
+	results, err = repo.QueryJSON("master", "doc.company == @company", map[string]interface{}{"company": "ROBOID"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "3.json", results[0].Path)
+
+	_, err = repo.QueryJSON("HEAD", "true", map[string]interface{}{"hashes": nil})
+	assert.Equal(t, arangodb.ErrReservedBindVar, err)
+
+	// filters can only be expressions over doc
+	for _, filter := range []string{
+		"doc.tags ANY == 'x' && doc.`FOR` IN [1, 2.5e3] && LOWER(doc.name) LIKE \"a%\"",
+		"{a: doc.age, \"b\": [doc.x ? doc.y : null]}.a > @age",
+	} {
+		_, err = repo.QueryJSON("HEAD", filter, map[string]interface{}{"age": 1})
+		assert.NotEqual(t, arangodb.ErrInvalidFilter, err, filter)
+	}
+	for _, filter := range []string{
+		"",
+		"1) FOR x IN refs REMOVE x IN refs //",
+		"true) RETURN 1 /*",
+		"LENGTH(refs) > 0",
+		"doc.a ? refs : 1",
+		"DOCUMENT('refs/x') != null",
+		"LENGTH(@@coll) > 0",
+		"MYNS::FUNC(doc)",
+		"doc.a == 'x",
+		"(doc.a",
+		"doc.a]",
+		"(FOR r IN refs RETURN r)",
+	} {
+		_, err = repo.QueryJSON("HEAD", filter, nil)
+		assert.Equal(t, arangodb.ErrInvalidFilter, err, filter)
+	}
+
+	// without the option nothing is parsed
+	repo, err = OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("1.json", bytes.NewBufferString(json1))
+	assert.Nil(t, err)
+
+	results, err = repo.QueryJSON("HEAD", "true", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(results))
+}
@@ -0,0 +1,270 @@
+package arangit
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const defaultKVDir = "kv"
+
+var (
+	// ErrKeyNotFound -
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrInvalidKey -
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrVersionMismatch is returned by the conditional KV operations if
+	// the current version of a key isn't the expected one.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// Version identifies the value of a key. Versions are equal if and only if
+// the values are equal.
+type Version string
+
+// NoVersion is the version of keys that don't exist. Passing it as the
+// expected version makes PutIfVersion fail if the key exists.
+const NoVersion Version = ""
+
+// KVOptions -
+type KVOptions struct {
+	// Branch is the branch the values are stored on, it defaults to the
+	// branch HEAD points to. A branch that doesn't exist is created by the
+	// first write as an orphan branch, i.e. a branch without a parent
+	// commit that only holds the values.
+	Branch string
+	// Dir is the directory the values are stored in, it defaults to "kv"
+	Dir string
+	// CommitOptions configure all commits made through the store. The
+	// messages default to "Put <key>" and "Delete <key>".
+	CommitOptions
+}
+
+// KVRevision is a change to the value of a key.
+type KVRevision struct {
+	Version Version
+	Value   []byte
+	Deleted bool
+	Commit  plumbing.Hash
+	When    time.Time
+}
+
+// KV is a versioned key-value store on top of a repository. Each key is a
+// file and each change is a commit, so the history of every key is kept.
+type KV struct {
+	repo   *repository
+	branch plumbing.ReferenceName
+	dir    string
+	commit CommitOptions
+}
+
+// KV returns a key-value store that keeps its values in the repository.
+func (r *repository) KV(opts *KVOptions) (*KV, error) {
+	if opts == nil {
+		opts = &KVOptions{}
+	}
+
+	branch, err := r.branchOrHead(opts.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = defaultKVDir
+	}
+
+	return &KV{
+		repo:   r,
+		branch: branch,
+		dir:    dir,
+		commit: opts.CommitOptions,
+	}, nil
+}
+
+// Get returns the value of key and its version.
+func (kv *KV) Get(key string) ([]byte, Version, error) {
+	p, err := kv.path(key)
+	if err != nil {
+		return nil, NoVersion, err
+	}
+
+	tree, err := kv.tree()
+	if err != nil {
+		return nil, NoVersion, err
+	}
+
+	f, err := kvFile(tree, p)
+	if err != nil {
+		return nil, NoVersion, err
+	} else if f == nil {
+		return nil, NoVersion, ErrKeyNotFound
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return nil, NoVersion, err
+	}
+	return []byte(content), Version(f.Hash.String()), nil
+}
+
+// Put sets the value of key and returns its new version.
+func (kv *KV) Put(key string, value []byte) (Version, error) {
+	return kv.put(key, value, nil)
+}
+
+// PutIfVersion sets the value of key if its current version is expected.
+// It returns ErrVersionMismatch otherwise.
+func (kv *KV) PutIfVersion(key string, value []byte, expected Version) (Version, error) {
+	return kv.put(key, value, &expected)
+}
+
+// Delete removes key. It returns ErrKeyNotFound if key doesn't exist.
+func (kv *KV) Delete(key string) error {
+	return kv.delete(key, nil)
+}
+
+// DeleteIfVersion removes key if its current version is expected. It
+// returns ErrVersionMismatch otherwise.
+func (kv *KV) DeleteIfVersion(key string, expected Version) error {
+	return kv.delete(key, &expected)
+}
+
+// History returns the changes made to key, the latest first. The changes
+// are looked up in the path index like FileHistory does, so changes merged
+// from other branches are included.
+func (kv *KV) History(key string) ([]KVRevision, error) {
+	p, err := kv.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = kv.repo.repo.Reference(kv.branch, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	versions, err := kv.repo.FileHistory(kv.branch.String(), p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]KVRevision, len(versions))
+	for i, v := range versions {
+		history[i] = KVRevision{
+			Deleted: v.Deleted(),
+			Commit:  v.Commit,
+			When:    v.When,
+		}
+		if v.Deleted() {
+			continue
+		}
+
+		history[i].Version = Version(v.Hash.String())
+		history[i].Value, err = v.Content()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+func (kv *KV) put(key string, value []byte, expected *Version) (Version, error) {
+	p, err := kv.path(key)
+	if err != nil {
+		return NoVersion, err
+	}
+
+	_, err = kv.repo.commitChanges(kv.branch, []fileChange{{Path: p, Content: value}}, kv.repo.commitInfo(&kv.commit, "Put "+key), kv.check(p, expected))
+	if err != nil && err != ErrNothingToCommit {
+		return NoVersion, err
+	}
+
+	return Version(plumbing.ComputeHash(plumbing.BlobObject, value).String()), nil
+}
+
+func (kv *KV) delete(key string, expected *Version) error {
+	p, err := kv.path(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.repo.commitChanges(kv.branch, []fileChange{{Path: p, Delete: true}}, kv.repo.commitInfo(&kv.commit, "Delete "+key), func(tree *object.Tree) error {
+		f, err := kvFile(tree, p)
+		if err != nil {
+			return err
+		} else if f == nil {
+			return ErrKeyNotFound
+		}
+		return kv.check(p, expected)(tree)
+	})
+	return err
+}
+
+// check returns a function that fails if the version of the file at p
+// isn't expected. It returns nil if expected is nil.
+func (kv *KV) check(p string, expected *Version) func(*object.Tree) error {
+	if expected == nil {
+		return nil
+	}
+
+	return func(tree *object.Tree) error {
+		f, err := kvFile(tree, p)
+		if err != nil {
+			return err
+		}
+
+		current := NoVersion
+		if f != nil {
+			current = Version(f.Hash.String())
+		}
+		if current != *expected {
+			return ErrVersionMismatch
+		}
+		return nil
+	}
+}
+
+func (kv *KV) tree() (*object.Tree, error) {
+	ref, err := kv.repo.repo.Reference(kv.branch, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return kv.repo.commitTree(ref.Hash())
+}
+
+// path returns the path of the file holding key. Keys are escaped so that
+// any non-empty key maps to a single file in dir.
+func (kv *KV) path(key string) (string, error) {
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+
+	name := url.PathEscape(key)
+	if strings.Trim(name, ".") == "" {
+		name = strings.Repeat("%2E", len(name))
+	}
+	return path.Join(kv.dir, name), nil
+}
+
+// kvFile returns the file at p in tree or nil if there is none.
+func kvFile(tree *object.Tree, p string) (*object.File, error) {
+	if tree == nil {
+		return nil, nil
+	}
+
+	f, err := tree.File(p)
+	if err == object.ErrFileNotFound {
+		return nil, nil
+	}
+	return f, err
+}
@@ -0,0 +1,110 @@
+package arangit
+
+import (
+	"testing"
+
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKV(t *testing.T) {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+
+	kv, err := repo.KV(&KVOptions{Branch: "data"})
+	assert.Nil(t, err)
+
+	_, _, err = kv.Get("users/1")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	v1, err := kv.PutIfVersion("users/1", []byte("alice"), NoVersion)
+	assert.Nil(t, err)
+
+	_, err = kv.PutIfVersion("users/1", []byte("bob"), NoVersion)
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	value, version, err := kv.Get("users/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", string(value))
+	assert.Equal(t, v1, version)
+
+	v2, err := kv.PutIfVersion("users/1", []byte("bob"), v1)
+	assert.Nil(t, err)
+	assert.NotEqual(t, v1, v2)
+
+	// putting the same value again is a no-op
+	v, err := kv.Put("users/1", []byte("bob"))
+	assert.Nil(t, err)
+	assert.Equal(t, v2, v)
+
+	err = kv.DeleteIfVersion("users/1", v1)
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	err = kv.DeleteIfVersion("users/1", v2)
+	assert.Nil(t, err)
+
+	err = kv.Delete("users/1")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = kv.Put("users/1", []byte("carol"))
+	assert.Nil(t, err)
+
+	_, err = kv.Put("..", []byte("dots"))
+	assert.Nil(t, err)
+	value, _, err = kv.Get("..")
+	assert.Nil(t, err)
+	assert.Equal(t, "dots", string(value))
+
+	_, err = kv.Put("", nil)
+	assert.Equal(t, ErrInvalidKey, err)
+
+	history, err := kv.History("users/1")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(history))
+	assert.Equal(t, "carol", string(history[0].Value))
+	assert.True(t, history[1].Deleted)
+	assert.Equal(t, v2, history[2].Version)
+	assert.Equal(t, "bob", string(history[2].Value))
+	assert.Equal(t, v1, history[3].Version)
+	assert.False(t, history[3].When.IsZero())
+
+	history, err = kv.History("unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(history))
+
+	// the values don't show up on the checked out branch
+	_, err = repo.ReadFileFromHead("kv/users%2F1")
+	assert.NotNil(t, err)
+
+	for _, name := range []string{"../x", "a..b"} {
+		_, err = repo.KV(&KVOptions{Branch: name})
+		assert.Equal(t, ErrInvalidBranchName, err, name)
+	}
+}
+
+func TestKVHistoryFollowsMerges(t *testing.T) {
+	r := openTestRepo(t)
+	data, err := r.KV(&KVOptions{Branch: "data"})
+	assert.Nil(t, err)
+	_, err = data.Put("a", []byte("1"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, r.CreateBranch("side", "data"))
+	side, err := r.KV(&KVOptions{Branch: "side"})
+	assert.Nil(t, err)
+	_, err = side.Put("a", []byte("2"))
+	assert.Nil(t, err)
+	sideCommit := headCommit(t, r, "side").Hash
+
+	_, err = data.Put("b", []byte("1"))
+	assert.Nil(t, err)
+	_, err = r.Merge("side", "data", nil)
+	assert.Nil(t, err)
+
+	history, err := data.History("a")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "2", string(history[0].Value))
+	assert.Equal(t, sideCommit, history[0].Commit)
+	assert.Equal(t, "1", string(history[1].Value))
+}
@@ -0,0 +1,79 @@
+package arangit
+
+import (
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// locks holds the locks that make repository safe for concurrent use.
+// Reads don't take any locks, objects never change once written and a
+// reference is read either before or after an update. To avoid deadlocks
+// reference locks are taken before the worktree lock and at most one
+// reference lock is held at a time.
+type locks struct {
+	// worktree guards the worktree, the index and HEAD
+	worktree sync.Mutex
+	// index serializes updates of the search indexes
+	index sync.Mutex
+
+	mu   sync.Mutex
+	refs map[plumbing.ReferenceName]*sync.Mutex
+}
+
+// lockRef serializes writes to the reference called name and returns the
+// function that releases the lock.
+func (r *repository) lockRef(name plumbing.ReferenceName) func() {
+	r.locks.mu.Lock()
+	if r.locks.refs == nil {
+		r.locks.refs = map[plumbing.ReferenceName]*sync.Mutex{}
+	}
+	mu, ok := r.locks.refs[name]
+	if !ok {
+		mu = &sync.Mutex{}
+		r.locks.refs[name] = mu
+	}
+	r.locks.mu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// lockWorktree locks the worktree and the branch HEAD points to, so that
+// commits made through the worktree don't race with commits made directly
+// to the branch. It returns the function that releases the locks.
+func (r *repository) lockWorktree() (func(), error) {
+	for {
+		head, err := r.repo.Reference(plumbing.HEAD, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if head.Type() != plumbing.SymbolicReference {
+			r.locks.worktree.Lock()
+			if r.headIs(head) {
+				return r.locks.worktree.Unlock, nil
+			}
+			r.locks.worktree.Unlock()
+			continue
+		}
+
+		unlockRef := r.lockRef(head.Target())
+		r.locks.worktree.Lock()
+		if r.headIs(head) {
+			return func() {
+				r.locks.worktree.Unlock()
+				unlockRef()
+			}, nil
+		}
+
+		// HEAD moved before we got the locks
+		r.locks.worktree.Unlock()
+		unlockRef()
+	}
+}
+
+func (r *repository) headIs(head *plumbing.Reference) bool {
+	current, err := r.repo.Reference(plumbing.HEAD, false)
+	return err == nil && current.String() == head.String()
+}
@@ -0,0 +1,171 @@
+package arangit
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentCommits(t *testing.T) {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("readme.txt", bytes.NewBufferString("v0"))
+	assert.Nil(t, err)
+	err = repo.TagHead("v0")
+	assert.Nil(t, err)
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*n)
+	for i := 0; i < n; i++ {
+		wg.Add(4)
+		go func(i int) {
+			defer wg.Done()
+			errs <- repo.CommitFile(fmt.Sprintf("%d.txt", i), bytes.NewBufferString(fmt.Sprint(i)))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			kv, err := repo.KV(&KVOptions{Branch: fmt.Sprintf("kv-%d", i%2)})
+			if err == nil {
+				_, err = kv.Put(fmt.Sprint(i), []byte(fmt.Sprint(i)))
+			}
+			errs <- err
+		}(i)
+		go func() {
+			defer wg.Done()
+			bites, err := repo.ReadFileFromTag("v0", "readme.txt")
+			if err == nil && string(bites) != "v0" {
+				err = fmt.Errorf("unexpected content %q", bites)
+			}
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := repo.Search("HEAD", "v0", nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+
+	// no commit got lost
+	for i := 0; i < n; i++ {
+		bites, err := repo.ReadFileFromHead(fmt.Sprintf("%d.txt", i))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprint(i), string(bites))
+
+		kv, err := repo.KV(&KVOptions{Branch: fmt.Sprintf("kv-%d", i%2)})
+		assert.Nil(t, err)
+		value, _, err := kv.Get(fmt.Sprint(i))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprint(i), string(value))
+	}
+
+	r := repo.(*repository)
+	head, err := r.repo.Head()
+	assert.Nil(t, err)
+	assert.Equal(t, n+1, len(firstParentHistory(t, r, head.Hash())))
+
+	// the worktree is clean, i.e. it matches HEAD
+	wt, err := r.repo.Worktree()
+	assert.Nil(t, err)
+	st, err := wt.Status()
+	assert.Nil(t, err)
+	assert.True(t, st.IsClean())
+}
+
+func TestConcurrentConditionalWrites(t *testing.T) {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+
+	const n = 8
+	var wg sync.WaitGroup
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every goroutine opens its own KV, so only the repository
+			// serializes the writes
+			kv, err := repo.KV(&KVOptions{Branch: "kv"})
+			if err == nil {
+				_, err = kv.PutIfVersion("key", []byte(fmt.Sprint(i)), NoVersion)
+			}
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.Equal(t, ErrVersionMismatch, err)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+
+	kv, err := repo.KV(&KVOptions{Branch: "kv"})
+	assert.Nil(t, err)
+	history, err := kv.History("key")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+}
+
+func TestLockWorktreeFollowsHead(t *testing.T) {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+	r := repo.(*repository)
+
+	err = repo.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+
+	unlock, err := r.lockWorktree()
+	assert.Nil(t, err)
+
+	// a direct commit to the checked out branch waits for the worktree
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := r.commitChanges(plumbing.NewBranchReferenceName("master"), []fileChange{{Path: "b.txt", Content: []byte("b")}}, r.commitInfo(nil, "b"), nil)
+		assert.Nil(t, err)
+	}()
+
+	err = r.writeFile("a.txt", bytes.NewBufferString("changed"))
+	assert.Nil(t, err)
+	_, err = repo.ReadFileFromHead("b.txt")
+	assert.Equal(t, object.ErrFileNotFound, err)
+	unlock()
+	<-done
+
+	bites, err := repo.ReadFileFromHead("b.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(bites))
+}
+
+// firstParentHistory returns the commits from h to the root commit following
+// the first parent of each commit.
+func firstParentHistory(t *testing.T, r *repository, h plumbing.Hash) []*object.Commit {
+	var commits []*object.Commit
+	for {
+		c, err := r.repo.CommitObject(h)
+		assert.Nil(t, err)
+		commits = append(commits, c)
+		if len(c.ParentHashes) == 0 {
+			return commits
+		}
+		h = c.ParentHashes[0]
+	}
+}
@@ -0,0 +1,447 @@
+package arangit
+
+import (
+	"container/heap"
+	"container/list"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	defaultLogLimit = 100
+	// logBatchSize is the number of commits the log walks ahead to look
+	// them up in the path index at once
+	logBatchSize = 100
+	// commitCacheSize is the maximum number of commits in the commit
+	// graph cache
+	commitCacheSize = 10000
+)
+
+// ErrInvalidCursor is returned by Log if the cursor wasn't returned by a
+// previous call or doesn't belong to the history of the ref.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// LogOptions -
+type LogOptions struct {
+	// Ref is the revision the log starts at, it defaults to HEAD
+	Ref string
+	// Path limits the log to commits that changed the file or directory at
+	// Path. Merge commits are only listed if Path differs from all parents.
+	Path string
+	// Author limits the log to commits whose author contains Author,
+	// ignoring case. The author is matched as "Name <email>".
+	Author string
+	// Since limits the log to commits committed at or after Since. Like git
+	// log the walk stops at the first older commit.
+	Since time.Time
+	// Until limits the log to commits committed at or before Until
+	Until time.Time
+	// Message limits the log to commits whose message contains Message
+	Message string
+	// Limit is the maximum number of commits returned, it defaults to 100
+	Limit int
+	// Cursor continues the log where the page it was returned with ended
+	Cursor string
+}
+
+// LogPage is a page of the commit log, newest commits first.
+type LogPage struct {
+	Commits []*object.Commit
+	// Cursor returns the next page if passed in LogOptions, it's empty if
+	// there are no more commits. The cursor pins the commit the log
+	// started at, so later pages don't change when the ref moves.
+	Cursor string
+}
+
+// Log returns the commits reachable from opts.Ref that match opts, ordered
+// by commit time with the newest commit first. The commit graph is read
+// from the database as the walk reaches it and cached. Path is answered
+// from the path index, so only merge commits have their trees read.
+func (r *repository) Log(opts *LogOptions) (*LogPage, error) {
+	if opts == nil {
+		opts = &LogOptions{}
+	}
+
+	var tip, last plumbing.Hash
+	if opts.Cursor != "" {
+		var err error
+		tip, last, err = decodeLogCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		rev := opts.Ref
+		if rev == "" {
+			rev = plumbing.HEAD.String()
+		}
+
+		h, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return nil, err
+		}
+		tip = *h
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+
+	w, err := r.newLogWalker(tip)
+	if err != nil {
+		return nil, err
+	}
+
+	if !last.IsZero() {
+		err = w.skipPast(last)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filter := newLogFilter(r, opts)
+	page := &LogPage{}
+	for {
+		batch, err := w.take(logBatchSize)
+		if err != nil {
+			return nil, err
+		} else if len(batch) == 0 {
+			return page, nil
+		}
+
+		err = filter.index(batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range batch {
+			if !opts.Since.IsZero() && c.Committer.When.Before(opts.Since) {
+				return page, nil
+			}
+
+			ok, err := filter.match(c)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+
+			if len(page.Commits) == limit {
+				// only hand out a cursor if there is another commit
+				page.Cursor = encodeLogCursor(tip, page.Commits[limit-1].Hash)
+				return page, nil
+			}
+			page.Commits = append(page.Commits, c)
+		}
+	}
+}
+
+func encodeLogCursor(tip plumbing.Hash, last plumbing.Hash) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(tip.String() + ":" + last.String()))
+}
+
+func decodeLogCursor(cursor string) (plumbing.Hash, plumbing.Hash, error) {
+	bites, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(bites), ":")
+	if len(parts) != 2 || len(parts[0]) != 40 || len(parts[1]) != 40 {
+		return plumbing.ZeroHash, plumbing.ZeroHash, ErrInvalidCursor
+	}
+	return plumbing.NewHash(parts[0]), plumbing.NewHash(parts[1]), nil
+}
+
+// logFilter matches commits against the filters of LogOptions.
+type logFilter struct {
+	r       *repository
+	opts    *LogOptions
+	path    string
+	author  string
+	entries map[plumbing.Hash]plumbing.Hash
+	// changed holds the commits that changed the path according to the
+	// path index, it's loaded when the first commit is matched
+	changed map[plumbing.Hash]bool
+	// indexed holds the commits known to be in the path index
+	indexed map[plumbing.Hash]bool
+}
+
+func newLogFilter(r *repository, opts *LogOptions) *logFilter {
+	return &logFilter{
+		r:       r,
+		opts:    opts,
+		path:    cleanPath(opts.Path),
+		author:  strings.ToLower(opts.Author),
+		entries: map[plumbing.Hash]plumbing.Hash{},
+		indexed: map[plumbing.Hash]bool{},
+	}
+}
+
+// index makes sure commits are in the path index before they're matched
+// against the path of the filter.
+func (f *logFilter) index(commits []*object.Commit) error {
+	if f.path == "" {
+		return nil
+	}
+
+	var hashes []plumbing.Hash
+	for _, c := range commits {
+		if !f.indexed[c.Hash] {
+			hashes = append(hashes, c.Hash)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	added, err := f.r.store.IndexPaths(hashes)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		f.indexed[h] = true
+	}
+	if added {
+		f.changed = nil
+	}
+	return nil
+}
+
+// changes returns the commits that changed the path of the filter or a
+// file below it compared to their first parent.
+func (f *logFilter) changes() (map[plumbing.Hash]bool, error) {
+	if f.changed != nil {
+		return f.changed, nil
+	}
+
+	files, err := f.r.store.PathChanges(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, err := f.r.store.DirChanges(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.changed = map[plumbing.Hash]bool{}
+	for _, ch := range append(files, dirs...) {
+		f.changed[plumbing.NewHash(ch.Commit)] = true
+	}
+	return f.changed, nil
+}
+
+func (f *logFilter) match(c *object.Commit) (bool, error) {
+	if !f.opts.Until.IsZero() && c.Committer.When.After(f.opts.Until) {
+		return false, nil
+	} else if f.author != "" && !strings.Contains(strings.ToLower(c.Author.Name+" <"+c.Author.Email+">"), f.author) {
+		return false, nil
+	} else if !strings.Contains(c.Message, f.opts.Message) {
+		return false, nil
+	} else if f.path == "" {
+		return true, nil
+	}
+
+	if len(c.ParentHashes) < 2 {
+		err := f.index([]*object.Commit{c})
+		if err != nil {
+			return false, err
+		}
+
+		changed, err := f.changes()
+		if err != nil {
+			return false, err
+		}
+		return changed[c.Hash], nil
+	}
+
+	// the path index compares merge commits to their first parent only
+	h, err := f.entry(c.Hash)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range c.ParentHashes {
+		ph, err := f.entry(p)
+		if err != nil {
+			return false, err
+		} else if ph == h {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// entry returns the hash of the tree entry at the path of the filter in
+// the commit h or the zero hash if there is none.
+func (f *logFilter) entry(h plumbing.Hash) (plumbing.Hash, error) {
+	if eh, ok := f.entries[h]; ok {
+		return eh, nil
+	}
+
+	c, err := f.r.graphCommit(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	e, err := treeEntry(tree, f.path)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var eh plumbing.Hash
+	if e != nil {
+		eh = e.Hash
+	}
+	f.entries[h] = eh
+	return eh, nil
+}
+
+// logWalker walks the history of a commit newest commit first.
+type logWalker struct {
+	r     *repository
+	queue commitQueue
+	seen  map[plumbing.Hash]bool
+}
+
+func (r *repository) newLogWalker(tip plumbing.Hash) (*logWalker, error) {
+	c, err := r.graphCommit(tip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logWalker{
+		r:     r,
+		queue: commitQueue{c},
+		seen:  map[plumbing.Hash]bool{tip: true},
+	}, nil
+}
+
+// take returns up to n next commits, none if the history is exhausted.
+func (w *logWalker) take(n int) ([]*object.Commit, error) {
+	var commits []*object.Commit
+	for len(commits) < n {
+		c, err := w.next()
+		if err != nil {
+			return nil, err
+		} else if c == nil {
+			break
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// next returns the next commit or nil if the history is exhausted.
+func (w *logWalker) next() (*object.Commit, error) {
+	if len(w.queue) == 0 {
+		return nil, nil
+	}
+
+	c := heap.Pop(&w.queue).(*object.Commit)
+	for _, p := range c.ParentHashes {
+		if w.seen[p] {
+			continue
+		}
+
+		pc, err := w.r.graphCommit(p)
+		if err != nil {
+			return nil, err
+		}
+		w.seen[p] = true
+		heap.Push(&w.queue, pc)
+	}
+	return c, nil
+}
+
+// skipPast skips all commits up to and including last. It returns
+// ErrInvalidCursor if last isn't part of the history.
+func (w *logWalker) skipPast(last plumbing.Hash) error {
+	for {
+		c, err := w.next()
+		if err != nil {
+			return err
+		} else if c == nil {
+			return ErrInvalidCursor
+		} else if c.Hash == last {
+			return nil
+		}
+	}
+}
+
+// commitQueue is a heap of commits ordered by commit time, newest first.
+// Commits with the same time are ordered by hash to keep the order stable.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int      { return len(q) }
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q commitQueue) Less(i, j int) bool {
+	ti, tj := q[i].Committer.When, q[j].Committer.When
+	if !ti.Equal(tj) {
+		return ti.After(tj)
+	}
+	return q[i].Hash.String() < q[j].Hash.String()
+}
+
+func (q *commitQueue) Push(x interface{}) {
+	*q = append(*q, x.(*object.Commit))
+}
+
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// commitGraph caches commits, which never change once written. Commits are
+// loaded one by one when they are looked up, the least recently used ones
+// are evicted once the cache holds commitCacheSize commits.
+type commitGraph struct {
+	mu      sync.Mutex
+	order   *list.List
+	commits map[plumbing.Hash]*list.Element
+}
+
+// graphCommit returns the commit h from the commit graph cache.
+func (r *repository) graphCommit(h plumbing.Hash) (*object.Commit, error) {
+	g := &r.commits
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if e, ok := g.commits[h]; ok {
+		g.order.MoveToFront(e)
+		return e.Value.(*object.Commit), nil
+	}
+
+	c, err := r.repo.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.commits == nil {
+		g.order = list.New()
+		g.commits = map[plumbing.Hash]*list.Element{}
+	}
+	g.commits[h] = g.order.PushFront(c)
+	if g.order.Len() > commitCacheSize {
+		last := g.order.Back()
+		g.order.Remove(last)
+		delete(g.commits, last.Value.(*object.Commit).Hash)
+	}
+	return c, nil
+}
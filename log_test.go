@@ -0,0 +1,179 @@
+package arangit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func at(minutes int) time.Time {
+	return testTime.Add(time.Duration(minutes) * time.Minute)
+}
+
+func logMessages(t *testing.T, r Repository, opts *LogOptions) []string {
+	page, err := r.Log(opts)
+	assert.Nil(t, err)
+	return commitMessages(page.Commits)
+}
+
+func commitMessages(commits []*object.Commit) []string {
+	var messages []string
+	for _, c := range commits {
+		messages = append(messages, c.Message)
+	}
+	return messages
+}
+
+// newLogRepo returns a repository whose master branch merged a feature
+// branch, each commit is a minute younger than its predecessor.
+func newLogRepo(t *testing.T) *repository {
+	r := openTestRepo(t)
+	commit := func(branch string, p string, message string, author *object.Signature, when time.Time) {
+		err := r.CommitFileToBranch(branch, p, bytes.NewBufferString(message), &CommitOptions{Author: author, Message: message, When: when})
+		assert.Nil(t, err)
+	}
+
+	commit("master", "a.txt", "Add a", alice, at(1))
+	commit("master", "config/app.json", "Add config", bob, at(2))
+	assert.Nil(t, r.CreateBranch("feature", ""))
+	commit("feature", "config/app.json", "Update config", alice, at(3))
+	commit("master", "a.txt", "Update a", bob, at(4))
+	_, err := r.Merge("feature", "master", &MergeOptions{CommitOptions: CommitOptions{When: at(5)}})
+	assert.Nil(t, err)
+	return r
+}
+
+func TestLog(t *testing.T) {
+	r := newLogRepo(t)
+
+	all := []string{"Merge feature into master", "Update a", "Update config", "Add config", "Add a"}
+	assert.Equal(t, all, logMessages(t, r, nil))
+	assert.Equal(t, all, logMessages(t, r, &LogOptions{Ref: "master"}))
+	assert.Equal(t, []string{"Update config", "Add config", "Add a"}, logMessages(t, r, &LogOptions{Ref: "feature"}))
+	assert.Equal(t, []string{"Add config", "Add a"}, logMessages(t, r, &LogOptions{Ref: "master~2"}))
+
+	_, err := r.Log(&LogOptions{Ref: "unknown"})
+	assert.Equal(t, plumbing.ErrReferenceNotFound, err)
+}
+
+func TestLogFilters(t *testing.T) {
+	r := newLogRepo(t)
+
+	for _, tc := range []struct {
+		opts     *LogOptions
+		messages []string
+	}{
+		{&LogOptions{Path: "config"}, []string{"Update config", "Add config"}},
+		{&LogOptions{Path: "/config/app.json"}, []string{"Update config", "Add config"}},
+		{&LogOptions{Path: "a.txt"}, []string{"Update a", "Add a"}},
+		{&LogOptions{Path: "b.txt"}, nil},
+		{&LogOptions{Author: "ALICE"}, []string{"Update config", "Add a"}},
+		{&LogOptions{Author: "bob@example.com"}, []string{"Update a", "Add config"}},
+		{&LogOptions{Since: at(3)}, []string{"Merge feature into master", "Update a", "Update config"}},
+		{&LogOptions{Until: at(2)}, []string{"Add config", "Add a"}},
+		{&LogOptions{Since: at(2), Until: at(4)}, []string{"Update a", "Update config", "Add config"}},
+		{&LogOptions{Message: "config"}, []string{"Update config", "Add config"}},
+		{&LogOptions{Message: "Update", Author: "bob", Path: "a.txt"}, []string{"Update a"}},
+	} {
+		assert.Equal(t, tc.messages, logMessages(t, r, tc.opts), "%+v", tc.opts)
+	}
+}
+
+func TestLogPathWithoutIndex(t *testing.T) {
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	commitToBranch(t, repo, "master", "dir/a.txt", "1")
+	commitToBranch(t, repo, "master", "b.txt", "1")
+	commitToBranch(t, repo, "master", "dir/a.txt", "2")
+
+	// the history was written before the path index existed
+	paths, err := db.Collection(context.Background(), "paths")
+	assert.Nil(t, err)
+	assert.Nil(t, paths.Truncate(context.Background()))
+
+	page, err := repo.Log(&LogOptions{Path: "dir"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Commits))
+	page, err = repo.Log(&LogOptions{Path: "b.txt"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(page.Commits))
+}
+
+func TestLogLoadsWalkedCommitsOnly(t *testing.T) {
+	r := newLogRepo(t)
+	assert.Nil(t, r.CreateBranch("unrelated", "master"))
+	assert.Nil(t, r.CommitFileToBranch("unrelated", "u.txt", bytes.NewBufferString("u"), nil))
+
+	r.commits = commitGraph{}
+	page, err := r.Log(&LogOptions{Ref: "feature", Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(page.Commits))
+	// the walk is a batch ahead of the page but never leaves the history
+	// of feature
+	assert.Equal(t, 3, len(r.commits.commits))
+}
+
+func TestLogPagination(t *testing.T) {
+	r := newLogRepo(t)
+
+	page, err := r.Log(&LogOptions{Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Merge feature into master", "Update a"}, commitMessages(page.Commits))
+	assert.NotEqual(t, "", page.Cursor)
+
+	// the cursor pins the start of the log, new commits don't shift pages
+	err = r.CommitFileToBranch("master", "b.txt", bytes.NewBufferString("b"), &CommitOptions{When: at(6)})
+	assert.Nil(t, err)
+
+	page, err = r.Log(&LogOptions{Limit: 2, Cursor: page.Cursor})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Update config", "Add config"}, commitMessages(page.Commits))
+
+	page, err = r.Log(&LogOptions{Limit: 2, Cursor: page.Cursor})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Add a"}, commitMessages(page.Commits))
+	assert.Equal(t, "", page.Cursor)
+
+	// no cursor if the last page is full
+	page, err = r.Log(&LogOptions{Path: "a.txt", Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Commits))
+	assert.Equal(t, "", page.Cursor)
+
+	// filters apply to all pages
+	page, err = r.Log(&LogOptions{Author: "alice", Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Update config"}, commitMessages(page.Commits))
+	page, err = r.Log(&LogOptions{Author: "alice", Limit: 1, Cursor: page.Cursor})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Add a"}, commitMessages(page.Commits))
+
+	for _, cursor := range []string{"nope", encodeLogCursor(plumbing.ZeroHash, plumbing.ZeroHash)} {
+		_, err = r.Log(&LogOptions{Cursor: cursor})
+		assert.NotNil(t, err)
+	}
+	tip := headCommit(t, r, "HEAD").Hash
+	_, err = r.Log(&LogOptions{Cursor: encodeLogCursor(tip, plumbing.ComputeHash(plumbing.CommitObject, nil))})
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestLogSeesCommitsOfOtherRepositories(t *testing.T) {
+	db := arangotest.NewDatabase("arangit")
+	r1, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+	assert.Nil(t, r1.CommitFile("a.txt", bytes.NewBufferString("a")))
+	assert.Equal(t, []string{"Update a.txt"}, logMessages(t, r1, nil))
+
+	r2, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+	assert.Nil(t, r2.CommitFileToBranch("master", "b.txt", bytes.NewBufferString("b"), nil))
+	assert.Equal(t, []string{"Update b.txt", "Update a.txt"}, logMessages(t, r1, &LogOptions{Ref: "master"}))
+}
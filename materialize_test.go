@@ -0,0 +1,78 @@
+package arangit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/mhelmich/arangit/arangodb"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func readMaterialized(t *testing.T, db driver.Database, coll string) map[string]arangodb.MaterializedDocument {
+	cursor, err := db.Query(context.Background(), "FOR d IN @@coll RETURN d", map[string]interface{}{"@coll": coll})
+	assert.Nil(t, err)
+	defer cursor.Close()
+
+	docs := map[string]arangodb.MaterializedDocument{}
+	for cursor.HasMore() {
+		var doc arangodb.MaterializedDocument
+		_, err = cursor.ReadDocument(context.Background(), &doc)
+		assert.Nil(t, err)
+		docs[doc.Path] = doc
+	}
+	return docs
+}
+
+func TestMaterialize(t *testing.T) {
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabaseWithOptions(db, &RepoOptions{
+		Materialize: map[string]string{
+			"refs/heads/master": "master_files",
+			"refs/tags/v1":      "v1_files",
+		},
+	})
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("a.txt", bytes.NewBufferString("hello"))
+	assert.Nil(t, err)
+	err = repo.CommitFile("1.json", bytes.NewBufferString(json1))
+	assert.Nil(t, err)
+
+	docs := readMaterialized(t, db, "master_files")
+	assert.Equal(t, 2, len(docs))
+	assert.Equal(t, "hello", *docs["a.txt"].Content)
+	assert.Equal(t, int64(5), docs["a.txt"].Size)
+	assert.Equal(t, "0100644", docs["a.txt"].Mode)
+	assert.Nil(t, docs["a.txt"].JSON)
+	assert.JSONEq(t, json1, string(docs["1.json"].JSON))
+	assert.Equal(t, 0, len(readMaterialized(t, db, "v1_files")))
+
+	err = repo.TagHead("v1")
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("a.txt", bytes.NewBuffer([]byte{0, 1, 2}))
+	assert.Nil(t, err)
+
+	docs = readMaterialized(t, db, "master_files")
+	assert.Equal(t, 2, len(docs))
+	assert.Nil(t, docs["a.txt"].Content)
+	assert.Equal(t, []byte{0, 1, 2}, docs["a.txt"].Data)
+
+	docs = readMaterialized(t, db, "v1_files")
+	assert.Equal(t, 2, len(docs))
+	assert.Equal(t, "hello", *docs["a.txt"].Content)
+
+	// collections configured later catch up when the repository is opened
+	_, err = OpenRepoFromDatabaseWithOptions(db, &RepoOptions{
+		Materialize: map[string]string{"refs/heads/master": "other_files"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, readMaterialized(t, db, "master_files"), readMaterialized(t, db, "other_files"))
+
+	err = repo.DeleteTag("v1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(readMaterialized(t, db, "v1_files")))
+}
@@ -0,0 +1,307 @@
+package arangit
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrMergeConflict is returned by Merge if the branches conflict and the
+// strategy is MergeFail. The conflicts are listed in the returned result.
+var ErrMergeConflict = errors.New("merge conflict")
+
+// MergeStrategy decides how Merge resolves conflicting files.
+type MergeStrategy int
+
+const (
+	// MergeFail doesn't merge branches that conflict
+	MergeFail MergeStrategy = iota
+	// MergeOurs keeps the version of the target branch
+	MergeOurs
+	// MergeTheirs takes the version of the source revision
+	MergeTheirs
+)
+
+// MergeOptions -
+type MergeOptions struct {
+	// Strategy defaults to MergeFail
+	Strategy MergeStrategy
+	// NoFastForward creates a merge commit even if the target branch could
+	// be fast-forwarded
+	NoFastForward bool
+	// CommitOptions configure the merge commit, the message defaults to
+	// "Merge <source> into <target>"
+	CommitOptions
+}
+
+// MergeConflict is a file that was changed differently on both sides. The
+// hashes are plumbing.ZeroHash if the file doesn't exist on that side, so a
+// file deleted on one side and modified on the other has a zero Ours or
+// Theirs. A file that clashes with a directory on the other side has a zero
+// Base, Ours and Theirs.
+type MergeConflict struct {
+	Path   string
+	Base   plumbing.Hash
+	Ours   plumbing.Hash
+	Theirs plumbing.Hash
+	// Pointers are the conflicting locations in the file if a merge driver
+	// merged it, see RepoOptions.MergeDrivers
+	Pointers []string
+}
+
+// MergeResult -
+type MergeResult struct {
+	// Commit is the commit the target branch points to after the merge
+	Commit plumbing.Hash
+	// UpToDate is set if the source was already merged into the target
+	UpToDate bool
+	// FastForward is set if the target branch was moved to the source
+	FastForward bool
+	// Conflicts are the conflicting files. They were resolved according to
+	// the strategy unless the strategy is MergeFail.
+	Conflicts []MergeConflict
+}
+
+// Merge merges the revision source into the branch called target. The
+// target is fast-forwarded if it's an ancestor of source, otherwise the
+// trees are merged file by file against the merge base and a merge commit
+// with the target and source as parents is created. Files changed on one
+// side only are taken from that side, files changed differently on both
+// sides are conflicts unless a merge driver of the repository merges them.
+// With MergeFail nothing is committed if there are conflicts and
+// ErrMergeConflict is returned along with the result.
+func (r *repository) Merge(source string, target string, opts *MergeOptions) (*MergeResult, error) {
+	if opts == nil {
+		opts = &MergeOptions{}
+	}
+
+	branch, err := branchReferenceName(target)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := r.repo.ResolveRevision(plumbing.Revision(source))
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := r.repo.CommitObject(*h)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.lockRef(branch)()
+	old, err := r.repo.Reference(branch, false)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, ErrBranchNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	ours, err := r.repo.CommitObject(old.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := theirs.IsAncestor(ours)
+	if err != nil {
+		return nil, err
+	} else if merged {
+		return &MergeResult{Commit: ours.Hash, UpToDate: true}, nil
+	}
+
+	ff, err := ours.IsAncestor(theirs)
+	if err != nil {
+		return nil, err
+	} else if ff && !opts.NoFastForward {
+		err = r.updateBranch(branch, old, theirs.Hash)
+		if err != nil {
+			return nil, err
+		}
+		return &MergeResult{Commit: theirs.Hash, FastForward: true}, nil
+	}
+
+	files, conflicts, err := r.mergeCommits(ours, theirs, opts.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MergeResult{Commit: ours.Hash, Conflicts: conflicts}
+	if len(conflicts) > 0 && opts.Strategy == MergeFail {
+		return result, ErrMergeConflict
+	}
+
+	info := r.commitInfo(&opts.CommitOptions, "Merge "+source+" into "+branch.Short())
+	result.Commit, err = r.writeCommit(files, []plumbing.Hash{ours.Hash, theirs.Hash}, info)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.updateBranch(branch, old, result.Commit)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergeCommits merges the trees of ours and theirs against the tree of
+// their merge base. Commits without a common ancestor are merged against
+// an empty tree. If there are several merge bases the first one is used.
+func (r *repository) mergeCommits(ours, theirs *object.Commit, strategy MergeStrategy) (map[string]object.TreeEntry, []MergeConflict, error) {
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var baseTree *object.Tree
+	if len(bases) > 0 {
+		baseTree, err = bases[0].Tree()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	base, err := treeEntries(baseTree)
+	if err != nil {
+		return nil, nil, err
+	}
+	oursFiles, err := commitEntries(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	theirsFiles, err := commitEntries(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths := map[string]bool{}
+	for _, files := range []map[string]object.TreeEntry{base, oursFiles, theirsFiles} {
+		for p := range files {
+			paths[p] = true
+		}
+	}
+
+	files := map[string]object.TreeEntry{}
+	var conflicts []MergeConflict
+	for p := range paths {
+		b, bok := base[p]
+		o, ook := oursFiles[p]
+		t, tok := theirsFiles[p]
+
+		var e object.TreeEntry
+		var ok bool
+		switch {
+		case sameEntry(o, ook, t, tok):
+			e, ok = o, ook
+		case sameEntry(b, bok, o, ook):
+			e, ok = t, tok
+		case sameEntry(b, bok, t, tok):
+			e, ok = o, ook
+		default:
+			conflict := MergeConflict{
+				Path:   p,
+				Base:   b.Hash,
+				Ours:   o.Hash,
+				Theirs: t.Hash,
+			}
+
+			driver := r.mergeDriverFor(p)
+			if driver != nil && ook && tok && o.Mode == t.Mode && o.Mode.IsFile() && o.Mode != filemode.Symlink {
+				merged, pointers, ok, err := r.mergeWithDriver(driver, b, bok, o, t, strategy)
+				if err != nil {
+					return nil, nil, err
+				} else if ok && (len(pointers) == 0 || strategy != MergeFail) {
+					files[p] = merged
+					if len(pointers) > 0 {
+						conflict.Pointers = pointers
+						conflicts = append(conflicts, conflict)
+					}
+					continue
+				} else if ok {
+					conflict.Pointers = pointers
+				}
+			}
+
+			conflicts = append(conflicts, conflict)
+			if strategy == MergeTheirs {
+				e, ok = t, tok
+			} else {
+				e, ok = o, ook
+			}
+		}
+
+		if ok {
+			files[p] = e
+		}
+	}
+
+	conflicts = append(conflicts, resolveDirectoryClashes(files, oursFiles, theirsFiles, strategy)...)
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return files, conflicts, nil
+}
+
+// resolveDirectoryClashes finds the files in files that are also the
+// parent directory of another file, which happens if one side added a file
+// where the other side added a directory. It removes the entries of the
+// losing side from files and returns the clashes as conflicts.
+func resolveDirectoryClashes(files, ours, theirs map[string]object.TreeEntry, strategy MergeStrategy) []MergeConflict {
+	winner := ours
+	if strategy == MergeTheirs {
+		winner = theirs
+	}
+
+	var conflicts []MergeConflict
+	for p := range files {
+		clash := false
+		for dir := parentDir(p); dir != ""; dir = parentDir(dir) {
+			if _, ok := files[dir]; ok {
+				clash = true
+				conflicts = append(conflicts, MergeConflict{Path: dir})
+			}
+		}
+		if clash {
+			conflicts = append(conflicts, MergeConflict{Path: p})
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	unique := conflicts[:0]
+	for _, c := range conflicts {
+		if !seen[c.Path] {
+			seen[c.Path] = true
+			unique = append(unique, c)
+		}
+		if _, ok := winner[c.Path]; !ok {
+			delete(files, c.Path)
+		}
+	}
+	return unique
+}
+
+func commitEntries(c *object.Commit) (map[string]object.TreeEntry, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return treeEntries(tree)
+}
+
+func parentDir(p string) string {
+	i := strings.LastIndexByte(p, '/')
+	if i < 0 {
+		return ""
+	}
+	return p[:i]
+}
+
+func sameEntry(a object.TreeEntry, aok bool, b object.TreeEntry, bok bool) bool {
+	if !aok || !bok {
+		return aok == bok
+	}
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
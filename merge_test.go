@@ -0,0 +1,169 @@
+package arangit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMergeRepo returns a repository with a master and a feature branch that
+// both start at a commit containing a.txt and b.txt.
+func newMergeRepo(t *testing.T) Repository {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.CommitFile("a.txt", bytes.NewBufferString("a")))
+	assert.Nil(t, repo.CommitFile("b.txt", bytes.NewBufferString("b")))
+	assert.Nil(t, repo.CreateBranch("feature", ""))
+	return repo
+}
+
+func commitToBranch(t *testing.T, repo Repository, branch string, path string, content string) {
+	assert.Nil(t, repo.CommitFileToBranch(branch, path, bytes.NewBufferString(content), nil))
+}
+
+func readString(t *testing.T, repo Repository, rev string, path string) string {
+	bites, err := repo.ReadFile(rev, path)
+	assert.Nil(t, err)
+	return string(bites)
+}
+
+func TestMergeFastForward(t *testing.T) {
+	repo := newMergeRepo(t)
+	commitToBranch(t, repo, "feature", "c.txt", "c")
+
+	result, err := repo.Merge("master", "feature", nil)
+	assert.Nil(t, err)
+	assert.True(t, result.UpToDate)
+
+	result, err = repo.Merge("feature", "master", nil)
+	assert.Nil(t, err)
+	assert.True(t, result.FastForward)
+
+	h, err := repo.(*repository).repo.ResolveRevision("feature")
+	assert.Nil(t, err)
+	assert.Equal(t, *h, result.Commit)
+	assert.Equal(t, "c", readString(t, repo, "HEAD", "c.txt"))
+
+	result, err = repo.Merge("feature", "master", nil)
+	assert.Nil(t, err)
+	assert.True(t, result.UpToDate)
+
+	_, err = repo.Merge("feature", "unknown", nil)
+	assert.Equal(t, ErrBranchNotFound, err)
+}
+
+func TestMergeNoFastForward(t *testing.T) {
+	repo := newMergeRepo(t)
+	commitToBranch(t, repo, "feature", "c.txt", "c")
+
+	result, err := repo.Merge("feature", "master", &MergeOptions{NoFastForward: true, CommitOptions: CommitOptions{Message: "merge it"}})
+	assert.Nil(t, err)
+	assert.False(t, result.FastForward)
+
+	c, err := repo.(*repository).repo.CommitObject(result.Commit)
+	assert.Nil(t, err)
+	assert.Equal(t, "merge it", c.Message)
+	assert.Equal(t, 2, c.NumParents())
+	assert.Equal(t, "c", readString(t, repo, "master", "c.txt"))
+}
+
+func TestMergeThreeWay(t *testing.T) {
+	repo := newMergeRepo(t)
+	commitToBranch(t, repo, "master", "a.txt", "a on master")
+	commitToBranch(t, repo, "master", "c.txt", "c")
+	commitToBranch(t, repo, "feature", "b.txt", "b on feature")
+	commitToBranch(t, repo, "feature", "dir/d.txt", "d")
+	master, err := repo.(*repository).repo.ResolveRevision("master")
+	assert.Nil(t, err)
+
+	result, err := repo.Merge("feature", "master", nil)
+	assert.Nil(t, err)
+	assert.False(t, result.FastForward)
+	assert.Equal(t, 0, len(result.Conflicts))
+
+	c, err := repo.(*repository).repo.CommitObject(result.Commit)
+	assert.Nil(t, err)
+	assert.Equal(t, "Merge feature into master", c.Message)
+	assert.Equal(t, *master, c.ParentHashes[0])
+
+	assert.Equal(t, "a on master", readString(t, repo, "master", "a.txt"))
+	assert.Equal(t, "b on feature", readString(t, repo, "master", "b.txt"))
+	assert.Equal(t, "c", readString(t, repo, "master", "c.txt"))
+	assert.Equal(t, "d", readString(t, repo, "master", "dir/d.txt"))
+
+	// the checked out branch was merged, so the worktree follows
+	wt, err := repo.(*repository).repo.Worktree()
+	assert.Nil(t, err)
+	st, err := wt.Status()
+	assert.Nil(t, err)
+	assert.True(t, st.IsClean())
+}
+
+func TestMergeConflicts(t *testing.T) {
+	repo := newMergeRepo(t)
+	r := repo.(*repository)
+	commitToBranch(t, repo, "master", "a.txt", "a on master")
+	commitToBranch(t, repo, "feature", "a.txt", "a on feature")
+	_, err := r.commitChanges(plumbing.NewBranchReferenceName("feature"), []fileChange{{Path: "b.txt", Delete: true}}, r.commitInfo(nil, "delete b"), nil)
+	assert.Nil(t, err)
+	commitToBranch(t, repo, "master", "b.txt", "b on master")
+	master, err := r.repo.ResolveRevision("master")
+	assert.Nil(t, err)
+
+	result, err := repo.Merge("feature", "master", nil)
+	assert.Equal(t, ErrMergeConflict, err)
+	assert.Equal(t, *master, result.Commit)
+	assert.Equal(t, 2, len(result.Conflicts))
+	assert.Equal(t, "a.txt", result.Conflicts[0].Path)
+	assert.Equal(t, plumbing.ComputeHash(plumbing.BlobObject, []byte("a")), result.Conflicts[0].Base)
+	assert.Equal(t, plumbing.ComputeHash(plumbing.BlobObject, []byte("a on master")), result.Conflicts[0].Ours)
+	assert.Equal(t, plumbing.ComputeHash(plumbing.BlobObject, []byte("a on feature")), result.Conflicts[0].Theirs)
+	assert.Equal(t, "b.txt", result.Conflicts[1].Path)
+	assert.Equal(t, plumbing.ZeroHash, result.Conflicts[1].Theirs)
+
+	// nothing was committed
+	h, err := r.repo.ResolveRevision("master")
+	assert.Nil(t, err)
+	assert.Equal(t, *master, *h)
+
+	result, err = repo.Merge("feature", "master", &MergeOptions{Strategy: MergeTheirs})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.Conflicts))
+	assert.Equal(t, "a on feature", readString(t, repo, "master", "a.txt"))
+	_, err = repo.ReadFile("master", "b.txt")
+	assert.Equal(t, object.ErrFileNotFound, err)
+}
+
+func TestMergeOurs(t *testing.T) {
+	repo := newMergeRepo(t)
+	commitToBranch(t, repo, "master", "a.txt", "a on master")
+	commitToBranch(t, repo, "feature", "a.txt", "a on feature")
+	commitToBranch(t, repo, "feature", "c.txt", "c")
+
+	result, err := repo.Merge("feature", "master", &MergeOptions{Strategy: MergeOurs})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result.Conflicts))
+	assert.Equal(t, "a on master", readString(t, repo, "master", "a.txt"))
+	assert.Equal(t, "c", readString(t, repo, "master", "c.txt"))
+}
+
+func TestMergeDirectoryClash(t *testing.T) {
+	repo := newMergeRepo(t)
+	commitToBranch(t, repo, "master", "x", "file")
+	commitToBranch(t, repo, "feature", "x/y.txt", "file in directory")
+
+	result, err := repo.Merge("feature", "master", nil)
+	assert.Equal(t, ErrMergeConflict, err)
+	assert.Equal(t, []MergeConflict{{Path: "x"}, {Path: "x/y.txt"}}, result.Conflicts)
+
+	_, err = repo.Merge("feature", "master", &MergeOptions{Strategy: MergeTheirs})
+	assert.Nil(t, err)
+	assert.Equal(t, "file in directory", readString(t, repo, "master", "x/y.txt"))
+	_, err = repo.ReadFile("master", "x")
+	assert.Equal(t, object.ErrFileNotFound, err)
+}
@@ -0,0 +1,406 @@
+package arangit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// MergeDriver merges two versions of a file that were both changed since
+// their merge base. base is nil if the file didn't exist in the merge base.
+// It returns the merged content and the JSON pointers, or other locations
+// meaningful to the driver, that conflict. Conflicts are resolved according
+// to strategy unless it's MergeFail. If the driver returns an error the
+// whole file is treated as a conflict.
+type MergeDriver func(base []byte, ours []byte, theirs []byte, strategy MergeStrategy) ([]byte, []string, error)
+
+// MergeDriverRule selects the driver for the files matching Pattern, see
+// FileIterOptions.Glob for the syntax.
+type MergeDriverRule struct {
+	Pattern string
+	Driver  MergeDriver
+}
+
+// mergeDriver is a MergeDriverRule with a compiled pattern.
+type mergeDriver struct {
+	glob   []string
+	driver MergeDriver
+}
+
+func compileMergeDrivers(rules []MergeDriverRule) ([]mergeDriver, error) {
+	drivers := make([]mergeDriver, 0, len(rules))
+	for _, rule := range rules {
+		glob, err := compileGlob(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		drivers = append(drivers, mergeDriver{glob: glob, driver: rule.Driver})
+	}
+	return drivers, nil
+}
+
+// mergeDriverFor returns the driver of the first rule matching p or nil.
+func (r *repository) mergeDriverFor(p string) MergeDriver {
+	for _, d := range r.mergeDrivers {
+		if matchGlob(d.glob, p) {
+			return d.driver
+		}
+	}
+	return nil
+}
+
+// mergeWithDriver merges a file changed on both sides with driver. It
+// returns the merged entry and the conflicting locations, ok is false if
+// the driver failed.
+func (r *repository) mergeWithDriver(driver MergeDriver, b object.TreeEntry, bok bool, o object.TreeEntry, t object.TreeEntry, strategy MergeStrategy) (object.TreeEntry, []string, bool, error) {
+	var base []byte
+	if bok {
+		var err error
+		base, err = r.blobContent(b.Hash)
+		if err != nil {
+			return object.TreeEntry{}, nil, false, err
+		}
+	}
+
+	ours, err := r.blobContent(o.Hash)
+	if err != nil {
+		return object.TreeEntry{}, nil, false, err
+	}
+	theirs, err := r.blobContent(t.Hash)
+	if err != nil {
+		return object.TreeEntry{}, nil, false, err
+	}
+
+	merged, conflicts, err := driver(base, ours, theirs, strategy)
+	if err != nil {
+		return object.TreeEntry{}, nil, false, nil
+	}
+
+	h, err := r.writeBlob(merged)
+	if err != nil {
+		return object.TreeEntry{}, nil, false, err
+	}
+	return object.TreeEntry{Name: o.Name, Mode: o.Mode, Hash: h}, conflicts, true, nil
+}
+
+func (r *repository) blobContent(h plumbing.Hash) ([]byte, error) {
+	blob, err := r.repo.BlobObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	rdr, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rdr.Close() }()
+	return ioutil.ReadAll(rdr)
+}
+
+// MergeJSON is a MergeDriver for JSON documents. Objects are merged key by
+// key, so changes to different members of the same object don't conflict.
+// Any other value, including arrays, conflicts if both sides changed it
+// differently. The result is indented like ours: minified documents stay
+// minified, all others are indented with two spaces. Members keep their
+// order in ours, members only theirs has follow in their order in theirs.
+func MergeJSON(base []byte, ours []byte, theirs []byte, strategy MergeStrategy) ([]byte, []string, error) {
+	var b interface{}
+	bok := base != nil
+	if bok {
+		var err error
+		b, err = parseJSON(base)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	o, err := parseJSON(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := parseJSON(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order := jsonKeyOrder{}
+	for _, doc := range [][]byte{ours, theirs} {
+		err = order.read(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	m := &jsonMerge{strategy: strategy}
+	merged, _ := m.merge("", b, bok, o, true, t, true)
+	content, err := encodeJSONLike(merged, ours, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, m.conflicts, nil
+}
+
+// encodeJSONLike encodes v indented like the document like: minified
+// documents stay minified, all others are indented with two spaces. The
+// result ends with a newline if like does. Object members are written in
+// the order recorded in order, members it doesn't know are sorted.
+func encodeJSONLike(v interface{}, like []byte, order jsonKeyOrder) ([]byte, error) {
+	var buf bytes.Buffer
+	err := order.encode(&buf, "", v)
+	if err != nil {
+		return nil, err
+	}
+
+	content := buf.Bytes()
+	if bytes.ContainsRune(bytes.TrimSpace(like), '\n') {
+		var indented bytes.Buffer
+		err = json.Indent(&indented, content, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		content = indented.Bytes()
+	}
+
+	if bytes.HasSuffix(like, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	return content, nil
+}
+
+// jsonKeyOrder records the order of the members of objects by the JSON
+// pointer of the object.
+type jsonKeyOrder map[string][]string
+
+// read records the member order of the objects in doc. Members already
+// recorded for an object keep their position.
+func (ko jsonKeyOrder) read(doc []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	return ko.readValue(dec, "")
+}
+
+func (ko jsonKeyOrder) readValue(dec *json.Decoder, pointer string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			tok, err = dec.Token()
+			if err != nil {
+				return err
+			}
+
+			key := tok.(string)
+			ko.add(pointer, key)
+			err = ko.readValue(dec, pointer+"/"+escapePointerToken(key))
+			if err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			err = ko.readValue(dec, pointer+"/"+strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	// the closing delimiter
+	_, err = dec.Token()
+	return err
+}
+
+func (ko jsonKeyOrder) add(pointer string, key string) {
+	for _, k := range ko[pointer] {
+		if k == key {
+			return
+		}
+	}
+	ko[pointer] = append(ko[pointer], key)
+}
+
+// keys returns the keys of obj, the object at pointer, in order.
+func (ko jsonKeyOrder) keys(pointer string, obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	known := map[string]bool{}
+	for _, k := range ko[pointer] {
+		if _, ok := obj[k]; ok {
+			keys = append(keys, k)
+			known[k] = true
+		}
+	}
+
+	var rest []string
+	for k := range obj {
+		if !known[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// encode writes v, the value at pointer, to buf as minified JSON.
+func (ko jsonKeyOrder) encode(buf *bytes.Buffer, pointer string, v interface{}) error {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		buf.WriteByte('{')
+		for i, k := range ko.keys(pointer, x) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := encodeJSONScalar(buf, k)
+			if err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			err = ko.encode(buf, pointer+"/"+escapePointerToken(k), x[k])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := ko.encode(buf, pointer+"/"+strconv.Itoa(i), e)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		return encodeJSONScalar(buf, v)
+	}
+	return nil
+}
+
+// encodeJSONScalar writes v to buf without escaping HTML characters.
+func encodeJSONScalar(buf *bytes.Buffer, v interface{}) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return nil
+}
+
+type jsonMerge struct {
+	strategy  MergeStrategy
+	conflicts []string
+}
+
+// merge merges the values at pointer, the ok flags tell whether the value
+// exists on that side. It returns the merged value and whether it exists.
+func (m *jsonMerge) merge(pointer string, b interface{}, bok bool, o interface{}, ook bool, t interface{}, tok bool) (interface{}, bool) {
+	switch {
+	case sameJSON(o, ook, t, tok):
+		return o, ook
+	case sameJSON(b, bok, o, ook):
+		return t, tok
+	case sameJSON(b, bok, t, tok):
+		return o, ook
+	}
+
+	oo, oobj := o.(map[string]interface{})
+	to, tobj := t.(map[string]interface{})
+	if oobj && tobj {
+		bo, bobj := b.(map[string]interface{})
+		if !bobj {
+			// members added on both sides are merged like an object that
+			// was empty before
+			bo = map[string]interface{}{}
+		}
+		return m.mergeObjects(pointer, bo, oo, to), true
+	}
+
+	m.conflicts = append(m.conflicts, pointer)
+	if m.strategy == MergeTheirs {
+		return t, tok
+	}
+	return o, ook
+}
+
+func (m *jsonMerge) mergeObjects(pointer string, b, o, t map[string]interface{}) map[string]interface{} {
+	keys := map[string]bool{}
+	for _, obj := range []map[string]interface{}{b, o, t} {
+		for k := range obj {
+			keys[k] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	merged := map[string]interface{}{}
+	for _, k := range sorted {
+		bv, bok := b[k]
+		ov, ook := o[k]
+		tv, tok := t[k]
+		v, ok := m.merge(pointer+"/"+escapePointerToken(k), bv, bok, ov, ook, tv, tok)
+		if ok {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func sameJSON(a interface{}, aok bool, b interface{}, bok bool) bool {
+	if !aok || !bok {
+		return aok == bok
+	}
+	return jsonEqual(a, b)
+}
+
+// jsonEqual compares two decoded JSON values, numbers are compared by
+// value.
+func jsonEqual(a interface{}, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := b[k]
+			if !ok || !jsonEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return scalarsEqual(a, b)
+	}
+}
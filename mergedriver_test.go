@@ -0,0 +1,186 @@
+package arangit
+
+import (
+	"path"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		strategy  MergeStrategy
+		merged    string
+		conflicts []string
+	}{
+		{
+			name:   "different members",
+			base:   `{"balance":10,"owner":"alice","limits":{"daily":1,"monthly":10}}`,
+			ours:   `{"balance":20,"owner":"alice","limits":{"daily":1,"monthly":10}}`,
+			theirs: `{"balance":10,"owner":"bob","limits":{"daily":2,"monthly":10},"tags":["x"]}`,
+			merged: `{"balance":20,"owner":"bob","limits":{"daily":2,"monthly":10},"tags":["x"]}`,
+		},
+		{
+			name:   "same change on both sides",
+			base:   `{"a":1,"b":1}`,
+			ours:   `{"a":2,"b":1}`,
+			theirs: `{"a":2.0,"b":1,"c":3}`,
+			merged: `{"a":2,"b":1,"c":3}`,
+		},
+		{
+			name:      "same member",
+			base:      `{"balance":10,"owner":"alice"}`,
+			ours:      `{"balance":20,"owner":"alice"}`,
+			theirs:    `{"balance":30,"owner":"bob"}`,
+			merged:    `{"balance":20,"owner":"bob"}`,
+			conflicts: []string{"/balance"},
+		},
+		{
+			name:      "same member with theirs",
+			base:      `{"balance":10,"owner":"alice"}`,
+			ours:      `{"balance":20,"owner":"alice"}`,
+			theirs:    `{"balance":30,"owner":"bob"}`,
+			strategy:  MergeTheirs,
+			merged:    `{"balance":30,"owner":"bob"}`,
+			conflicts: []string{"/balance"},
+		},
+		{
+			name:      "deleted and modified",
+			base:      `{"a":{"b":1},"c/d":1}`,
+			ours:      `{"c/d":1}`,
+			theirs:    `{"a":{"b":2},"c/d":2}`,
+			merged:    `{"c/d":2}`,
+			conflicts: []string{"/a"},
+		},
+		{
+			name:      "arrays are values",
+			base:      `{"tags":["a"]}`,
+			ours:      `{"tags":["a","b"]}`,
+			theirs:    `{"tags":["a","c"]}`,
+			merged:    `{"tags":["a","b"]}`,
+			conflicts: []string{"/tags"},
+		},
+		{
+			name:   "invalid theirs",
+			ours:   `{"a":1,"n":{"x":1}}`,
+			theirs: `{"b":2,"n":{"y":<2>}}`,
+		},
+		{
+			name:   "added on both sides",
+			ours:   `{"a":1,"n":{"x":1}}`,
+			theirs: `{"b":"<2>","n":{"y":2}}`,
+			merged: `{"a":1,"n":{"x":1,"y":2},"b":"<2>"}`,
+		},
+		{
+			name:   "member order of ours",
+			base:   `{"z":1,"a":1,"n":{"q":1,"b":1}}`,
+			ours:   `{"z":1,"a":1,"n":{"q":1,"b":2}}`,
+			theirs: `{"n":{"c":3,"b":1,"q":1},"m":3,"a":2,"z":1}`,
+			merged: `{"z":1,"a":2,"n":{"q":1,"b":2,"c":3},"m":3}`,
+		},
+		{
+			name:   "indentation of ours",
+			base:   `{"a":1,"b":1}`,
+			ours:   "{\n    \"a\": 2,\n    \"b\": 1\n}\n",
+			theirs: `{"a":1,"b":2}`,
+			merged: "{\n  \"a\": 2,\n  \"b\": 2\n}\n",
+		},
+	} {
+		var base []byte
+		if tc.base != "" {
+			base = []byte(tc.base)
+		}
+
+		merged, conflicts, err := MergeJSON(base, []byte(tc.ours), []byte(tc.theirs), tc.strategy)
+		if tc.merged == "" {
+			assert.NotNil(t, err, tc.name)
+			continue
+		}
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, tc.merged, string(merged), tc.name)
+		assert.Equal(t, tc.conflicts, conflicts, tc.name)
+	}
+}
+
+func newJSONMergeRepo(t *testing.T) Repository {
+	repo, err := OpenRepoFromDatabaseWithOptions(arangotest.NewDatabase("arangit"), &RepoOptions{
+		MergeDrivers: []MergeDriverRule{
+			{Pattern: "data/**/*.json", Driver: MergeJSON},
+		},
+	})
+	assert.Nil(t, err)
+
+	commitToBranch(t, repo, "master", "data/accounts/a.json", `{"balance":10,"owner":"alice","limits":{"daily":1}}`)
+	commitToBranch(t, repo, "master", "data/b.json", `{"a":1}`)
+	commitToBranch(t, repo, "master", "other.json", `{"a":1,"b":1}`)
+	assert.Nil(t, repo.CreateBranch("feature", ""))
+	return repo
+}
+
+func TestMergeWithJSONDriver(t *testing.T) {
+	repo := newJSONMergeRepo(t)
+	commitToBranch(t, repo, "master", "data/accounts/a.json", `{"balance":20,"owner":"alice","limits":{"daily":1}}`)
+	commitToBranch(t, repo, "feature", "data/accounts/a.json", `{"balance":10,"owner":"bob","limits":{"daily":5}}`)
+
+	result, err := repo.Merge("feature", "master", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(result.Conflicts))
+	assert.Equal(t, `{"balance":20,"owner":"bob","limits":{"daily":5}}`, readString(t, repo, "master", "data/accounts/a.json"))
+
+	// conflicting members fail the merge and are reported by pointer
+	commitToBranch(t, repo, "master", "data/accounts/a.json", `{"balance":30,"limits":{"daily":5},"owner":"bob"}`)
+	commitToBranch(t, repo, "feature", "data/accounts/a.json", `{"balance":40,"limits":{"daily":6},"owner":"bob"}`)
+	master := headCommit(t, repo.(*repository), "master").Hash
+
+	result, err = repo.Merge("feature", "master", nil)
+	assert.Equal(t, ErrMergeConflict, err)
+	assert.Equal(t, 1, len(result.Conflicts))
+	assert.Equal(t, "data/accounts/a.json", result.Conflicts[0].Path)
+	assert.Equal(t, []string{"/balance"}, result.Conflicts[0].Pointers)
+	assert.Equal(t, master, headCommit(t, repo.(*repository), "master").Hash)
+
+	// the strategy resolves the conflicting members only
+	result, err = repo.Merge("feature", "master", &MergeOptions{Strategy: MergeOurs})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/balance"}, result.Conflicts[0].Pointers)
+	assert.Equal(t, `{"balance":30,"limits":{"daily":6},"owner":"bob"}`, readString(t, repo, "master", "data/accounts/a.json"))
+}
+
+func TestMergeDriverRules(t *testing.T) {
+	repo := newJSONMergeRepo(t)
+
+	// the file doesn't match the pattern of the JSON driver
+	commitToBranch(t, repo, "master", "other.json", `{"a":2,"b":1}`)
+	commitToBranch(t, repo, "feature", "other.json", `{"a":1,"b":2}`)
+	// the driver can't parse the file, so the whole file conflicts
+	commitToBranch(t, repo, "master", "data/b.json", `{"a":2}`)
+	commitToBranch(t, repo, "feature", "data/b.json", `{"a":`)
+
+	result, err := repo.Merge("feature", "master", nil)
+	assert.Equal(t, ErrMergeConflict, err)
+	assert.Equal(t, []MergeConflict{
+		{
+			Path:   "data/b.json",
+			Base:   plumbing.ComputeHash(plumbing.BlobObject, []byte(`{"a":1}`)),
+			Ours:   plumbing.ComputeHash(plumbing.BlobObject, []byte(`{"a":2}`)),
+			Theirs: plumbing.ComputeHash(plumbing.BlobObject, []byte(`{"a":`)),
+		},
+		{
+			Path:   "other.json",
+			Base:   plumbing.ComputeHash(plumbing.BlobObject, []byte(`{"a":1,"b":1}`)),
+			Ours:   plumbing.ComputeHash(plumbing.BlobObject, []byte(`{"a":2,"b":1}`)),
+			Theirs: plumbing.ComputeHash(plumbing.BlobObject, []byte(`{"a":1,"b":2}`)),
+		},
+	}, result.Conflicts)
+
+	_, err = OpenRepoFromDatabaseWithOptions(arangotest.NewDatabase("arangit"), &RepoOptions{
+		MergeDrivers: []MergeDriverRule{{Pattern: "[", Driver: MergeJSON}},
+	})
+	assert.Equal(t, path.ErrBadPattern, err)
+}
@@ -0,0 +1,511 @@
+package arangit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrInvalidPatch is returned if a patch isn't a valid JSON Patch or
+	// JSON Merge Patch document.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchFailed is returned if an operation of a JSON Patch doesn't
+	// apply to the document, e.g. because its path doesn't exist or a test
+	// operation failed.
+	ErrPatchFailed = errors.New("patch doesn't apply")
+	// ErrInvalidDocument is returned if the file to patch isn't a JSON
+	// document.
+	ErrInvalidDocument = errors.New("file isn't a JSON document")
+	// ErrParentMismatch is returned if the branch doesn't point to the
+	// expected parent commit.
+	ErrParentMismatch = errors.New("parent mismatch")
+)
+
+// PatchError tells which operation of a JSON Patch is invalid or failed.
+// Err is ErrInvalidPatch or ErrPatchFailed.
+type PatchError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("operation %d (%s %q): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+// Unwrap returns Err.
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// PatchOptions configures ApplyJSONPatch and ApplyMergePatch.
+type PatchOptions struct {
+	// Parent makes the patch fail with ErrParentMismatch unless the branch
+	// points to it, so a patch computed from the file at Parent isn't
+	// applied on top of changes made since. plumbing.ZeroHash patches
+	// whatever the tip is.
+	Parent plumbing.Hash
+	// Validate is called with the patched document, nothing is committed
+	// if it returns an error
+	Validate func(doc []byte) error
+	// CommitOptions configure the commit, the message defaults to
+	// "Patch <path>"
+	CommitOptions
+}
+
+// ApplyJSONPatch applies a JSON Patch, see RFC 6902, to the JSON document
+// at path on branch and commits the result. An empty branch is the branch
+// HEAD points to. The operations are applied in order and nothing is
+// committed unless all of them apply. A file that doesn't exist can only be
+// created by adding the whole document. The patched document is indented
+// like the original one and its object members are sorted by key. It
+// returns ErrNothingToCommit if the patch doesn't change the document.
+func (r *repository) ApplyJSONPatch(branch string, path string, patch []byte, opts *PatchOptions) (plumbing.Hash, error) {
+	ops, err := parseJSONPatch(patch)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return r.patchFile(branch, path, opts, func(doc interface{}, exists bool) (interface{}, error) {
+		for i, op := range ops {
+			doc, err = op.apply(doc, exists)
+			if err != nil {
+				return nil, &PatchError{Index: i, Op: op.op, Path: op.path, Err: err}
+			}
+			exists = true
+		}
+		return doc, nil
+	})
+}
+
+// ApplyMergePatch applies a JSON Merge Patch, see RFC 7396, to the JSON
+// document at path on branch and commits the result like ApplyJSONPatch.
+// A file that doesn't exist is patched like a null document.
+func (r *repository) ApplyMergePatch(branch string, path string, patch []byte, opts *PatchOptions) (plumbing.Hash, error) {
+	mp, err := parseJSON(patch)
+	if err != nil {
+		return plumbing.ZeroHash, ErrInvalidPatch
+	}
+
+	return r.patchFile(branch, path, opts, func(doc interface{}, exists bool) (interface{}, error) {
+		return mergePatch(doc, mp), nil
+	})
+}
+
+// patchFile commits the document apply returns for the document at p. The
+// document is read and patched under the lock of the branch, so the patch
+// always applies to the tip it's committed on. Like CommitChangeset it
+// doesn't create branches other than the one HEAD points to.
+func (r *repository) patchFile(branch string, p string, opts *PatchOptions, apply func(doc interface{}, exists bool) (interface{}, error)) (plumbing.Hash, error) {
+	if opts == nil {
+		opts = &PatchOptions{}
+	}
+
+	name, err := r.branchOrHead(branch)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	p = cleanPath(p)
+	if p == "" {
+		return plumbing.ZeroHash, ErrInvalidPath
+	}
+
+	changes := []fileChange{{Path: p}}
+	return r.commitChanges(name, changes, r.commitInfo(&opts.CommitOptions, "Patch "+p), func(tree *object.Tree) error {
+		err := r.branchExists(name)(tree)
+		if err != nil {
+			return err
+		}
+
+		if !opts.Parent.IsZero() {
+			// commitChanges holds the lock of the branch, so it still points
+			// to the commit tree belongs to
+			ref, err := r.repo.Reference(name, false)
+			if err == plumbing.ErrReferenceNotFound {
+				return ErrParentMismatch
+			} else if err != nil {
+				return err
+			} else if ref.Hash() != opts.Parent {
+				return ErrParentMismatch
+			}
+		}
+
+		var doc interface{}
+		content, err := fileContent(tree, p)
+		exists := err == nil
+		if exists {
+			doc, err = parseJSON(content)
+			if err != nil {
+				return ErrInvalidDocument
+			}
+		} else if err != object.ErrFileNotFound {
+			return err
+		}
+
+		// apply may change doc in place
+		orig := copyJSON(doc)
+		doc, err = apply(doc, exists)
+		if err != nil {
+			return err
+		} else if exists && jsonEqual(orig, doc) {
+			// don't commit a document that only differs in formatting
+			return ErrNothingToCommit
+		}
+
+		patched, err := encodeJSONLike(doc, content, nil)
+		if err != nil {
+			return err
+		}
+		if opts.Validate != nil {
+			err = opts.Validate(patched)
+			if err != nil {
+				return err
+			}
+		}
+
+		changes[0].Content = patched
+		return nil
+	})
+}
+
+// jsonPatchOperation is a parsed operation of a JSON Patch, the pointers
+// are split into their unescaped reference tokens.
+type jsonPatchOperation struct {
+	op    string
+	path  string
+	to    []string
+	from  []string
+	value interface{}
+}
+
+func parseJSONPatch(patch []byte) ([]jsonPatchOperation, error) {
+	var raw []struct {
+		Op    string          `json:"op"`
+		Path  *string         `json:"path"`
+		From  *string         `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}
+	err := json.Unmarshal(patch, &raw)
+	if err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	ops := make([]jsonPatchOperation, 0, len(raw))
+	for i, r := range raw {
+		invalid := &PatchError{Index: i, Op: r.Op, Err: ErrInvalidPatch}
+		if r.Path == nil {
+			return nil, invalid
+		}
+		op := jsonPatchOperation{op: r.Op, path: *r.Path}
+		invalid.Path = op.path
+
+		op.to, err = parsePointer(op.path)
+		if err != nil {
+			return nil, invalid
+		}
+
+		switch r.Op {
+		case "add", "replace", "test":
+			if r.Value == nil {
+				return nil, invalid
+			}
+			op.value, err = parseJSON(r.Value)
+			if err != nil {
+				return nil, invalid
+			}
+		case "move", "copy":
+			if r.From == nil {
+				return nil, invalid
+			}
+			op.from, err = parsePointer(*r.From)
+			if err != nil {
+				return nil, invalid
+			}
+		case "remove":
+		default:
+			return nil, invalid
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// parsePointer splits a JSON pointer, see RFC 6901, into its unescaped
+// reference tokens. The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	} else if pointer[0] != '/' {
+		return nil, ErrInvalidPatch
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, ErrInvalidPatch
+			}
+		}
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// apply applies the operation to doc and returns the patched document.
+// exists is false if there is no document yet.
+func (op *jsonPatchOperation) apply(doc interface{}, exists bool) (interface{}, error) {
+	if !exists && !(op.op == "add" && len(op.to) == 0) {
+		return nil, ErrPatchFailed
+	}
+
+	switch op.op {
+	case "add":
+		return jsonAdd(doc, op.to, op.value)
+	case "remove":
+		_, doc, err := jsonRemove(doc, op.to)
+		return doc, err
+	case "replace":
+		if len(op.to) == 0 {
+			return op.value, nil
+		}
+		return jsonUpdate(doc, op.to, func(parent interface{}, token string) (interface{}, error) {
+			switch parent := parent.(type) {
+			case map[string]interface{}:
+				if _, ok := parent[token]; !ok {
+					return nil, ErrPatchFailed
+				}
+				parent[token] = op.value
+				return parent, nil
+			case []interface{}:
+				i, ok := arrayIndex(token, len(parent)-1)
+				if !ok {
+					return nil, ErrPatchFailed
+				}
+				parent[i] = op.value
+				return parent, nil
+			default:
+				return nil, ErrPatchFailed
+			}
+		})
+	case "move":
+		if isPointerPrefix(op.from, op.to) {
+			if len(op.from) == len(op.to) {
+				_, ok := jsonGet(doc, op.from)
+				if !ok {
+					return nil, ErrPatchFailed
+				}
+				return doc, nil
+			}
+			// a value can't be moved into itself
+			return nil, ErrPatchFailed
+		}
+		v, doc, err := jsonRemove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonAdd(doc, op.to, v)
+	case "copy":
+		v, ok := jsonGet(doc, op.from)
+		if !ok {
+			return nil, ErrPatchFailed
+		}
+		return jsonAdd(doc, op.to, copyJSON(v))
+	default:
+		v, ok := jsonGet(doc, op.to)
+		if !ok || !jsonEqual(v, op.value) {
+			return nil, ErrPatchFailed
+		}
+		return doc, nil
+	}
+}
+
+func jsonAdd(doc interface{}, tokens []string, v interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return v, nil
+	}
+
+	return jsonUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			parent[token] = v
+			return parent, nil
+		case []interface{}:
+			if token == "-" {
+				return append(parent, v), nil
+			}
+			i, ok := arrayIndex(token, len(parent))
+			if !ok {
+				return nil, ErrPatchFailed
+			}
+			parent = append(parent, nil)
+			copy(parent[i+1:], parent[i:])
+			parent[i] = v
+			return parent, nil
+		default:
+			return nil, ErrPatchFailed
+		}
+	})
+}
+
+// jsonRemove removes the value at tokens and returns it along with the
+// patched document.
+func jsonRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		// the document itself can't be removed
+		return nil, nil, ErrPatchFailed
+	}
+
+	var removed interface{}
+	doc, err := jsonUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			v, ok := parent[token]
+			if !ok {
+				return nil, ErrPatchFailed
+			}
+			removed = v
+			delete(parent, token)
+			return parent, nil
+		case []interface{}:
+			i, ok := arrayIndex(token, len(parent)-1)
+			if !ok {
+				return nil, ErrPatchFailed
+			}
+			removed = parent[i]
+			return append(parent[:i], parent[i+1:]...), nil
+		default:
+			return nil, ErrPatchFailed
+		}
+	})
+	return removed, doc, err
+}
+
+// jsonUpdate replaces the container holding the value at tokens by the
+// one f returns. f is called with the container and the last token.
+func jsonUpdate(doc interface{}, tokens []string, f func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return f(doc, tokens[0])
+	}
+
+	child, ok := jsonGet(doc, tokens[:1])
+	if !ok {
+		return nil, ErrPatchFailed
+	}
+	child, err := jsonUpdate(child, tokens[1:], f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		doc[tokens[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(tokens[0], len(doc)-1)
+		doc[i] = child
+	}
+	return doc, nil
+}
+
+// jsonGet returns the value at tokens and whether it exists.
+func jsonGet(doc interface{}, tokens []string) (interface{}, bool) {
+	for _, token := range tokens {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[token]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []interface{}:
+			i, ok := arrayIndex(token, len(d)-1)
+			if !ok {
+				return nil, false
+			}
+			doc = d[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// arrayIndex parses an array index that is at most max. Indexes have no
+// leading zeros.
+func arrayIndex(token string, max int) (int, bool) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, false
+	}
+	return i, true
+}
+
+func isPointerPrefix(prefix []string, tokens []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = copyJSON(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = copyJSON(e)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// mergePatch applies the merge patch patch to target as described in RFC
+// 7396: objects are merged recursively, null members remove the member
+// and any other value replaces the target.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
@@ -0,0 +1,195 @@
+package arangit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+)
+
+const account = `{"balance":10,"owner":"alice","tags":["a","b"],"limits":{"daily":1}}`
+
+func TestApplyJSONPatch(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		patch   string
+		patched string
+		err     error
+	}{
+		{
+			name:    "replace",
+			patch:   `[{"op":"test","path":"/balance","value":10.0},{"op":"replace","path":"/balance","value":20}]`,
+			patched: `{"balance":20,"limits":{"daily":1},"owner":"alice","tags":["a","b"]}`,
+		},
+		{
+			name:    "add and remove",
+			patch:   `[{"op":"add","path":"/tags/1","value":"x"},{"op":"add","path":"/tags/-","value":"y"},{"op":"remove","path":"/tags/0"},{"op":"add","path":"/limits/a~1b","value":null},{"op":"remove","path":"/owner"}]`,
+			patched: `{"balance":10,"limits":{"a/b":null,"daily":1},"tags":["x","b","y"]}`,
+		},
+		{
+			name:    "move and copy",
+			patch:   `[{"op":"copy","from":"/limits","path":"/monthly"},{"op":"replace","path":"/monthly/daily","value":30},{"op":"move","from":"/owner","path":"/tags/0"}]`,
+			patched: `{"balance":10,"limits":{"daily":1},"monthly":{"daily":30},"tags":["alice","a","b"]}`,
+		},
+		{
+			name:    "replace the document",
+			patch:   `[{"op":"replace","path":"","value":[1]}]`,
+			patched: `[1]`,
+		},
+		{
+			name:  "failed test",
+			patch: `[{"op":"replace","path":"/balance","value":20},{"op":"test","path":"/balance","value":10}]`,
+			err:   &PatchError{Index: 1, Op: "test", Path: "/balance", Err: ErrPatchFailed},
+		},
+		{
+			name:  "missing member",
+			patch: `[{"op":"remove","path":"/limits/weekly"}]`,
+			err:   &PatchError{Index: 0, Op: "remove", Path: "/limits/weekly", Err: ErrPatchFailed},
+		},
+		{
+			name:  "index out of range",
+			patch: `[{"op":"add","path":"/tags/3","value":"c"}]`,
+			err:   &PatchError{Index: 0, Op: "add", Path: "/tags/3", Err: ErrPatchFailed},
+		},
+		{
+			name:  "move into itself",
+			patch: `[{"op":"move","from":"/limits","path":"/limits/inner"}]`,
+			err:   &PatchError{Index: 0, Op: "move", Path: "/limits/inner", Err: ErrPatchFailed},
+		},
+		{
+			name:  "unknown operation",
+			patch: `[{"op":"test","path":"/balance","value":10},{"op":"increment","path":"/balance"}]`,
+			err:   &PatchError{Index: 1, Op: "increment", Path: "/balance", Err: ErrInvalidPatch},
+		},
+		{
+			name:  "missing value",
+			patch: `[{"op":"add","path":"/a"}]`,
+			err:   &PatchError{Index: 0, Op: "add", Path: "/a", Err: ErrInvalidPatch},
+		},
+		{
+			name:  "invalid pointer",
+			patch: `[{"op":"remove","path":"/a~2"}]`,
+			err:   &PatchError{Index: 0, Op: "remove", Path: "/a~2", Err: ErrInvalidPatch},
+		},
+		{
+			name:  "not a patch",
+			patch: `{"op":"remove","path":"/a"}`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "nothing changes",
+			patch: `[{"op":"test","path":"/owner","value":"alice"}]`,
+			err:   ErrNothingToCommit,
+		},
+	} {
+		r := openTestRepo(t)
+		commitToBranch(t, r, "master", "accounts/a.json", account)
+		tip := headCommit(t, r, "master").Hash
+
+		h, err := r.ApplyJSONPatch("", "accounts/a.json", []byte(tc.patch), nil)
+		if tc.err != nil {
+			assert.Equal(t, tc.err, err, tc.name)
+			assert.Equal(t, tip, headCommit(t, r, "master").Hash, tc.name)
+			continue
+		}
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, h, headCommit(t, r, "master").Hash, tc.name)
+		assert.Equal(t, tc.patched, readString(t, r, "master", "accounts/a.json"), tc.name)
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	r := openTestRepo(t)
+	commitToBranch(t, r, "master", "accounts/a.json", "{\n  \"balance\": 10,\n  \"owner\": \"alice\",\n  \"limits\": {\"daily\": 1, \"monthly\": 10}\n}\n")
+
+	h, err := r.ApplyMergePatch("master", "accounts/a.json", []byte(`{"balance":20,"owner":null,"limits":{"daily":null,"weekly":5}}`), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\n  \"balance\": 20,\n  \"limits\": {\n    \"monthly\": 10,\n    \"weekly\": 5\n  }\n}\n", readString(t, r, "master", "accounts/a.json"))
+
+	c := headCommit(t, r, "master")
+	assert.Equal(t, h, c.Hash)
+	assert.Equal(t, "Patch accounts/a.json", c.Message)
+
+	// files that don't exist are patched like null
+	_, err = r.ApplyMergePatch("master", "accounts/b.json", []byte(`{"balance":5,"owner":null}`), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"balance":5}`, readString(t, r, "master", "accounts/b.json"))
+
+	_, err = r.ApplyMergePatch("master", "accounts/b.json", []byte(`{"balance":`), nil)
+	assert.Equal(t, ErrInvalidPatch, err)
+	_, err = r.ApplyMergePatch("master", "accounts/b.json", []byte(`{"balance":2} trailing garbage`), nil)
+	assert.Equal(t, ErrInvalidPatch, err)
+	_, err = r.ApplyMergePatch("master", "accounts/b.json", []byte(`{"balance":2}]`), nil)
+	assert.Equal(t, ErrInvalidPatch, err)
+	_, err = r.ApplyMergePatch("master", "accounts/b.json", []byte("{\"balance\":2}\n"), nil)
+	assert.Nil(t, err)
+
+	// documents with trailing data aren't patched either
+	commitToBranch(t, r, "master", "accounts/c.json", `{"balance":1} {"balance":2}`)
+	_, err = r.ApplyMergePatch("master", "accounts/c.json", []byte(`{"balance":3}`), nil)
+	assert.Equal(t, ErrInvalidDocument, err)
+}
+
+func TestApplyPatchChecks(t *testing.T) {
+	r := openTestRepo(t)
+	commitToBranch(t, r, "master", "a.json", account)
+	commitToBranch(t, r, "master", "notes.txt", "balance: 10\n")
+	parent := headCommit(t, r, "master").Hash
+	patch := []byte(`[{"op":"replace","path":"/balance","value":20}]`)
+
+	// the patch is based on a commit the branch has moved past
+	commitToBranch(t, r, "master", "b.json", `{}`)
+	_, err := r.ApplyJSONPatch("master", "a.json", patch, &PatchOptions{Parent: parent})
+	assert.Equal(t, ErrParentMismatch, err)
+
+	// patches don't create branches
+	_, err = r.ApplyMergePatch("other", "a.json", []byte(`{}`), &PatchOptions{Parent: parent})
+	assert.Equal(t, ErrBranchNotFound, err)
+	_, err = r.ApplyJSONPatch("typo", "a.json", []byte(`[{"op":"add","path":"","value":{}}]`), nil)
+	assert.Equal(t, ErrBranchNotFound, err)
+	branches, err := r.ListBranches()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"master"}, branches)
+
+	parent = headCommit(t, r, "master").Hash
+	h, err := r.ApplyJSONPatch("master", "a.json", patch, &PatchOptions{
+		Parent:        parent,
+		CommitOptions: CommitOptions{Message: "Set balance"},
+	})
+	assert.Nil(t, err)
+	c := headCommit(t, r, "master")
+	assert.Equal(t, h, c.Hash)
+	assert.Equal(t, []plumbing.Hash{parent}, c.ParentHashes)
+	assert.Equal(t, "Set balance", c.Message)
+
+	// the validator sees the patched document and can reject it
+	errNegative := errors.New("negative balance")
+	var validated string
+	_, err = r.ApplyJSONPatch("master", "a.json", []byte(`[{"op":"replace","path":"/balance","value":-5}]`), &PatchOptions{
+		Validate: func(doc []byte) error {
+			validated = string(doc)
+			return errNegative
+		},
+	})
+	assert.Equal(t, errNegative, err)
+	assert.Equal(t, `{"balance":-5,"limits":{"daily":1},"owner":"alice","tags":["a","b"]}`, validated)
+	assert.Equal(t, h, headCommit(t, r, "master").Hash)
+
+	_, err = r.ApplyJSONPatch("master", "notes.txt", patch, nil)
+	assert.Equal(t, ErrInvalidDocument, err)
+
+	// only adding the whole document creates a file
+	_, err = r.ApplyJSONPatch("master", "c.json", patch, nil)
+	assert.Equal(t, &PatchError{Index: 0, Op: "replace", Path: "/balance", Err: ErrPatchFailed}, err)
+	_, err = r.ApplyJSONPatch("master", "c.json", []byte(`[{"op":"add","path":"","value":{}},{"op":"add","path":"/balance","value":1}]`), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"balance":1}`, readString(t, r, "master", "c.json"))
+
+	_, err = r.ApplyJSONPatch("master", "/", patch, nil)
+	assert.Equal(t, ErrInvalidPath, err)
+	_, err = r.ApplyJSONPatch("bad..name", "a.json", patch, nil)
+	assert.Equal(t, ErrInvalidBranchName, err)
+
+	assert.True(t, errors.Is(&PatchError{Err: ErrPatchFailed}, ErrPatchFailed))
+}
@@ -0,0 +1,425 @@
+package arangit
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ReadFile returns the content of the file at p in the revision rev, which
+// can be anything git rev-parse understands such as HEAD~2, a branch, a tag
+// or a commit hash. The file is read from the commit and tree objects, so
+// neither the worktree nor the index are touched. It returns
+// object.ErrFileNotFound if there is no file at p.
+func (r *repository) ReadFile(rev string, p string) ([]byte, error) {
+	c, err := r.revisionCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	return r.readFile(c, p)
+}
+
+// FileIter returns an iterator over all files of the revision rev,
+// including the files in subdirectories. Like ReadFile it doesn't touch the
+// worktree.
+func (r *repository) FileIter(rev string) (FileIterator, error) {
+	return r.FileIterWithOptions(rev, nil)
+}
+
+func (r *repository) ReadFileFromHead(p string) ([]byte, error) {
+	return r.ReadFile(plumbing.HEAD.String(), p)
+}
+
+func (r *repository) ReadFileFromTag(tagName string, p string) ([]byte, error) {
+	c, err := r.tagCommit(tagName)
+	if err != nil {
+		return nil, err
+	}
+	return r.readFile(c, p)
+}
+
+func (r *repository) FileIterForHead() (FileIterator, error) {
+	return r.FileIter(plumbing.HEAD.String())
+}
+
+func (r *repository) FileIterForTag(name string) (FileIterator, error) {
+	c, err := r.tagCommit(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.newTreeFileIter(c, nil)
+}
+
+func (r *repository) readFile(c *object.Commit, p string) ([]byte, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return fileContent(tree, cleanPath(p))
+}
+
+func (r *repository) revisionCommit(rev string) (*object.Commit, error) {
+	h, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.CommitObject(*h)
+}
+
+// tagCommit returns the commit the tag called name points to, peeling
+// annotated tags. It returns ErrTagDoesntExist if there is no such tag.
+func (r *repository) tagCommit(name string) (*object.Commit, error) {
+	ref, err := r.repo.Reference(plumbing.NewTagReferenceName(name), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, ErrTagDoesntExist
+	} else if err != nil {
+		return nil, err
+	}
+	return r.revisionCommit(ref.Name().String())
+}
+
+// FileIterOptions -
+type FileIterOptions struct {
+	// Prefix limits the iteration to the file or directory at Prefix
+	Prefix string
+	// Glob limits the iteration to files whose path matches Glob, see
+	// path.Match. A "**" element matches any number of directories and a
+	// pattern without a slash only has to match the name of the file.
+	Glob string
+}
+
+// FileIterWithOptions is like FileIter but only iterates over the files
+// matching opts. It returns path.ErrBadPattern if opts.Glob is malformed
+// and an empty iterator if there is nothing at opts.Prefix.
+func (r *repository) FileIterWithOptions(rev string, opts *FileIterOptions) (FileIterator, error) {
+	c, err := r.revisionCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	return r.newTreeFileIter(c, opts)
+}
+
+// FileEntry describes a file of a tree. The content is only read from the
+// repository when Open is called.
+type FileEntry struct {
+	// Path is the path of the file relative to the root of the tree
+	Path string
+	// Mode is the git mode of the file such as filemode.Executable or
+	// filemode.Symlink
+	Mode filemode.FileMode
+	// Hash is the hash of the blob holding the content of the file
+	Hash plumbing.Hash
+	// Size is the size of the content in bytes
+	Size int64
+	// ModTime is the time of the commit the tree belongs to
+	ModTime time.Time
+
+	iter *treeFileIter
+}
+
+// Name returns the last element of the path of the file.
+func (e *FileEntry) Name() string {
+	return path.Base(e.Path)
+}
+
+// Open returns a reader for the content of the file, which the caller has
+// to close. Readers that are still open when the iterator is closed are
+// closed with it. It returns ErrIteratorClosed after the iterator was
+// closed.
+func (e *FileEntry) Open() (io.ReadCloser, error) {
+	return e.iter.open(e)
+}
+
+// treeFileIter iterates over the files of a tree in tree order. It keeps
+// track of the readers opened by its entries, so that none of them leaks.
+type treeFileIter struct {
+	storer  storer.EncodedObjectStorer
+	entries []*FileEntry
+	idx     int
+
+	// mu guards readers and closed, readers may be closed from any
+	// goroutine
+	mu      sync.Mutex
+	readers map[*entryReader]struct{}
+	closed  bool
+}
+
+func (r *repository) newTreeFileIter(c *object.Commit, opts *FileIterOptions) (*treeFileIter, error) {
+	if opts == nil {
+		opts = &FileIterOptions{}
+	}
+
+	glob, err := compileGlob(opts.Glob)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	i := &treeFileIter{
+		storer:  r.repo.Storer,
+		readers: map[*entryReader]struct{}{},
+	}
+	add := func(p string, e *object.TreeEntry) error {
+		if !e.Mode.IsFile() || !matchGlob(glob, p) {
+			return nil
+		}
+
+		i.entries = append(i.entries, &FileEntry{
+			Path:    p,
+			Mode:    e.Mode,
+			Hash:    e.Hash,
+			ModTime: c.Committer.When,
+			iter:    i,
+		})
+		return nil
+	}
+
+	prefix := cleanPath(opts.Prefix)
+	if prefix != "" {
+		e, err := treeEntry(tree, prefix)
+		if err != nil || e == nil {
+			return i, err
+		} else if e.Mode != filemode.Dir {
+			return i, add(prefix, e)
+		}
+
+		tree, err = object.GetTree(i.storer, e.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, e, err := walker.Next()
+		if err == io.EOF {
+			return i, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		err = add(path.Join(prefix, name), &e)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (i *treeFileIter) Next() (*FileEntry, error) {
+	i.mu.Lock()
+	closed := i.closed
+	i.mu.Unlock()
+	if closed {
+		return nil, ErrIteratorClosed
+	} else if i.idx >= len(i.entries) {
+		return nil, ErrIteratorExhausted
+	}
+
+	// only the size is read, the content is loaded when the entry is
+	// opened. It's read here so that callers stopping early don't pay for
+	// the remaining entries.
+	e := i.entries[i.idx]
+	size, err := i.storer.EncodedObjectSize(e.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Size = size
+	i.idx++
+	return e, nil
+}
+
+// ForEach calls f for every remaining entry and closes the iterator
+// afterwards. Readers opened by f are closed as soon as f returns.
+func (i *treeFileIter) ForEach(f FileIteratorFunc) error {
+	defer i.Close()
+	for {
+		e, err := i.Next()
+		if err == ErrIteratorExhausted {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = f(e)
+		i.closeReaders()
+		if err == ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes all readers that are still open. Entries can't be opened
+// after the iterator was closed.
+func (i *treeFileIter) Close() {
+	i.mu.Lock()
+	i.closed = true
+	i.mu.Unlock()
+	i.closeReaders()
+}
+
+func (i *treeFileIter) open(e *FileEntry) (io.ReadCloser, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed {
+		return nil, ErrIteratorClosed
+	}
+
+	blob, err := object.GetBlob(i.storer, e.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	rdr, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	er := &entryReader{ReadCloser: rdr, iter: i}
+	i.readers[er] = struct{}{}
+	return er, nil
+}
+
+func (i *treeFileIter) closeReaders() {
+	i.mu.Lock()
+	readers := i.readers
+	i.readers = map[*entryReader]struct{}{}
+	i.mu.Unlock()
+
+	for er := range readers {
+		_ = er.close()
+	}
+}
+
+// entryReader is a reader opened by a FileEntry. Once closed it returns
+// os.ErrClosed.
+type entryReader struct {
+	io.ReadCloser
+	iter *treeFileIter
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	return r.ReadCloser.Read(p)
+}
+
+func (r *entryReader) Close() error {
+	r.iter.mu.Lock()
+	delete(r.iter.readers, r)
+	r.iter.mu.Unlock()
+	return r.close()
+}
+
+func (r *entryReader) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.ReadCloser.Close()
+}
+
+// treeEntry returns the entry at p in tree or nil if there is none.
+func treeEntry(tree *object.Tree, p string) (*object.TreeEntry, error) {
+	parts := strings.Split(p, "/")
+	for idx, name := range parts {
+		var entry *object.TreeEntry
+		for j := range tree.Entries {
+			if tree.Entries[j].Name == name {
+				entry = &tree.Entries[j]
+				break
+			}
+		}
+
+		if entry == nil {
+			return nil, nil
+		} else if idx == len(parts)-1 {
+			return entry, nil
+		} else if entry.Mode != filemode.Dir {
+			return nil, nil
+		}
+
+		var err error
+		tree, err = tree.Tree(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// compileGlob splits pattern into its elements and checks that they are
+// well-formed.
+func compileGlob(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	elems := strings.Split(strings.Trim(pattern, "/"), "/")
+	for _, elem := range elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+	}
+	return elems, nil
+}
+
+// matchGlob reports whether p matches the elements of a glob. A glob with
+// a single element only has to match the name of the file.
+func matchGlob(glob []string, p string) bool {
+	switch len(glob) {
+	case 0:
+		return true
+	case 1:
+		if glob[0] != "**" {
+			ok, _ := path.Match(glob[0], path.Base(p))
+			return ok
+		}
+	}
+	return matchElems(glob, strings.Split(p, "/"))
+}
+
+func matchElems(glob []string, elems []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for skip := 0; skip <= len(elems); skip++ {
+				if matchElems(glob[1:], elems[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		} else if ok, _ := path.Match(glob[0], elems[0]); !ok {
+			return false
+		}
+		glob, elems = glob[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
@@ -0,0 +1,318 @@
+package arangit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func fileIterPaths(t *testing.T, r *repository, rev string, opts *FileIterOptions) []string {
+	iter, err := r.FileIterWithOptions(rev, opts)
+	assert.Nil(t, err)
+
+	var paths []string
+	err = iter.ForEach(func(e *FileEntry) error {
+		paths = append(paths, e.Path)
+		return nil
+	})
+	assert.Nil(t, err)
+	return paths
+}
+
+func TestFileIterRecursive(t *testing.T) {
+	r := openTestRepo(t)
+	_, err := r.CommitChangeset("", NewChangeset().
+		Put("README.md", []byte("readme")).
+		Put("config/app.json", []byte(`{"v":1}`)).
+		Put("config/db/prod.json", []byte(`{"db":"prod"}`)).
+		Put("config/db/notes.txt", []byte("notes")).
+		Put("docs/a.json", []byte("{}")), nil)
+	assert.Nil(t, err)
+
+	var contents []string
+	iter, err := r.FileIterForHead()
+	assert.Nil(t, err)
+	err = iter.ForEach(func(e *FileEntry) error {
+		rdr, err := e.Open()
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadAll(rdr)
+		assert.Equal(t, path.Base(e.Path), e.Name())
+		assert.Equal(t, int64(len(content)), e.Size)
+		assert.Equal(t, plumbing.ComputeHash(plumbing.BlobObject, content), e.Hash)
+		assert.Equal(t, filemode.Regular, e.Mode)
+		assert.True(t, testTime.Equal(e.ModTime))
+		contents = append(contents, e.Path+"="+string(content))
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"README.md=readme",
+		`config/app.json={"v":1}`,
+		"config/db/notes.txt=notes",
+		`config/db/prod.json={"db":"prod"}`,
+		"docs/a.json={}",
+	}, contents)
+
+	for _, tc := range []struct {
+		opts  *FileIterOptions
+		paths []string
+	}{
+		{&FileIterOptions{Prefix: "config"}, []string{"config/app.json", "config/db/notes.txt", "config/db/prod.json"}},
+		{&FileIterOptions{Prefix: "/config/db/"}, []string{"config/db/notes.txt", "config/db/prod.json"}},
+		{&FileIterOptions{Prefix: "config/app.json"}, []string{"config/app.json"}},
+		{&FileIterOptions{Prefix: "conf"}, nil},
+		{&FileIterOptions{Prefix: "README.md/x"}, nil},
+		{&FileIterOptions{Glob: "*.json"}, []string{"config/app.json", "config/db/prod.json", "docs/a.json"}},
+		{&FileIterOptions{Glob: "config/*.json"}, []string{"config/app.json"}},
+		{&FileIterOptions{Glob: "config/**/*.json"}, []string{"config/app.json", "config/db/prod.json"}},
+		{&FileIterOptions{Glob: "**/db/*"}, []string{"config/db/notes.txt", "config/db/prod.json"}},
+		{&FileIterOptions{Prefix: "config", Glob: "*.txt"}, []string{"config/db/notes.txt"}},
+	} {
+		assert.Equal(t, tc.paths, fileIterPaths(t, r, "HEAD", tc.opts), "%+v", tc.opts)
+	}
+
+	_, err = r.FileIterWithOptions("HEAD", &FileIterOptions{Glob: "config/[a"})
+	assert.Equal(t, path.ErrBadPattern, err)
+}
+
+func TestFileIterModes(t *testing.T) {
+	r := openTestRepo(t)
+	err := r.CommitFile("a.txt", bytes.NewBufferString("a"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, r.fs.Symlink("a.txt", "link"))
+	wt, err := r.repo.Worktree()
+	assert.Nil(t, err)
+	_, err = wt.Add("link")
+	assert.Nil(t, err)
+	_, err = wt.Commit("add link", &git.CommitOptions{Author: ciService})
+	assert.Nil(t, err)
+
+	modes := map[string]filemode.FileMode{}
+	iter, err := r.FileIterForHead()
+	assert.Nil(t, err)
+	err = iter.ForEach(func(e *FileEntry) error {
+		modes[e.Path] = e.Mode
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]filemode.FileMode{"a.txt": filemode.Regular, "link": filemode.Symlink}, modes)
+
+	// the content of a symlink is its target
+	iter, err = r.FileIterWithOptions("HEAD", &FileIterOptions{Prefix: "link"})
+	assert.Nil(t, err)
+	defer iter.Close()
+	e, err := iter.Next()
+	assert.Nil(t, err)
+	rdr, err := e.Open()
+	assert.Nil(t, err)
+	content, err := ioutil.ReadAll(rdr)
+	assert.Nil(t, err)
+	assert.Equal(t, "a.txt", string(content))
+	assert.Nil(t, rdr.Close())
+}
+
+func TestFileIterClosesReaders(t *testing.T) {
+	r := openTestRepo(t)
+	_, err := r.CommitChangeset("", NewChangeset().
+		Put("a.txt", []byte("a")).
+		Put("b.txt", []byte("b")).
+		Put("c.txt", []byte("c")), nil)
+	assert.Nil(t, err)
+
+	// readers opened in ForEach are closed when the callback returns
+	var leaked []io.ReadCloser
+	iter, err := r.FileIterForHead()
+	assert.Nil(t, err)
+	err = iter.ForEach(func(e *FileEntry) error {
+		rdr, err := e.Open()
+		leaked = append(leaked, rdr)
+		assert.Equal(t, 1, len(iter.(*treeFileIter).readers))
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(leaked))
+	for _, rdr := range leaked {
+		_, err = rdr.Read(make([]byte, 1))
+		assert.Equal(t, os.ErrClosed, err)
+	}
+
+	// ForEach closes the iterator
+	_, err = iter.Next()
+	assert.Equal(t, ErrIteratorClosed, err)
+
+	// readers opened with Next stay open until they or the iterator are
+	// closed
+	iter, err = r.FileIterForHead()
+	assert.Nil(t, err)
+	a, err := iter.Next()
+	assert.Nil(t, err)
+	b, err := iter.Next()
+	assert.Nil(t, err)
+	ra, err := a.Open()
+	assert.Nil(t, err)
+	rb, err := b.Open()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(iter.(*treeFileIter).readers))
+
+	assert.Nil(t, ra.Close())
+	assert.Nil(t, ra.Close())
+	assert.Equal(t, 1, len(iter.(*treeFileIter).readers))
+	content, err := ioutil.ReadAll(rb)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(content))
+
+	iter.Close()
+	assert.Equal(t, 0, len(iter.(*treeFileIter).readers))
+	_, err = rb.Read(make([]byte, 1))
+	assert.Equal(t, os.ErrClosed, err)
+	_, err = a.Open()
+	assert.Equal(t, ErrIteratorClosed, err)
+	_, err = iter.Next()
+	assert.Equal(t, ErrIteratorClosed, err)
+
+	// ErrStop ends ForEach early
+	var paths []string
+	iter, err = r.FileIterForHead()
+	assert.Nil(t, err)
+	err = iter.ForEach(func(e *FileEntry) error {
+		paths = append(paths, e.Path)
+		return ErrStop
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt"}, paths)
+}
+
+func TestFileIterReadsSizesLazily(t *testing.T) {
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+	commitToBranch(t, repo, "master", "a.txt", "a")
+	commitToBranch(t, repo, "master", "b.txt", "b")
+
+	// without the blob of b.txt only its entry fails
+	b := plumbing.ComputeHash(plumbing.BlobObject, []byte("b"))
+	cursor, err := db.Query(context.Background(), "FOR d IN objects FILTER d.hash == @hash REMOVE d IN objects", map[string]interface{}{"hash": b.String()})
+	assert.Nil(t, err)
+	assert.Nil(t, cursor.Close())
+
+	iter, err := repo.FileIterWithOptions("HEAD", nil)
+	assert.Nil(t, err)
+	defer iter.Close()
+	e, err := iter.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "a.txt", e.Path)
+	assert.Equal(t, int64(1), e.Size)
+	_, err = iter.Next()
+	assert.Equal(t, plumbing.ErrObjectNotFound, err)
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, tc := range []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"", "a/b.txt", true},
+		{"**", "a/b.txt", true},
+		{"*.txt", "a/b.txt", true},
+		{"a/*", "a/b.txt", true},
+		{"a/*", "a/b/c.txt", false},
+		{"a/**", "a/b/c.txt", true},
+		{"a/**/c.txt", "a/c.txt", true},
+		{"**/c.txt", "a/b/c.txt", true},
+		{"**/b", "a/b/c.txt", false},
+		{"b/*", "a/b/c.txt", false},
+	} {
+		glob, err := compileGlob(tc.glob)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.match, matchGlob(glob, tc.path), "%s %s", tc.glob, tc.path)
+	}
+}
+
+func TestReadWithoutCheckout(t *testing.T) {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+	r := repo.(*repository)
+
+	err = repo.CommitFile("a.txt", bytes.NewBufferString("first"))
+	assert.Nil(t, err)
+	err = repo.TagHead("v1")
+	assert.Nil(t, err)
+	err = repo.CommitFile("a.txt", bytes.NewBufferString("second"))
+	assert.Nil(t, err)
+	err = repo.CommitFile("b.txt", bytes.NewBufferString("other"))
+	assert.Nil(t, err)
+
+	// an uncommitted change has to survive all reads
+	err = r.writeFile("a.txt", bytes.NewBufferString("uncommitted"))
+	assert.Nil(t, err)
+	head, err := r.repo.Reference(plumbing.HEAD, false)
+	assert.Nil(t, err)
+
+	bites, err := repo.ReadFileFromTag("v1", "a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(bites))
+
+	bites, err = repo.ReadFileFromHead("a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(bites))
+
+	bites, err = repo.ReadFile("HEAD~2", "/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(bites))
+
+	_, err = repo.ReadFileFromTag("v1", "b.txt")
+	assert.Equal(t, object.ErrFileNotFound, err)
+	_, err = repo.ReadFileFromTag("v2", "a.txt")
+	assert.Equal(t, ErrTagDoesntExist, err)
+
+	var names []string
+	iter, err := repo.FileIterForTag("v1")
+	assert.Nil(t, err)
+	err = iter.ForEach(func(e *FileEntry) error {
+		names = append(names, e.Name())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt"}, names)
+
+	names = nil
+	iter, err = repo.FileIterForHead()
+	assert.Nil(t, err)
+	err = iter.ForEach(func(e *FileEntry) error {
+		rdr, err := e.Open()
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadAll(rdr)
+		names = append(names, e.Name()+"="+string(content))
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt=second", "b.txt=other"}, names)
+
+	f, err := r.fs.Open("a.txt")
+	assert.Nil(t, err)
+	content, err := ioutil.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "uncommitted", string(content))
+	assert.Nil(t, f.Close())
+
+	after, err := r.repo.Reference(plumbing.HEAD, false)
+	assert.Nil(t, err)
+	assert.Equal(t, head.String(), after.String())
+}
@@ -0,0 +1,512 @@
+package arangit
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/mhelmich/arangit/arangodb"
+)
+
+const (
+	defaultSearchLimit   = 10
+	defaultSnippetLength = 120
+)
+
+// SearchOptions -
+type SearchOptions struct {
+	// Analyzer is the ArangoSearch analyzer used for the query and the
+	// indexed files, it defaults to text_en
+	Analyzer string
+	// Limit is the maximum number of results, it defaults to 10
+	Limit int
+	// Offset is the number of results to skip
+	Offset int
+	// SnippetLength is the maximum length of a snippet in characters, it
+	// defaults to 120
+	SnippetLength int
+}
+
+// SearchResult -
+type SearchResult struct {
+	Path    string
+	Score   float64
+	Snippet string
+}
+
+// Search returns the text files at ref that match query, best matches
+// first. ref can be HEAD or the name of a branch or tag. The search index
+// of ref is created on first use and kept up to date by later commits.
+func (r *repository) Search(ref string, query string, opts *SearchOptions) ([]SearchResult, error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+
+	name, err := r.resolveRefName(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	r.locks.index.Lock()
+	err = r.updateSearchIndex(name)
+	r.locks.index.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	hits, err := r.store.Search(name, arangodb.SearchQuery{
+		Terms:    query,
+		Analyzer: opts.Analyzer,
+		Offset:   opts.Offset,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snippetLength := opts.SnippetLength
+	if snippetLength <= 0 {
+		snippetLength = defaultSnippetLength
+	}
+
+	results := make([]SearchResult, len(hits))
+	for i, hit := range hits {
+		results[i] = SearchResult{
+			Path:    hit.Path,
+			Score:   hit.Score,
+			Snippet: snippet(hit.Content, query, snippetLength),
+		}
+	}
+	return results, nil
+}
+
+// HistorySearchResult is a version of a file that matches a history
+// search. The content existed at Path from Commit until RemovedIn, which is
+// plumbing.ZeroHash if the content is still there.
+type HistorySearchResult struct {
+	Path        string
+	Hash        plumbing.Hash
+	Commit      plumbing.Hash
+	When        time.Time
+	RemovedIn   plumbing.Hash
+	RemovedWhen time.Time
+	Score       float64
+	Snippet     string
+}
+
+// SearchHistory returns every version of every text file reachable from ref
+// that matches query, best matches first and the oldest version first among
+// versions of the same content. The matching contents are looked up in the
+// path index, so no trees have to be read except for merge commits, which
+// are only listed if the file differs from all their parents. Only files
+// committed while RepoOptions.IndexContent was set are found, otherwise
+// arangodb.ErrContentNotIndexed is returned.
+func (r *repository) SearchHistory(ref string, query string, opts *SearchOptions) ([]HistorySearchResult, error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+
+	name, err := r.resolveRefName(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := r.repo.ResolveRevision(plumbing.Revision(name))
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := r.indexedHistory(*h)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	snippetLength := opts.SnippetLength
+	if snippetLength <= 0 {
+		snippetLength = defaultSnippetLength
+	}
+
+	// the store pages through matching contents, which can be at several
+	// paths, so pages are fetched until there are enough versions
+	s := newHistorySearch(r, commits)
+	want := opts.Offset + limit
+	var results []HistorySearchResult
+	for offset := 0; len(results) < want; offset += want {
+		hits, err := r.store.SearchHistory(arangodb.SearchQuery{
+			Terms:    query,
+			Analyzer: opts.Analyzer,
+			Offset:   offset,
+			Limit:    want,
+		}, s.hashes)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range hits {
+			versions, err := s.versions(hit)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, v := range versions {
+				v.Score = hit.Score
+				v.Snippet = snippet(hit.Content, query, snippetLength)
+				results = append(results, v)
+			}
+		}
+
+		if len(hits) < want {
+			break
+		}
+	}
+
+	if opts.Offset >= len(results) {
+		return nil, nil
+	}
+	results = results[opts.Offset:]
+	if limit < len(results) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// historySearch turns the path index entries of matching contents into
+// versions of files in the history of a commit.
+type historySearch struct {
+	r       *repository
+	hashes  []plumbing.Hash
+	commits map[plumbing.Hash]*object.Commit
+	// children maps commits to the commits that have them as a parent
+	children map[plumbing.Hash][]*object.Commit
+	changes  map[string]map[plumbing.Hash]arangodb.PathChange
+	filters  map[string]*logFilter
+}
+
+func newHistorySearch(r *repository, commits []*object.Commit) *historySearch {
+	s := &historySearch{
+		r:        r,
+		hashes:   make([]plumbing.Hash, len(commits)),
+		commits:  make(map[plumbing.Hash]*object.Commit, len(commits)),
+		children: map[plumbing.Hash][]*object.Commit{},
+		changes:  map[string]map[plumbing.Hash]arangodb.PathChange{},
+		filters:  map[string]*logFilter{},
+	}
+
+	for i, c := range commits {
+		s.hashes[i] = c.Hash
+		s.commits[c.Hash] = c
+		for _, p := range c.ParentHashes {
+			s.children[p] = append(s.children[p], c)
+		}
+	}
+	return s
+}
+
+// versions returns the versions of files that have the content of hit.
+func (s *historySearch) versions(hit arangodb.HistoryHit) ([]HistorySearchResult, error) {
+	blob := plumbing.NewHash(hit.Hash)
+	var versions []HistorySearchResult
+	for _, ch := range hit.Changes {
+		c, ok := s.commits[plumbing.NewHash(ch.Commit)]
+		if !ok {
+			continue
+		}
+
+		if c.NumParents() > 1 {
+			ok, err := s.filter(ch.Path).match(c)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+		}
+
+		removed, err := s.removedIn(ch.Path, blob, c)
+		if err != nil {
+			return nil, err
+		}
+
+		v := HistorySearchResult{
+			Path:   ch.Path,
+			Hash:   blob,
+			Commit: c.Hash,
+			When:   c.Committer.When,
+		}
+		if removed != nil {
+			v.RemovedIn = removed.Hash
+			v.RemovedWhen = removed.Committer.When
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].When.Equal(versions[j].When) {
+			return versions[i].When.Before(versions[j].When)
+		}
+		return versions[i].Path < versions[j].Path
+	})
+	return versions, nil
+}
+
+// removedIn returns the first commit after c that changed the file at p
+// from blob to something else, the oldest one if several branches did. It
+// returns nil if the file still has that content.
+func (s *historySearch) removedIn(p string, blob plumbing.Hash, c *object.Commit) (*object.Commit, error) {
+	changes, ok := s.changes[p]
+	if !ok {
+		var err error
+		changes, err = s.r.pathChanges(p)
+		if err != nil {
+			return nil, err
+		}
+		s.changes[p] = changes
+	}
+
+	var removed *object.Commit
+	seen := map[plumbing.Hash]bool{c.Hash: true}
+	queue := []*object.Commit{c}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, child := range s.children[next.Hash] {
+			if seen[child.Hash] {
+				continue
+			}
+			seen[child.Hash] = true
+
+			// the path index only compares merge commits to their first
+			// parent, so their file is looked up instead
+			var changed bool
+			if child.NumParents() > 1 {
+				h, err := s.filter(p).entry(child.Hash)
+				if err != nil {
+					return nil, err
+				}
+				changed = h != blob
+			} else if ch, ok := changes[child.Hash]; ok {
+				changed = ch.Blob != blob.String()
+			}
+
+			if !changed {
+				queue = append(queue, child)
+			} else if removed == nil || child.Committer.When.Before(removed.Committer.When) {
+				removed = child
+			}
+		}
+	}
+	return removed, nil
+}
+
+func (s *historySearch) filter(p string) *logFilter {
+	f, ok := s.filters[p]
+	if !ok {
+		f = newLogFilter(s.r, &LogOptions{Path: p})
+		s.filters[p] = f
+	}
+	return f
+}
+
+// resolveRefName returns the full name of the reference called name. Short
+// branch and tag names are accepted.
+func (r *repository) resolveRefName(name string) (plumbing.ReferenceName, error) {
+	candidates := []plumbing.ReferenceName{
+		plumbing.ReferenceName(name),
+		plumbing.NewBranchReferenceName(name),
+		plumbing.NewTagReferenceName(name),
+	}
+
+	for _, c := range candidates {
+		_, err := r.repo.Reference(c, true)
+		if err == nil {
+			return c, nil
+		} else if err != plumbing.ErrReferenceNotFound {
+			return "", err
+		}
+	}
+	return "", plumbing.ErrReferenceNotFound
+}
+
+// updateSearchIndexes brings the search indexes of all refs up to date and
+// drops the indexes of refs that no longer exist.
+func (r *repository) updateSearchIndexes() error {
+	r.locks.index.Lock()
+	defer r.locks.index.Unlock()
+
+	refs, err := r.store.SearchIndexRefs()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range refs {
+		err = r.updateSearchIndex(name)
+		if err == plumbing.ErrReferenceNotFound {
+			err = r.store.DropSearchIndex(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateSearchIndex indexes the changes between the commit the search
+// index of name is at and the commit name points to. The caller has to hold
+// the index lock.
+func (r *repository) updateSearchIndex(name plumbing.ReferenceName) error {
+	h, err := r.repo.ResolveRevision(plumbing.Revision(name))
+	if err != nil {
+		return err
+	}
+
+	indexed, err := r.store.SearchIndexCommit(name)
+	if err != nil {
+		return err
+	} else if indexed == *h {
+		return nil
+	}
+
+	to, err := r.commitTree(*h)
+	if err != nil {
+		return err
+	}
+
+	var from *object.Tree
+	if !indexed.IsZero() {
+		from, err = r.commitTree(indexed)
+		if err == plumbing.ErrObjectNotFound {
+			// the indexed commit is gone, start over
+			err = r.store.DropSearchIndex(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return err
+	}
+
+	var upserts []arangodb.SearchDocument
+	var deletes []string
+	for _, ch := range changes {
+		action, err := ch.Action()
+		if err != nil {
+			return err
+		}
+
+		if action == merkletrie.Delete {
+			deletes = append(deletes, ch.From.Name)
+			continue
+		}
+
+		doc, ok, err := searchDocument(to, ch.To)
+		if err != nil {
+			return err
+		} else if ok {
+			upserts = append(upserts, doc)
+		} else if action == merkletrie.Modify {
+			deletes = append(deletes, ch.To.Name)
+		}
+	}
+
+	return r.store.UpdateSearchIndex(name, *h, upserts, deletes)
+}
+
+func (r *repository) commitTree(h plumbing.Hash) (*object.Tree, error) {
+	commit, err := r.repo.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+// searchDocument returns the search document for the file at entry. Only
+// regular text files are indexed.
+func searchDocument(tree *object.Tree, entry object.ChangeEntry) (arangodb.SearchDocument, bool, error) {
+	if !entry.TreeEntry.Mode.IsFile() || entry.TreeEntry.Mode == filemode.Symlink {
+		return arangodb.SearchDocument{}, false, nil
+	}
+
+	f, err := tree.TreeEntryFile(&entry.TreeEntry)
+	if err != nil {
+		return arangodb.SearchDocument{}, false, err
+	}
+
+	binary, err := f.IsBinary()
+	if err != nil || binary {
+		return arangodb.SearchDocument{}, false, err
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return arangodb.SearchDocument{}, false, err
+	}
+
+	return arangodb.SearchDocument{
+		Path:    entry.Name,
+		Hash:    f.Hash.String(),
+		Content: content,
+	}, true, nil
+}
+
+// snippet returns up to length characters of content around the first
+// occurrence of one of the words in query. Whitespace is collapsed so that
+// snippets fit on a single line.
+func snippet(content string, query string, length int) string {
+	text := []rune(strings.Join(strings.Fields(content), " "))
+	lower := []rune(strings.ToLower(string(text)))
+	start := -1
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if i := runeIndex(lower, []rune(word)); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+	}
+
+	// show a bit of context before the match
+	if start -= length / 4; start < 0 {
+		start = 0
+	}
+	end := start + length
+	if end > len(text) {
+		end = len(text)
+		if start = end - length; start < 0 {
+			start = 0
+		}
+	}
+
+	s := string(text[start:end])
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(text) {
+		s += "..."
+	}
+	return s
+}
+
+func runeIndex(s []rune, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if string(s[i:i+len(sub)]) == string(sub) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,155 @@
+package arangit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mhelmich/arangit/arangodb"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	repo, err := OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("1.json", bytes.NewBufferString(json1))
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("2.json", bytes.NewBufferString(json2))
+	assert.Nil(t, err)
+
+	results, err := repo.Search("HEAD", "female", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "2.json", results[0].Path)
+	assert.Contains(t, results[0].Snippet, "female")
+
+	// the index is updated incrementally by the commits below
+	err = repo.CommitFile("3.json", bytes.NewBufferString(json3))
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("1.json", bytes.NewBufferString(`{"name":"Vang Pace","gender":"female"}`))
+	assert.Nil(t, err)
+
+	results, err = repo.Search("master", "female", &SearchOptions{SnippetLength: 20})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	for _, r := range results {
+		assert.True(t, len(r.Snippet) <= 26, r.Snippet)
+	}
+
+	results, err = repo.Search("HEAD", "jackie female", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, "2.json", results[0].Path)
+	assert.True(t, results[0].Score > results[1].Score)
+
+	results, err = repo.Search("HEAD", "female", &SearchOptions{Offset: 1, Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+
+	// the tag gets its own index which doesn't see later commits
+	err = repo.TagHead("v1")
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("4.json", bytes.NewBufferString(`{"name":"Someone Else","gender":"female"}`))
+	assert.Nil(t, err)
+
+	results, err = repo.Search("v1", "female", &SearchOptions{Analyzer: "text_de"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+
+	results, err = repo.Search("HEAD", "female", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(results))
+
+	_, err = repo.Search("no-such-ref", "female", nil)
+	assert.Equal(t, plumbing.ErrReferenceNotFound, err)
+
+	_, err = repo.Search("HEAD", "female", &SearchOptions{Analyzer: "no-such-analyzer"})
+	assert.NotNil(t, err)
+}
+
+func TestSnippet(t *testing.T) {
+	content := "first line\nsecond   line with a match\nthird line"
+	assert.Equal(t, "first line second line with a match third line", snippet(content, "match", 100))
+	assert.Equal(t, "...with a match third line", snippet(content, "MATCH", 23))
+	assert.Equal(t, "first...", snippet(content, "nothing", 5))
+}
+
+func TestSearchHistory(t *testing.T) {
+	repo, err := OpenRepoFromDatabaseWithOptions(arangotest.NewDatabase("arangit"), &RepoOptions{IndexContent: true})
+	assert.Nil(t, err)
+
+	var commits []plumbing.Hash
+	for _, f := range [][]string{
+		{"a.txt", "the secret is alpha"},
+		{"b.txt", "nothing to see here"},
+		{"a.txt", "the secret is beta"},
+	} {
+		err = repo.CommitFile(f[0], bytes.NewBufferString(f[1]))
+		assert.Nil(t, err)
+
+		head, err := repo.(*repository).repo.Head()
+		assert.Nil(t, err)
+		commits = append(commits, head.Hash())
+	}
+
+	results, err := repo.SearchHistory("master", "alpha", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "a.txt", results[0].Path)
+	assert.Equal(t, commits[0], results[0].Commit)
+	assert.Equal(t, commits[2], results[0].RemovedIn)
+	assert.False(t, results[0].When.IsZero())
+	assert.Equal(t, "the secret is alpha", results[0].Snippet)
+
+	results, err = repo.SearchHistory("HEAD", "secret", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.ElementsMatch(t, []plumbing.Hash{commits[0], commits[2]}, []plumbing.Hash{results[0].Commit, results[1].Commit})
+	for _, res := range results {
+		assert.Equal(t, res.Commit == commits[2], res.RemovedIn.IsZero())
+	}
+
+	second := results[1]
+	results, err = repo.SearchHistory("HEAD", "secret", &SearchOptions{Offset: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []HistorySearchResult{second}, results)
+
+	results, err = repo.SearchHistory("HEAD", "gamma", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(results))
+
+	// content that only existed on a merged branch is attributed to the
+	// commit on that branch
+	assert.Nil(t, repo.CreateBranch("side", ""))
+	assert.Nil(t, repo.CommitFileToBranch("side", "c.txt", bytes.NewBufferString("the secret is gamma"), nil))
+	side := headCommit(t, repo.(*repository), "side").Hash
+	assert.Nil(t, repo.CommitFileToBranch("master", "b.txt", bytes.NewBufferString("still nothing"), nil))
+	result, err := repo.Merge("side", "master", nil)
+	assert.Nil(t, err)
+	assert.False(t, result.FastForward)
+	assert.Nil(t, repo.CommitFileToBranch("side", "c.txt", bytes.NewBufferString("the secret is delta"), nil))
+
+	results, err = repo.SearchHistory("master", "gamma", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "c.txt", results[0].Path)
+	assert.Equal(t, side, results[0].Commit)
+	assert.True(t, results[0].RemovedIn.IsZero())
+
+	results, err = repo.SearchHistory("side", "gamma", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, headCommit(t, repo.(*repository), "side").Hash, results[0].RemovedIn)
+
+	// the content isn't stored unless it's asked for
+	repo, err = OpenRepoFromDatabase(arangotest.NewDatabase("arangit"))
+	assert.Nil(t, err)
+	assert.Nil(t, repo.CommitFile("a.txt", bytes.NewBufferString("the secret is alpha")))
+	_, err = repo.SearchHistory("master", "alpha", nil)
+	assert.Equal(t, arangodb.ErrContentNotIndexed, err)
+}
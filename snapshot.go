@@ -0,0 +1,315 @@
+package arangit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrDocumentKeyMissing is returned when a document has no _key attribute.
+var ErrDocumentKeyMissing = errors.New("document has no _key")
+
+// SnapshotOptions -
+type SnapshotOptions struct {
+	// Dir is the directory the documents are written to, it defaults to
+	// the name of the collection
+	Dir string
+	// Tag is the name of a tag created for the snapshot if set
+	Tag string
+	// CommitOptions configure the commit and the tag, the message defaults
+	// to "snapshot of collection <name>"
+	CommitOptions
+}
+
+// SnapshotCollection writes every document of the collection called name
+// to Dir/<_key>.json, deletes the files of documents that no longer exist
+// and commits the result. Documents are written with sorted attributes so
+// that unchanged documents result in unchanged files. If nothing changed
+// since the last snapshot no commit is created and the hash of HEAD is
+// returned.
+func (r *repository) SnapshotCollection(name string, opts *SnapshotOptions) (plumbing.Hash, error) {
+	if opts == nil {
+		opts = &SnapshotOptions{}
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = name
+	}
+
+	docs, err := r.store.CollectionDocuments(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h, err := r.commitSnapshot(dir, r.commitInfo(&opts.CommitOptions, "snapshot of collection "+name), docs)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if opts.Tag != "" {
+		// the tag gets its own message
+		tagOpts := opts.CommitOptions
+		tagOpts.Message = ""
+		err = r.createTag(opts.Tag, h, &tagOpts)
+	}
+	return h, err
+}
+
+// commitSnapshot writes docs to dir in the worktree and commits them. It
+// returns the hash of HEAD if nothing changed.
+func (r *repository) commitSnapshot(dir string, info commitInfo, docs []json.RawMessage) (plumbing.Hash, error) {
+	unlock, err := r.lockWorktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer unlock()
+
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// the worktree is empty after the repository was opened again, so
+	// the files of the last snapshot are taken from HEAD
+	stale, err := r.snapshotFiles(dir)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, doc := range docs {
+		key, content, err := snapshotDocument(doc)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		p := path.Join(dir, key+".json")
+		delete(stale, p)
+		err = r.writeFile(p, bytes.NewReader(content))
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		_, err = wt.Add(p)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	for p := range stale {
+		_, err = wt.Remove(p)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	changed, err := stagedChanges(wt, dir)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var h plumbing.Hash
+	if changed {
+		h, err = wt.Commit(info.message, &git.CommitOptions{
+			Author:    &info.author,
+			Committer: &info.committer,
+		})
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		err = r.updateSearchIndexes()
+	} else {
+		var head *plumbing.Reference
+		head, err = r.repo.Head()
+		if head != nil {
+			h = head.Hash()
+		}
+	}
+	return h, err
+}
+
+// snapshotFiles returns the paths of the JSON files in dir at HEAD.
+func (r *repository) snapshotFiles(dir string) (map[string]bool, error) {
+	files := map[string]bool{}
+	head, err := r.repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return files, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	tree, err := r.commitTree(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err = tree.Tree(dir)
+	if err == object.ErrDirectoryNotFound {
+		return files, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, e := range tree.Entries {
+		if e.Mode.IsFile() && strings.HasSuffix(e.Name, ".json") {
+			files[path.Join(dir, e.Name)] = true
+		}
+	}
+	return files, nil
+}
+
+// RestoreOptions -
+type RestoreOptions struct {
+	// Dir is the directory the snapshot was written to, it defaults to the
+	// name of the collection
+	Dir string
+	// DryRun only reports the changes a restore would make
+	DryRun bool
+}
+
+// RestoreReport lists the keys of the documents a restore inserts, updates
+// and removes.
+type RestoreReport struct {
+	Inserted []string
+	Updated  []string
+	Removed  []string
+}
+
+// RestoreCollection makes the collection called name match the snapshot
+// taken by SnapshotCollection at rev, which can be a tag, a branch or a
+// commit hash. Documents are inserted, replaced and removed as needed in a
+// single transaction, unless opts.DryRun is set.
+func (r *repository) RestoreCollection(name string, rev string, opts *RestoreOptions) (*RestoreReport, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = name
+	}
+
+	h, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := r.commitTree(*h)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err = tree.Tree(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := map[string][]byte{}
+	for _, entry := range tree.Entries {
+		if !entry.Mode.IsFile() || !strings.HasSuffix(entry.Name, ".json") {
+			continue
+		}
+
+		f, err := tree.TreeEntryFile(&entry)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+
+		key, canonical, err := snapshotDocument(json.RawMessage(content))
+		if err != nil {
+			return nil, err
+		}
+		snapshot[key] = canonical
+	}
+
+	docs, err := r.store.CollectionDocuments(name)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RestoreReport{}
+	replace := map[string]json.RawMessage{}
+	for _, doc := range docs {
+		key, current, err := snapshotDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		content, ok := snapshot[key]
+		if !ok {
+			report.Removed = append(report.Removed, key)
+			continue
+		}
+
+		delete(snapshot, key)
+		if !bytes.Equal(current, content) {
+			report.Updated = append(report.Updated, key)
+			replace[key] = content
+		}
+	}
+
+	for key, content := range snapshot {
+		report.Inserted = append(report.Inserted, key)
+		replace[key] = content
+	}
+	sort.Strings(report.Inserted)
+
+	if opts.DryRun {
+		return report, nil
+	}
+	return report, r.store.ReplaceDocuments(name, replace, report.Removed)
+}
+
+// snapshotDocument returns the key of doc and its canonical JSON encoding.
+// Numbers are kept as they are to avoid changes caused by reformatting.
+func snapshotDocument(doc json.RawMessage) (string, []byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v map[string]interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, ok := v["_key"].(string)
+	if !ok || key == "" {
+		return "", nil, ErrDocumentKeyMissing
+	}
+
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	return key, append(content, '\n'), nil
+}
+
+// stagedChanges reports whether any file below dir is staged for commit.
+func stagedChanges(wt *git.Worktree, dir string) (bool, error) {
+	st, err := wt.Status()
+	if err != nil {
+		return false, err
+	}
+
+	for p, s := range st {
+		if !strings.HasPrefix(p, dir+"/") {
+			continue
+		}
+		if s.Staging != git.Unmodified && s.Staging != git.Untracked {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,185 @@
+package arangit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotCollectionAfterReopen(t *testing.T) {
+	ctx := context.Background()
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	coll, err := db.CreateCollection(ctx, "users", nil)
+	assert.Nil(t, err)
+	for _, key := range []string{"a", "b"} {
+		_, err = coll.CreateDocument(ctx, map[string]interface{}{"_key": key})
+		assert.Nil(t, err)
+	}
+
+	first, err := repo.SnapshotCollection("users", nil)
+	assert.Nil(t, err)
+
+	_, err = coll.RemoveDocument(ctx, "b")
+	assert.Nil(t, err)
+
+	// the worktree of the new repository is empty
+	repo, err = OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+	second, err := repo.SnapshotCollection("users", nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+
+	r := repo.(*repository)
+	assert.Equal(t, []string{"users/b.json"}, commitChanges(t, r, first, second))
+	_, err = headCommit(t, r, "HEAD").File("users/a.json")
+	assert.Nil(t, err)
+}
+
+func TestSnapshotCollection(t *testing.T) {
+	ctx := context.Background()
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	coll, err := db.CreateCollection(ctx, "users", nil)
+	assert.Nil(t, err)
+	for _, doc := range []string{json1, json2, json3} {
+		var m map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(doc), &m))
+		m["_key"] = m["guid"]
+		_, err = coll.CreateDocument(ctx, m)
+		assert.Nil(t, err)
+	}
+
+	first, err := repo.SnapshotCollection("users", &SnapshotOptions{Tag: "snap-1"})
+	assert.Nil(t, err)
+	assert.False(t, first.IsZero())
+
+	r := repo.(*repository)
+	commit, err := r.repo.CommitObject(first)
+	assert.Nil(t, err)
+	assert.Equal(t, "snapshot of collection users", commit.Message)
+
+	f, err := commit.File("users/3cab3480-04df-4242-a840-35220c156c31.json")
+	assert.Nil(t, err)
+	content, err := f.Contents()
+	assert.Nil(t, err)
+	assert.Contains(t, content, `"_key": "3cab3480-04df-4242-a840-35220c156c31"`)
+	assert.NotContains(t, content, "_rev")
+
+	// touching a document without changing it doesn't produce a commit
+	_, err = coll.UpdateDocument(ctx, "3cab3480-04df-4242-a840-35220c156c31", map[string]interface{}{"age": 30})
+	assert.Nil(t, err)
+
+	second, err := repo.SnapshotCollection("users", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+
+	_, err = coll.UpdateDocument(ctx, "3cab3480-04df-4242-a840-35220c156c31", map[string]interface{}{"age": 31})
+	assert.Nil(t, err)
+	_, err = coll.RemoveDocument(ctx, "aaf05a3c-8754-49bb-a4d6-13609c33514a")
+	assert.Nil(t, err)
+
+	third, err := repo.SnapshotCollection("users", &SnapshotOptions{Dir: "users", CommitOptions: CommitOptions{Message: "nightly"}})
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, third)
+
+	changes := commitChanges(t, r, first, third)
+	assert.Equal(t, []string{
+		"users/3cab3480-04df-4242-a840-35220c156c31.json",
+		"users/aaf05a3c-8754-49bb-a4d6-13609c33514a.json",
+	}, changes)
+
+	tagged, err := r.repo.ResolveRevision("snap-1")
+	assert.Nil(t, err)
+	assert.Equal(t, first, *tagged)
+}
+
+func commitChanges(t *testing.T, r *repository, from, to plumbing.Hash) []string {
+	fromTree, err := r.commitTree(from)
+	assert.Nil(t, err)
+	toTree, err := r.commitTree(to)
+	assert.Nil(t, err)
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	assert.Nil(t, err)
+
+	var paths []string
+	for _, ch := range changes {
+		if ch.To.Name != "" {
+			paths = append(paths, ch.To.Name)
+		} else {
+			paths = append(paths, ch.From.Name)
+		}
+	}
+	return paths
+}
+
+func TestRestoreCollection(t *testing.T) {
+	ctx := context.Background()
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	coll, err := db.CreateCollection(ctx, "users", nil)
+	assert.Nil(t, err)
+	for _, key := range []string{"a", "b", "c"} {
+		_, err = coll.CreateDocument(ctx, map[string]interface{}{"_key": key, "name": key, "n": 1.5})
+		assert.Nil(t, err)
+	}
+
+	_, err = repo.SnapshotCollection("users", &SnapshotOptions{Tag: "v1"})
+	assert.Nil(t, err)
+
+	_, err = coll.UpdateDocument(ctx, "a", map[string]interface{}{"name": "changed"})
+	assert.Nil(t, err)
+	_, err = coll.RemoveDocument(ctx, "b")
+	assert.Nil(t, err)
+	_, err = coll.CreateDocument(ctx, map[string]interface{}{"_key": "d", "name": "d"})
+	assert.Nil(t, err)
+
+	report, err := repo.RestoreCollection("users", "v1", &RestoreOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, &RestoreReport{
+		Inserted: []string{"b"},
+		Updated:  []string{"a"},
+		Removed:  []string{"d"},
+	}, report)
+
+	count, err := coll.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	report, err = repo.RestoreCollection("users", "v1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, report.Updated)
+
+	cursor, err := db.Query(ctx, "FOR d IN users SORT d._key RETURN d.name", nil)
+	assert.Nil(t, err)
+	var names []string
+	for cursor.HasMore() {
+		var name string
+		_, err = cursor.ReadDocument(ctx, &name)
+		assert.Nil(t, err)
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	report, err = repo.RestoreCollection("users", "v1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &RestoreReport{}, report)
+
+	_, err = repo.RestoreCollection("users", "v1", &RestoreOptions{Dir: "missing"})
+	assert.Equal(t, object.ErrDirectoryNotFound, err)
+
+	_, err = repo.RestoreCollection("users", "no-such-tag", nil)
+	assert.NotNil(t, err)
+}
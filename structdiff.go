@@ -0,0 +1,317 @@
+package arangit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var errTrailingData = errors.New("invalid data after top-level value")
+
+// StructuralDiffer compares two versions of a file by value. from is nil if
+// the file was added, to if it was deleted.
+type StructuralDiffer func(from []byte, to []byte) (*StructuralDiff, error)
+
+// defaultStructuralDiffers are the differs Diff uses for
+// DiffOptions.Structural by file extension, see
+// RepoOptions.StructuralDiffers and DiffOptions.Differs.
+var defaultStructuralDiffers = map[string]StructuralDiffer{
+	".json": DiffJSON,
+	".yaml": DiffYAML,
+	".yml":  DiffYAML,
+}
+
+// ValueChange is a value that was added, removed or changed. Pointer is the
+// JSON pointer of the value, see RFC 6901. Old is nil for added values, New
+// for removed ones. Type is never ChangeRenamed.
+type ValueChange struct {
+	Type    ChangeType
+	Pointer string
+	Old     interface{}
+	New     interface{}
+}
+
+// StructuralDiff lists the values that differ between two documents.
+// Object members are compared by key in key order, array elements by
+// index.
+type StructuralDiff struct {
+	Changes []ValueChange
+}
+
+// JSONPatchOperation is an operation of a JSON Patch, see RFC 6902.
+type JSONPatchOperation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+// MarshalJSON leaves out the value of remove operations but keeps null
+// values of the other operations.
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{o.Op, o.Path, o.Value})
+}
+
+// JSONPatch returns the changes as a JSON Patch that turns the old document
+// into the new one when applied in order.
+func (d *StructuralDiff) JSONPatch() []JSONPatchOperation {
+	ops := make([]JSONPatchOperation, 0, len(d.Changes))
+	for _, ch := range d.Changes {
+		switch ch.Type {
+		case ChangeAdded:
+			ops = append(ops, JSONPatchOperation{Op: "add", Path: ch.Pointer, Value: ch.New})
+		case ChangeDeleted:
+			ops = append(ops, JSONPatchOperation{Op: "remove", Path: ch.Pointer})
+		default:
+			ops = append(ops, JSONPatchOperation{Op: "replace", Path: ch.Pointer, Value: ch.New})
+		}
+	}
+	return ops
+}
+
+// Summary returns one line per change. Added values start with "+",
+// removed ones with "-" and changed ones with "~", followed by the pointer
+// and the values as JSON, e.g. `~ /balance: 10 -> 20`.
+func (d *StructuralDiff) Summary() string {
+	var sb strings.Builder
+	for _, ch := range d.Changes {
+		switch ch.Type {
+		case ChangeAdded:
+			fmt.Fprintf(&sb, "+ %s: %s\n", ch.Pointer, summaryValue(ch.New))
+		case ChangeDeleted:
+			fmt.Fprintf(&sb, "- %s: %s\n", ch.Pointer, summaryValue(ch.Old))
+		default:
+			fmt.Fprintf(&sb, "~ %s: %s -> %s\n", ch.Pointer, summaryValue(ch.Old), summaryValue(ch.New))
+		}
+	}
+	return sb.String()
+}
+
+func summaryValue(v interface{}) string {
+	bites, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bites)
+}
+
+// DiffJSON is the StructuralDiffer for JSON documents.
+func DiffJSON(from []byte, to []byte) (*StructuralDiff, error) {
+	return diffDocuments(from, to, parseJSON)
+}
+
+// DiffYAML is the StructuralDiffer for YAML documents. Only the first
+// document of a stream is compared. It returns ErrInvalidDocument for
+// values JSON can't represent, such as .nan and .inf.
+func DiffYAML(from []byte, to []byte) (*StructuralDiff, error) {
+	return diffDocuments(from, to, parseYAML)
+}
+
+func diffDocuments(from []byte, to []byte, parse func([]byte) (interface{}, error)) (*StructuralDiff, error) {
+	d := &StructuralDiff{}
+	if from == nil && to == nil {
+		return d, nil
+	}
+
+	var oldDoc, newDoc interface{}
+	var err error
+	if from != nil {
+		oldDoc, err = parse(from)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if to != nil {
+		newDoc, err = parse(to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case from == nil:
+		d.add(ChangeAdded, "", nil, newDoc)
+	case to == nil:
+		d.add(ChangeDeleted, "", oldDoc, nil)
+	default:
+		d.diff("", oldDoc, newDoc)
+	}
+	return d, nil
+}
+
+func (d *StructuralDiff) add(t ChangeType, pointer string, old interface{}, new interface{}) {
+	d.Changes = append(d.Changes, ValueChange{Type: t, Pointer: pointer, Old: old, New: new})
+}
+
+func (d *StructuralDiff) diff(pointer string, old interface{}, new interface{}) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			d.diffObjects(pointer, o, n)
+			return
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			d.diffArrays(pointer, o, n)
+			return
+		}
+	}
+
+	if !scalarsEqual(old, new) {
+		d.add(ChangeModified, pointer, old, new)
+	}
+}
+
+func (d *StructuralDiff) diffObjects(pointer string, old map[string]interface{}, new map[string]interface{}) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := pointer + "/" + escapePointerToken(k)
+		o, inOld := old[k]
+		n, inNew := new[k]
+		switch {
+		case !inNew:
+			d.add(ChangeDeleted, p, o, nil)
+		case !inOld:
+			d.add(ChangeAdded, p, nil, n)
+		default:
+			d.diff(p, o, n)
+		}
+	}
+}
+
+// diffArrays compares the common elements by index, then removes surplus
+// elements from the end or appends new ones, so that the resulting patch
+// applies in order.
+func (d *StructuralDiff) diffArrays(pointer string, old []interface{}, new []interface{}) {
+	common := len(old)
+	if len(new) < common {
+		common = len(new)
+	}
+
+	for i := 0; i < common; i++ {
+		d.diff(pointer+"/"+strconv.Itoa(i), old[i], new[i])
+	}
+	for i := len(old) - 1; i >= common; i-- {
+		d.add(ChangeDeleted, pointer+"/"+strconv.Itoa(i), old[i], nil)
+	}
+	for i := common; i < len(new); i++ {
+		d.add(ChangeAdded, pointer+"/"+strconv.Itoa(i), nil, new[i])
+	}
+}
+
+// scalarsEqual compares two values that aren't both objects or both
+// arrays. Numbers are equal if they have the same value, so 1 equals 1.0.
+func scalarsEqual(a interface{}, b interface{}) bool {
+	if an, ok := a.(json.Number); ok {
+		if bn, ok := b.(json.Number); ok {
+			if an == bn {
+				return true
+			}
+			af, aerr := an.Float64()
+			bf, berr := bn.Float64()
+			return aerr == nil && berr == nil && af == bf
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func escapePointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// parseJSON decodes a single JSON value, anything but whitespace after it
+// is an error like with json.Unmarshal.
+func parseJSON(bites []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(bites))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dec.Token()
+	if err != io.EOF {
+		return nil, errTrailingData
+	}
+	return v, nil
+}
+
+func parseYAML(bites []byte) (interface{}, error) {
+	var v interface{}
+	err := yaml.Unmarshal(bites, &v)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeYAML(v)
+}
+
+// normalizeYAML turns the values decoded by the yaml package into the
+// values encoding/json would decode, so that YAML documents can be
+// compared, patched and marshaled like JSON documents.
+// It returns ErrInvalidDocument for NaN and infinite floats.
+func normalizeYAML(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			n, err := normalizeYAML(e)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = n
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range v {
+			n, err := normalizeYAML(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = n
+		}
+		return v, nil
+	case int:
+		return json.Number(strconv.Itoa(v)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10)), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, ErrInvalidDocument
+		}
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,180 @@
+package arangit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffJSON(t *testing.T) {
+	d, err := DiffJSON(
+		[]byte(`{"balance":10,"owner":"alice","tags":["a","b"],"limits":{"daily":1,"a/b":1,"x~y":null},"rate":1,"items":[1,2,3],"meta":{"v":1}}`),
+		[]byte(`{"balance":20,"tags":["a","b","c"],"limits":{"daily":1,"a/b":2,"x~y":false},"rate":1.0,"items":[1],"meta":[1],"new":null}`),
+	)
+	assert.Nil(t, err)
+
+	patch, err := json.Marshal(d.JSONPatch())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[
+		{"op":"replace","path":"/balance","value":20},
+		{"op":"remove","path":"/items/2"},
+		{"op":"remove","path":"/items/1"},
+		{"op":"replace","path":"/limits/a~1b","value":2},
+		{"op":"replace","path":"/limits/x~0y","value":false},
+		{"op":"replace","path":"/meta","value":[1]},
+		{"op":"add","path":"/new","value":null},
+		{"op":"remove","path":"/owner"},
+		{"op":"add","path":"/tags/2","value":"c"}
+	]`, string(patch))
+
+	assert.Equal(t, ""+
+		"~ /balance: 10 -> 20\n"+
+		"- /items/2: 3\n"+
+		"- /items/1: 2\n"+
+		"~ /limits/a~1b: 1 -> 2\n"+
+		"~ /limits/x~0y: null -> false\n"+
+		"~ /meta: {\"v\":1} -> [1]\n"+
+		"+ /new: null\n"+
+		"- /owner: \"alice\"\n"+
+		"+ /tags/2: \"c\"\n", d.Summary())
+
+	d, err = DiffJSON([]byte(`{"a":[1,{"b":2}]}`), []byte(` { "a" : [ 1, { "b" : 2 } ] } `))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(d.Changes))
+
+	d, err = DiffJSON(nil, []byte(`{"a":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []ValueChange{{Type: ChangeAdded, Pointer: "", New: map[string]interface{}{"a": json.Number("1")}}}, d.Changes)
+
+	d, err = DiffJSON([]byte(`"a"`), []byte(`"b"`))
+	assert.Nil(t, err)
+	assert.Equal(t, "~ : \"a\" -> \"b\"\n", d.Summary())
+
+	_, err = DiffJSON([]byte(`{`), []byte(`{}`))
+	assert.NotNil(t, err)
+}
+
+func TestDiffYAML(t *testing.T) {
+	d, err := DiffYAML(
+		[]byte("name: app\nreplicas: 2\nports:\n  - 80\nenv:\n  DEBUG: true\n  1: one\n"),
+		[]byte("name: app\nreplicas: 3\nports: [80, 443]\nenv:\n  1: one\n  RATIO: 0.5\n"),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, ""+
+		"- /env/DEBUG: true\n"+
+		"+ /env/RATIO: 0.5\n"+
+		"+ /ports/1: 443\n"+
+		"~ /replicas: 2 -> 3\n", d.Summary())
+
+	patch, err := json.Marshal(d.JSONPatch())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[
+		{"op":"remove","path":"/env/DEBUG"},
+		{"op":"add","path":"/env/RATIO","value":0.5},
+		{"op":"add","path":"/ports/1","value":443},
+		{"op":"replace","path":"/replicas","value":3}
+	]`, string(patch))
+
+	// JSON has no NaN or infinity
+	for _, v := range []string{".nan", ".inf", "-.inf"} {
+		_, err = DiffYAML(nil, []byte("ratio: "+v+"\n"))
+		assert.Equal(t, ErrInvalidDocument, err, v)
+	}
+}
+
+func TestStructuralDiffOfRevisions(t *testing.T) {
+	r := openTestRepo(t)
+	_, err := r.CommitChangeset("", NewChangeset().
+		Put("fixture.json", []byte(`{"users":[{"name":"alice","balance":10}],"version":1}`)).
+		Put("deploy.yml", []byte("replicas: 2\n")).
+		Put("broken.json", []byte(`{"a":1}`)).
+		Put("notes.txt", []byte("a\n")), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, r.TagHead("v1"))
+
+	_, err = r.CommitChangeset("", NewChangeset().
+		Put("fixture.json", []byte(`{"users":[{"name":"alice","balance":20}],"version":1}`)).
+		Put("deploy.yml", []byte("replicas: 3\n")).
+		Put("broken.json", []byte(`{"a":`)).
+		Put("notes.txt", []byte("b\n")).
+		Put("new.json", []byte(`[]`)), nil)
+	assert.Nil(t, err)
+
+	result, err := r.Diff("v1", "HEAD", nil)
+	assert.Nil(t, err)
+	for _, f := range result.Files {
+		assert.Nil(t, f.Structural)
+	}
+
+	summaries := func(result *DiffResult) map[string]string {
+		s := map[string]string{}
+		for _, f := range result.Files {
+			if f.Structural != nil {
+				s[f.path()] = f.Structural.Summary()
+			}
+		}
+		return s
+	}
+
+	result, err = r.Diff("v1", "HEAD", &DiffOptions{Structural: true})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"deploy.yml":   "~ /replicas: 2 -> 3\n",
+		"fixture.json": "~ /users/0/balance: 10 -> 20\n",
+		"new.json":     "+ : []\n",
+	}, summaries(result))
+
+	// differs are picked by extension and can be replaced or disabled
+	result, err = r.Diff("v1", "HEAD", &DiffOptions{Structural: true, Differs: map[string]StructuralDiffer{
+		".json": nil,
+		".txt": func(from []byte, to []byte) (*StructuralDiff, error) {
+			return &StructuralDiff{Changes: []ValueChange{{Type: ChangeModified, Pointer: "/text", Old: string(from), New: string(to)}}}, nil
+		},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"deploy.yml": "~ /replicas: 2 -> 3\n",
+		"notes.txt":  "~ /text: \"a\\n\" -> \"b\\n\"\n",
+	}, summaries(result))
+}
+
+func TestStructuralDiffersOfRepo(t *testing.T) {
+	repo, err := OpenRepoFromDatabaseWithOptions(arangotest.NewDatabase("arangit"), &RepoOptions{
+		StructuralDiffers: map[string]StructuralDiffer{
+			".yml": nil,
+			".txt": func(from []byte, to []byte) (*StructuralDiff, error) {
+				return &StructuralDiff{Changes: []ValueChange{{Type: ChangeAdded, Pointer: "/text", New: string(to)}}}, nil
+			},
+		},
+	})
+	assert.Nil(t, err)
+	r := repo.(*repository)
+
+	_, err = r.CommitChangeset("", NewChangeset().
+		Put("a.json", []byte(`{"a":1}`)).
+		Put("b.yml", []byte("b: 1\n")).
+		Put("c.txt", []byte("c\n")), nil)
+	assert.Nil(t, err)
+
+	result, err := r.Diff("", "HEAD", &DiffOptions{Structural: true})
+	assert.Nil(t, err)
+	summaries := map[string]string{}
+	for _, f := range result.Files {
+		if f.Structural != nil {
+			summaries[f.path()] = f.Structural.Summary()
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"a.json": "+ : {\"a\":1}\n",
+		"c.txt":  "+ /text: \"c\\n\"\n",
+	}, summaries)
+
+	// the options of the diff take precedence
+	result, err = r.Diff("", "HEAD", &DiffOptions{Structural: true, Differs: map[string]StructuralDiffer{".txt": nil}})
+	assert.Nil(t, err)
+	for _, f := range result.Files {
+		assert.Equal(t, f.path() == "a.json", f.Structural != nil, f.path())
+	}
+}
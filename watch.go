@@ -0,0 +1,305 @@
+package arangit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const defaultWatchInterval = 10 * time.Second
+
+// ErrDetachedHead is returned when an operation needs the branch HEAD
+// points to but HEAD is detached.
+var ErrDetachedHead = errors.New("HEAD is detached")
+
+// WatchOptions -
+type WatchOptions struct {
+	// Branch is the branch changes are committed to, it defaults to the
+	// branch HEAD points to and is created if it doesn't exist
+	Branch string
+	// Dir is the directory documents are written to, it defaults to the
+	// name of the collection
+	Dir string
+	// Interval is the time between two polls, all changes made in between
+	// end up in the same commit. It defaults to 10 seconds.
+	Interval time.Duration
+	// OnError is called with the errors of the polls run by Start
+	OnError func(error)
+	// CommitOptions configure the commits of the watcher. The message
+	// replaces the subject "Update collection <name>", the keys of the
+	// changed documents are still listed below it.
+	CommitOptions
+}
+
+// Watcher commits the changes made to a collection to a branch. The files
+// are laid out like the ones written by SnapshotCollection, so watched
+// collections can be restored with RestoreCollection.
+type Watcher struct {
+	repo       *repository
+	collection string
+	branch     plumbing.ReferenceName
+	dir        string
+	interval   time.Duration
+	onError    func(error)
+	commit     CommitOptions
+
+	mu sync.Mutex
+	// revs are the document revisions seen by the last successful poll,
+	// it's nil before the first one
+	revs map[string]string
+
+	// runMu guards stop and done, which are set while Start's goroutine
+	// runs. It's separate from mu so that Stop can wait for a poll.
+	runMu sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// WatchCollection returns a watcher for the collection called name. The
+// watcher doesn't do anything until Start or Poll is called.
+func (r *repository) WatchCollection(name string, opts *WatchOptions) (*Watcher, error) {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+
+	branch, err := r.branchOrHead(opts.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		repo:       r,
+		collection: name,
+		branch:     branch,
+		dir:        opts.Dir,
+		interval:   opts.Interval,
+		onError:    opts.OnError,
+		commit:     opts.CommitOptions,
+	}
+	if w.dir == "" {
+		w.dir = name
+	}
+	if w.interval <= 0 {
+		w.interval = defaultWatchInterval
+	}
+	return w, nil
+}
+
+// Start polls the collection every interval on a separate goroutine until
+// Stop is called. It does nothing if the watcher is already started.
+func (w *Watcher) Start() {
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+	if w.stop != nil {
+		return
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := w.Poll()
+				if err != nil && w.onError != nil {
+					w.onError(err)
+				}
+			}
+		}
+	}(w.stop, w.done)
+}
+
+// Stop stops the polling started by Start and commits the changes made
+// since the last poll.
+func (w *Watcher) Stop() error {
+	w.runMu.Lock()
+	stop, done := w.stop, w.done
+	w.stop, w.done = nil, nil
+	w.runMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	_, err := w.Poll()
+	return err
+}
+
+// Poll commits the changes made to the collection since the last poll and
+// returns the new commit. The first poll commits all differences between
+// the collection and the branch. It returns plumbing.ZeroHash if nothing
+// changed.
+func (w *Watcher) Poll() (plumbing.Hash, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	revs, err := w.repo.store.CollectionRevisions(w.collection)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tree, err := w.branchTree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var keys, removed []string
+	for key, rev := range revs {
+		if old, ok := w.revs[key]; !ok || old != rev {
+			keys = append(keys, key)
+		}
+	}
+	if w.revs == nil {
+		removed, err = w.removedFiles(tree, revs)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	} else {
+		for key := range w.revs {
+			if _, ok := revs[key]; !ok {
+				removed = append(removed, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	sort.Strings(removed)
+
+	var docs []json.RawMessage
+	if len(keys) > 0 {
+		docs, err = w.repo.store.CollectionDocumentsByKey(w.collection, keys)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	var changes []fileChange
+	var inserted, updated, deleted []string
+	for _, doc := range docs {
+		key, content, err := snapshotDocument(doc)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		p := path.Join(w.dir, key+".json")
+		old, err := fileContent(tree, p)
+		if err == object.ErrFileNotFound {
+			inserted = append(inserted, key)
+		} else if err != nil {
+			return plumbing.ZeroHash, err
+		} else if bytes.Equal(old, content) {
+			continue
+		} else {
+			updated = append(updated, key)
+		}
+		changes = append(changes, fileChange{Path: p, Content: content})
+	}
+
+	for _, key := range removed {
+		p := path.Join(w.dir, key+".json")
+		_, err := fileContent(tree, p)
+		if err == object.ErrFileNotFound {
+			continue
+		} else if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		deleted = append(deleted, key)
+		changes = append(changes, fileChange{Path: p, Delete: true})
+	}
+
+	if len(changes) == 0 {
+		w.revs = revs
+		return plumbing.ZeroHash, nil
+	}
+
+	subject := "Update collection " + w.collection
+	if w.commit.Message != "" {
+		subject = w.commit.Message
+	}
+	opts := w.commit
+	opts.Message = watchMessage(subject, inserted, updated, deleted)
+	h, err := w.repo.commitChanges(w.branch, changes, w.repo.commitInfo(&opts, ""), nil)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	w.revs = revs
+	return h, nil
+}
+
+// branchTree returns the tree at the tip of the branch or nil if the
+// branch doesn't exist yet.
+func (w *Watcher) branchTree() (*object.Tree, error) {
+	ref, err := w.repo.repo.Reference(w.branch, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return w.repo.commitTree(ref.Hash())
+}
+
+// removedFiles returns the keys of the documents that have a file in tree
+// but don't exist in the collection anymore.
+func (w *Watcher) removedFiles(tree *object.Tree, revs map[string]string) ([]string, error) {
+	if tree == nil {
+		return nil, nil
+	}
+
+	dir, err := tree.Tree(w.dir)
+	if err == object.ErrDirectoryNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, e := range dir.Entries {
+		key := strings.TrimSuffix(e.Name, ".json")
+		if _, ok := revs[key]; !ok && e.Mode.IsFile() && key != e.Name {
+			removed = append(removed, key)
+		}
+	}
+	return removed, nil
+}
+
+func fileContent(tree *object.Tree, p string) ([]byte, error) {
+	if tree == nil {
+		return nil, object.ErrFileNotFound
+	}
+
+	f, err := tree.File(p)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := f.Contents()
+	return []byte(content), err
+}
+
+func watchMessage(subject string, inserted, updated, removed []string) string {
+	var sb strings.Builder
+	sb.WriteString(subject + "\n")
+	for _, keys := range []struct {
+		name string
+		keys []string
+	}{{"inserted", inserted}, {"updated", updated}, {"removed", removed}} {
+		if len(keys.keys) > 0 {
+			sb.WriteString("\n" + keys.name + ": " + strings.Join(keys.keys, ", "))
+		}
+	}
+	return sb.String() + "\n"
+}
@@ -0,0 +1,145 @@
+package arangit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mhelmich/arangit/arangodb/arangotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchCollection(t *testing.T) {
+	ctx := context.Background()
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	coll, err := db.CreateCollection(ctx, "users", nil)
+	assert.Nil(t, err)
+	for _, key := range []string{"a", "b"} {
+		_, err = coll.CreateDocument(ctx, map[string]interface{}{"_key": key, "name": key})
+		assert.Nil(t, err)
+	}
+
+	w, err := repo.WatchCollection("users", &WatchOptions{Branch: "cdc"})
+	assert.Nil(t, err)
+
+	first, err := w.Poll()
+	assert.Nil(t, err)
+	assert.False(t, first.IsZero())
+
+	r := repo.(*repository)
+	commit, err := r.repo.CommitObject(first)
+	assert.Nil(t, err)
+	assert.Equal(t, "Update collection users\n\ninserted: a, b\n", commit.Message)
+
+	h, err := w.Poll()
+	assert.Nil(t, err)
+	assert.True(t, h.IsZero())
+
+	// a touch without a change isn't committed
+	_, err = coll.UpdateDocument(ctx, "a", map[string]interface{}{"name": "a"})
+	assert.Nil(t, err)
+	h, err = w.Poll()
+	assert.Nil(t, err)
+	assert.True(t, h.IsZero())
+
+	_, err = coll.UpdateDocument(ctx, "a", map[string]interface{}{"name": "changed"})
+	assert.Nil(t, err)
+	_, err = coll.RemoveDocument(ctx, "b")
+	assert.Nil(t, err)
+	_, err = coll.CreateDocument(ctx, map[string]interface{}{"_key": "c"})
+	assert.Nil(t, err)
+
+	second, err := w.Poll()
+	assert.Nil(t, err)
+	commit, err = r.repo.CommitObject(second)
+	assert.Nil(t, err)
+	assert.Equal(t, "Update collection users\n\ninserted: c\nupdated: a\nremoved: b\n", commit.Message)
+	assert.Equal(t, []plumbing.Hash{first}, commit.ParentHashes)
+	assert.Equal(t, []string{"users/a.json", "users/b.json", "users/c.json"}, commitChanges(t, r, first, second))
+
+	branch, err := r.repo.Reference(plumbing.NewBranchReferenceName("cdc"), true)
+	assert.Nil(t, err)
+	assert.Equal(t, second, branch.Hash())
+
+	report, err := repo.RestoreCollection("users", "cdc", &RestoreOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, &RestoreReport{}, report)
+
+	// a new watcher starts from what the branch contains
+	w, err = repo.WatchCollection("users", &WatchOptions{Branch: "cdc"})
+	assert.Nil(t, err)
+	h, err = w.Poll()
+	assert.Nil(t, err)
+	assert.True(t, h.IsZero())
+
+	_, err = repo.WatchCollection("users", &WatchOptions{Branch: "../cdc"})
+	assert.Equal(t, ErrInvalidBranchName, err)
+}
+
+func TestWatchCollectionInBackground(t *testing.T) {
+	ctx := context.Background()
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	err = repo.CommitFile("readme.txt", bytes.NewBufferString("hello"))
+	assert.Nil(t, err)
+
+	coll, err := db.CreateCollection(ctx, "users", nil)
+	assert.Nil(t, err)
+
+	w, err := repo.WatchCollection("users", &WatchOptions{
+		Interval: time.Millisecond,
+		OnError:  func(err error) { assert.Nil(t, err) },
+	})
+	assert.Nil(t, err)
+
+	w.Start()
+	_, err = coll.CreateDocument(ctx, map[string]interface{}{"_key": "a"})
+	assert.Nil(t, err)
+	err = w.Stop()
+	assert.Nil(t, err)
+
+	// the watcher committed to the checked out branch, commits through the
+	// worktree must build on top of that
+	err = repo.CommitFile("other.txt", bytes.NewBufferString("world"))
+	assert.Nil(t, err)
+
+	bites, err := repo.ReadFileFromHead("users/a.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "{\n  \"_key\": \"a\"\n}\n", string(bites))
+
+	bites, err = repo.ReadFileFromHead("readme.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(bites))
+}
+
+func TestWatcherStartTwice(t *testing.T) {
+	ctx := context.Background()
+	db := arangotest.NewDatabase("arangit")
+	repo, err := OpenRepoFromDatabase(db)
+	assert.Nil(t, err)
+
+	coll, err := db.CreateCollection(ctx, "users", nil)
+	assert.Nil(t, err)
+
+	w, err := repo.WatchCollection("users", &WatchOptions{Interval: time.Millisecond})
+	assert.Nil(t, err)
+
+	w.Start()
+	w.Start()
+	assert.Nil(t, w.Stop())
+	assert.Nil(t, w.Stop())
+
+	// nothing polls after Stop
+	_, err = coll.CreateDocument(ctx, map[string]interface{}{"_key": "a"})
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = repo.ReadFileFromHead("users/a.json")
+	assert.NotNil(t, err)
+}